@@ -0,0 +1,136 @@
+// Copyright 2020 The kube-timeleap Authors.
+// SPDX-License-Identifier: BSD-3-Clause
+
+package v1alpha1
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	timeleapv1alpha1 "github.com/zchee/kube-timeleap/apis/timeleap/v1alpha1"
+)
+
+// List of pod annotations which opt the pod in to a time leap without authoring a TimeLeap.
+//
+// The annotations are read once on the pod creation, so they are usually set on the pod template of a
+// workload. Every pod with the same annotations in a namespace is bound to the same TimeLeap.
+const (
+	// OffsetAnnotation is the relative offset added to the real time, same as TimeLeapSpec.Offset,
+	// e.g. "+30d".
+	OffsetAnnotation = "timeleap.x-k8s.io/offset"
+
+	// TimeAnnotation is the absolute wall-clock instant in RFC 3339, same as TimeLeapSpec.Time,
+	// e.g. "2030-01-01T00:00:00Z".
+	TimeAnnotation = "timeleap.x-k8s.io/time"
+
+	// RateAnnotation is the speed of the virtual clock, same as TimeLeapSpec.Rate, e.g. "60".
+	RateAnnotation = "timeleap.x-k8s.io/rate"
+
+	// ClocksAnnotation is the comma separated kernel clocks affected by the time leap,
+	// e.g. "CLOCK_REALTIME,CLOCK_MONOTONIC". Defaults to CLOCK_REALTIME only.
+	ClocksAnnotation = "timeleap.x-k8s.io/clocks"
+)
+
+// BindLabel is the label of the pod which names the TimeLeap created for its annotations.
+//
+// The TimeLeap selects the pods by the label.
+const BindLabel = "timeleap.x-k8s.io/leap"
+
+// ManagedByLabel is the standard label of the TimeLeaps created by the injector.
+const ManagedByLabel = timeleapv1alpha1.ManagedByLabel
+
+// ManagedByInjector is the value of the ManagedByLabel of the TimeLeaps created by the injector.
+const ManagedByInjector = timeleapv1alpha1.ManagedByInjector
+
+// ParseAnnotations parses the time leap annotations of the pod to the TimeLeapSpec without the selector.
+//
+// ParseAnnotations reports false if the pod has none of the annotations. The values are checked against the
+// same bounds as a TimeLeap spec, i.e. MaxOffset, MinRate and MaxRate, so that a pod out of the bounds is
+// denied with the annotation named instead of failing to create the TimeLeap.
+func ParseAnnotations(annotations map[string]string) (*timeleapv1alpha1.TimeLeapSpec, bool, error) {
+	offset, hasOffset := annotations[OffsetAnnotation]
+	at, hasTime := annotations[TimeAnnotation]
+	rate, hasRate := annotations[RateAnnotation]
+	clocks, hasClocks := annotations[ClocksAnnotation]
+	if !hasOffset && !hasTime && !hasRate && !hasClocks {
+		return nil, false, nil
+	}
+
+	spec := &timeleapv1alpha1.TimeLeapSpec{}
+	switch {
+	case hasOffset && hasTime:
+		return nil, true, fmt.Errorf("annotations %s and %s are mutually exclusive", OffsetAnnotation, TimeAnnotation)
+	case !hasOffset && !hasTime:
+		return nil, true, fmt.Errorf("either annotation %s or %s is required", OffsetAnnotation, TimeAnnotation)
+	case hasOffset:
+		d, err := timeleapv1alpha1.ParseOffset(offset)
+		if err != nil {
+			return nil, true, fmt.Errorf("annotation %s: %w", OffsetAnnotation, err)
+		}
+		if d > timeleapv1alpha1.MaxOffset || d < -timeleapv1alpha1.MaxOffset {
+			return nil, true, fmt.Errorf("annotation %s: offset %q must be within %dd", OffsetAnnotation, offset, timeleapv1alpha1.MaxOffset/timeleapv1alpha1.Day)
+		}
+		spec.Offset = offset
+	case hasTime:
+		t, err := time.Parse(time.RFC3339, at)
+		if err != nil {
+			return nil, true, fmt.Errorf("annotation %s: invalid time %q, must be in RFC 3339 such as %q", TimeAnnotation, at, time.RFC3339)
+		}
+		if d := time.Until(t); d > timeleapv1alpha1.MaxOffset || d < -timeleapv1alpha1.MaxOffset {
+			return nil, true, fmt.Errorf("annotation %s: time %q must be within %dd of the current time", TimeAnnotation, at, timeleapv1alpha1.MaxOffset/timeleapv1alpha1.Day)
+		}
+		mt := metav1.NewTime(t)
+		spec.Time = &mt
+	}
+
+	if hasRate {
+		r, err := timeleapv1alpha1.ParseRate(rate)
+		if err != nil {
+			return nil, true, fmt.Errorf("annotation %s: %w", RateAnnotation, err)
+		}
+		if r < timeleapv1alpha1.MinRate || r > timeleapv1alpha1.MaxRate {
+			return nil, true, fmt.Errorf("annotation %s: rate %q must be between %g and %g", RateAnnotation, rate, timeleapv1alpha1.MinRate, timeleapv1alpha1.MaxRate)
+		}
+		spec.Rate = rate
+	}
+
+	if hasClocks {
+		seen := make(map[timeleapv1alpha1.ClockID]bool)
+		for _, name := range strings.Split(clocks, ",") {
+			id := timeleapv1alpha1.ClockID(strings.TrimSpace(name))
+			switch id {
+			case timeleapv1alpha1.ClockRealtime, timeleapv1alpha1.ClockMonotonic, timeleapv1alpha1.ClockBoottime:
+			default:
+				return nil, true, fmt.Errorf("annotation %s: unknown clock %q, must be one of %s, %s or %s", ClocksAnnotation, id,
+					timeleapv1alpha1.ClockRealtime, timeleapv1alpha1.ClockMonotonic, timeleapv1alpha1.ClockBoottime)
+			}
+			if seen[id] {
+				return nil, true, fmt.Errorf("annotation %s: duplicate clock %q", ClocksAnnotation, id)
+			}
+			seen[id] = true
+			spec.Clocks = append(spec.Clocks, timeleapv1alpha1.ClockSpec{ID: id})
+		}
+	}
+
+	return spec, true, nil
+}
+
+// TimeLeapName returns the name of the TimeLeap the injector creates for spec.
+//
+// The name derives from spec, so the pods with the same annotations share the TimeLeap.
+func TimeLeapName(spec *timeleapv1alpha1.TimeLeapSpec) (string, error) {
+	data, err := json.Marshal(spec)
+	if err != nil {
+		return "", fmt.Errorf("encode spec: %w", err)
+	}
+
+	h := fnv.New32a()
+	h.Write(data)
+
+	return fmt.Sprintf("timeleap-%08x", h.Sum32()), nil
+}
@@ -0,0 +1,179 @@
+// Copyright 2020 The kube-timeleap Authors.
+// SPDX-License-Identifier: BSD-3-Clause
+
+package v1alpha1
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	timeleapv1alpha1 "github.com/zchee/kube-timeleap/apis/timeleap/v1alpha1"
+)
+
+func TestParseAnnotations(t *testing.T) {
+	at := metav1.NewTime(time.Date(2030, time.January, 1, 0, 0, 0, 0, time.UTC))
+	tests := []struct {
+		name          string
+		annotations   map[string]string
+		want          *timeleapv1alpha1.TimeLeapSpec
+		wantAnnotated bool
+		wantErr       bool
+	}{
+		{
+			name:        "None",
+			annotations: map[string]string{"app": "sample"},
+		},
+		{
+			name: "Offset",
+			annotations: map[string]string{
+				OffsetAnnotation: "+30d",
+				RateAnnotation:   "60",
+				ClocksAnnotation: "CLOCK_REALTIME, CLOCK_MONOTONIC",
+			},
+			want: &timeleapv1alpha1.TimeLeapSpec{
+				Offset: "+30d",
+				Rate:   "60",
+				Clocks: []timeleapv1alpha1.ClockSpec{
+					{ID: timeleapv1alpha1.ClockRealtime},
+					{ID: timeleapv1alpha1.ClockMonotonic},
+				},
+			},
+			wantAnnotated: true,
+		},
+		{
+			name: "Time",
+			annotations: map[string]string{
+				TimeAnnotation: "2030-01-01T00:00:00Z",
+			},
+			want:          &timeleapv1alpha1.TimeLeapSpec{Time: &at},
+			wantAnnotated: true,
+		},
+		{
+			name: "OffsetAndTime",
+			annotations: map[string]string{
+				OffsetAnnotation: "+30d",
+				TimeAnnotation:   "2030-01-01T00:00:00Z",
+			},
+			wantAnnotated: true,
+			wantErr:       true,
+		},
+		{
+			name: "RateOnly",
+			annotations: map[string]string{
+				RateAnnotation: "60",
+			},
+			wantAnnotated: true,
+			wantErr:       true,
+		},
+		{
+			name: "InvalidOffset",
+			annotations: map[string]string{
+				OffsetAnnotation: "+30x",
+			},
+			wantAnnotated: true,
+			wantErr:       true,
+		},
+		{
+			name: "InvalidTime",
+			annotations: map[string]string{
+				TimeAnnotation: "2030-01-01",
+			},
+			wantAnnotated: true,
+			wantErr:       true,
+		},
+		{
+			name: "InvalidRate",
+			annotations: map[string]string{
+				OffsetAnnotation: "+30d",
+				RateAnnotation:   "-1",
+			},
+			wantAnnotated: true,
+			wantErr:       true,
+		},
+		{
+			name: "OffsetOutOfBounds",
+			annotations: map[string]string{
+				OffsetAnnotation: "+36501d",
+			},
+			wantAnnotated: true,
+			wantErr:       true,
+		},
+		{
+			name: "TimeOutOfBounds",
+			annotations: map[string]string{
+				TimeAnnotation: "2200-01-01T00:00:00Z",
+			},
+			wantAnnotated: true,
+			wantErr:       true,
+		},
+		{
+			name: "RateOutOfBounds",
+			annotations: map[string]string{
+				OffsetAnnotation: "+30d",
+				RateAnnotation:   "1e9",
+			},
+			wantAnnotated: true,
+			wantErr:       true,
+		},
+		{
+			name: "UnknownClock",
+			annotations: map[string]string{
+				OffsetAnnotation: "+30d",
+				ClocksAnnotation: "CLOCK_TAI",
+			},
+			wantAnnotated: true,
+			wantErr:       true,
+		},
+		{
+			name: "DuplicateClock",
+			annotations: map[string]string{
+				OffsetAnnotation: "+30d",
+				ClocksAnnotation: "CLOCK_REALTIME,CLOCK_REALTIME",
+			},
+			wantAnnotated: true,
+			wantErr:       true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, annotated, err := ParseAnnotations(tt.annotations)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseAnnotations() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if annotated != tt.wantAnnotated {
+				t.Fatalf("ParseAnnotations() annotated = %t, want %t", annotated, tt.wantAnnotated)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Fatalf("(-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestTimeLeapName(t *testing.T) {
+	a, err := TimeLeapName(&timeleapv1alpha1.TimeLeapSpec{Offset: "+30d"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := TimeLeapName(&timeleapv1alpha1.TimeLeapSpec{Offset: "+30d"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := TimeLeapName(&timeleapv1alpha1.TimeLeapSpec{Offset: "+31d"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if a != b {
+		t.Fatalf("same specs are named %s and %s", a, b)
+	}
+	if a == c {
+		t.Fatalf("different specs are both named %s", a)
+	}
+}
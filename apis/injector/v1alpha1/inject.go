@@ -0,0 +1,104 @@
+// Copyright 2020 The kube-timeleap Authors.
+// SPDX-License-Identifier: BSD-3-Clause
+
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+)
+
+// List of pod labels the injector uses.
+const (
+	// InjectLabel opts the pod in to the injection of the time-leap agent.
+	//
+	// The agent is injected only if the value is "enabled".
+	InjectLabel = "timeleap.x-k8s.io/inject"
+
+	// InjectedLabel marks the pod the time-leap agent is injected into. Only the injected pods can see
+	// the virtual clocks.
+	InjectedLabel = "timeleap.x-k8s.io/injected"
+)
+
+// InjectEnabled is the value of the InjectLabel which opts the pod in.
+const InjectEnabled = "enabled"
+
+// List of the objects injected into the pod.
+const (
+	// AgentContainerName is the name of the time-leap agent container.
+	AgentContainerName = "timeleap-agent"
+
+	// PodInfoVolumeName is the name of the downward API volume which hands the pod annotations to the agent.
+	PodInfoVolumeName = "timeleap-podinfo"
+
+	// PodInfoPath is the directory the PodInfoVolumeName volume is mounted on in the agent container.
+	PodInfoPath = "/etc/timeleap/podinfo"
+
+	// PodInfoAnnotationsFile is the file in PodInfoPath which holds the pod annotations.
+	PodInfoAnnotationsFile = "annotations"
+)
+
+// IsOptedIn reports whether the pod opts in to the injection.
+func IsOptedIn(pod *corev1.Pod) bool {
+	return pod.Labels[InjectLabel] == InjectEnabled
+}
+
+// IsInjected reports whether the time-leap agent is injected into the pod.
+func IsInjected(pod *corev1.Pod) bool {
+	return pod.Labels[InjectedLabel] == "true"
+}
+
+// Inject injects the time-leap agent running image into the pod.
+//
+// The agent attaches to the processes of the other containers with ptrace(2), so the pod shares the
+// process namespace and the agent is granted the SYS_PTRACE capability. The agent reads the virtual
+// clocks from the pod annotations through the downward API volume.
+func Inject(pod *corev1.Pod, image string) {
+	if pod.Labels == nil {
+		pod.Labels = make(map[string]string)
+	}
+	pod.Labels[InjectedLabel] = "true"
+
+	share := true
+	pod.Spec.ShareProcessNamespace = &share
+
+	pod.Spec.Volumes = append(pod.Spec.Volumes, corev1.Volume{
+		Name: PodInfoVolumeName,
+		VolumeSource: corev1.VolumeSource{
+			DownwardAPI: &corev1.DownwardAPIVolumeSource{
+				Items: []corev1.DownwardAPIVolumeFile{
+					{
+						Path:     PodInfoAnnotationsFile,
+						FieldRef: &corev1.ObjectFieldSelector{FieldPath: "metadata.annotations"},
+					},
+				},
+			},
+		},
+	})
+
+	pod.Spec.Containers = append(pod.Spec.Containers, corev1.Container{
+		Name:  AgentContainerName,
+		Image: image,
+		Env: []corev1.EnvVar{
+			{
+				Name:      "POD_NAME",
+				ValueFrom: &corev1.EnvVarSource{FieldRef: &corev1.ObjectFieldSelector{FieldPath: "metadata.name"}},
+			},
+			{
+				Name:      "POD_NAMESPACE",
+				ValueFrom: &corev1.EnvVarSource{FieldRef: &corev1.ObjectFieldSelector{FieldPath: "metadata.namespace"}},
+			},
+		},
+		VolumeMounts: []corev1.VolumeMount{
+			{
+				Name:      PodInfoVolumeName,
+				MountPath: PodInfoPath,
+				ReadOnly:  true,
+			},
+		},
+		SecurityContext: &corev1.SecurityContext{
+			Capabilities: &corev1.Capabilities{
+				Add: []corev1.Capability{"SYS_PTRACE"},
+			},
+		},
+	})
+}
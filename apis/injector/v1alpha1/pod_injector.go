@@ -6,12 +6,20 @@ package v1alpha1
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"net/http"
 
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	timeleapv1alpha1 "github.com/zchee/kube-timeleap/apis/timeleap/v1alpha1"
 )
 
 const (
@@ -21,11 +29,19 @@ const (
 
 var log = logf.Log.WithName("injector-resource")
 
-// +kubebuilder:webhook:webhookVersions=v1,verbs=create;update,path=/inject-v1-pod,mutating=false,failurePolicy=fail,matchPolicy=Equivalent,groups="",resources=pods,versions=v1,name=ipod.kb.io,sideEffects=NoneOnDryRun
+// +kubebuilder:webhook:webhookVersions=v1,verbs=create,path=/inject-v1-pod,mutating=true,failurePolicy=fail,matchPolicy=Equivalent,groups="",resources=pods,versions=v1,name=ipod.kb.io,sideEffects=NoneOnDryRun
+// +kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch
 
 // Pod represents a injecting pod.
 type Pod struct {
-	Client  client.Client
+	Client client.Client
+
+	// AgentImage is the image of the injected time-leap agent container.
+	AgentImage string
+
+	// Policy is the policy of the namespaces the injector acts on. A nil Policy acts on every namespace.
+	Policy *NamespacePolicy
+
 	decoder *admission.Decoder
 }
 
@@ -42,15 +58,152 @@ func (r *Pod) InjectDecoder(d *admission.Decoder) error {
 }
 
 // Handle implements admission.Handler.
+//
+// Handle injects the time-leap agent into the opted-in pods on creation, and binds the pods with the time leap
+// annotations to the TimeLeap created for them. The pod spec fields it touches are immutable, so the other
+// operations are allowed as is.
 func (r *Pod) Handle(ctx context.Context, req admission.Request) admission.Response {
-	pod := &corev1.Pod{}
+	if req.Operation != admissionv1beta1.Create {
+		return admission.Allowed("")
+	}
 
+	if r.Policy != nil {
+		allowed, err := r.allowsNamespace(ctx, req.Namespace)
+		if err != nil {
+			return admission.Errored(http.StatusInternalServerError, err)
+		}
+		if !allowed {
+			return admission.Allowed("namespace is not opted in")
+		}
+	}
+
+	pod := &corev1.Pod{}
 	err := r.decoder.Decode(req, pod)
 	if err != nil {
 		return admission.Errored(http.StatusBadRequest, err)
 	}
 
-	log.Info("Get request from pod", "pod", pod)
+	spec, annotated, err := ParseAnnotations(pod.Annotations)
+	if err != nil {
+		return denied(fmt.Sprintf("invalid time leap annotations: %v", err))
+	}
+	if !annotated && !IsOptedIn(pod) {
+		return admission.Allowed("pod is not opted in")
+	}
+
+	if annotated {
+		name, err := TimeLeapName(spec)
+		if err != nil {
+			return admission.Errored(http.StatusInternalServerError, err)
+		}
+		// the TimeLeap is a side effect, so it is not created on dry-run
+		if req.DryRun == nil || !*req.DryRun {
+			if err := r.bind(ctx, req.Namespace, name, spec); err != nil {
+				if apierrors.IsInvalid(err) {
+					// the annotations passed ParseAnnotations but not the TimeLeap validation
+					return denied(fmt.Sprintf("invalid time leap annotations: %v", err))
+				}
+				return admission.Errored(http.StatusInternalServerError, err)
+			}
+		}
+		if pod.Labels == nil {
+			pod.Labels = make(map[string]string)
+		}
+		pod.Labels[BindLabel] = name
+		log.Info("binding pod", "namespace", req.Namespace, "pod", podName(pod), "timeleap", name)
+	}
+
+	if !IsInjected(pod) {
+		Inject(pod, r.AgentImage)
+		log.Info("injecting agent", "namespace", req.Namespace, "pod", podName(pod))
+	}
+
+	marshaled, err := json.Marshal(pod)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+
+	return admission.PatchResponseFromRaw(req.Object.Raw, marshaled)
+}
+
+// allowsNamespace reports whether the Policy allows the injector to act on the pods in the namespace.
+func (r *Pod) allowsNamespace(ctx context.Context, name string) (bool, error) {
+	if r.Policy.Excludes(name) {
+		return false, nil
+	}
+
+	ns := &corev1.Namespace{}
+	if err := r.Client.Get(ctx, client.ObjectKey{Name: name}, ns); err != nil {
+		return false, fmt.Errorf("get namespace %s: %w", name, err)
+	}
+
+	return r.Policy.Allows(ns), nil
+}
+
+// bind creates the TimeLeap named name with spec in the namespace, unless the injector has already created it.
+//
+// The TimeLeap created by the injector gets no default TTL, but one given by hand can still expire it. An
+// expired TimeLeap no longer drives its pods, so it's deleted and bind fails until the deletion completes,
+// which the pod creation is retried for.
+func (r *Pod) bind(ctx context.Context, namespace, name string, spec *timeleapv1alpha1.TimeLeapSpec) error {
+	tl := &timeleapv1alpha1.TimeLeap{}
+	err := r.Client.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, tl)
+	switch {
+	case err == nil:
+		if tl.Labels[ManagedByLabel] != ManagedByInjector {
+			return fmt.Errorf("TimeLeap %s/%s exists but is not managed by the injector", namespace, name)
+		}
+		if !tl.DeletionTimestamp.IsZero() {
+			return fmt.Errorf("TimeLeap %s/%s is being deleted, retry once it's gone", namespace, name)
+		}
+		if meta.IsStatusConditionTrue(tl.Status.Conditions, timeleapv1alpha1.ConditionExpired) {
+			if err := r.Client.Delete(ctx, tl); client.IgnoreNotFound(err) != nil {
+				return fmt.Errorf("delete expired TimeLeap %s/%s: %w", namespace, name, err)
+			}
+			return fmt.Errorf("TimeLeap %s/%s has expired and is being recreated, retry once it's gone", namespace, name)
+		}
+		return nil
+	case !apierrors.IsNotFound(err):
+		return fmt.Errorf("get TimeLeap %s/%s: %w", namespace, name, err)
+	}
+
+	tl = &timeleapv1alpha1.TimeLeap{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: namespace,
+			Name:      name,
+			Labels: map[string]string{
+				ManagedByLabel: ManagedByInjector,
+			},
+		},
+		Spec: *spec,
+	}
+	tl.Spec.Selector = metav1.LabelSelector{
+		MatchLabels: map[string]string{
+			BindLabel: name,
+		},
+	}
+	if err := r.Client.Create(ctx, tl); err != nil && !apierrors.IsAlreadyExists(err) {
+		return fmt.Errorf("create TimeLeap %s/%s: %w", namespace, name, err)
+	}
+
+	return nil
+}
+
+// denied returns the response which denies the request with the message shown to the user.
+//
+// admission.Denied sets the message as the reason only, which the API server does not show.
+func denied(message string) admission.Response {
+	resp := admission.Denied(message)
+	resp.Result.Message = message
+
+	return resp
+}
+
+// podName returns the name of the pod, or its generateName if the name is not generated yet.
+func podName(pod *corev1.Pod) string {
+	if pod.Name != "" {
+		return pod.Name
+	}
 
-	return admission.Response{}
+	return pod.GenerateName
 }
@@ -0,0 +1,326 @@
+// Copyright 2020 The kube-timeleap Authors.
+// SPDX-License-Identifier: BSD-3-Clause
+
+package v1alpha1
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	evanjsonpatch "github.com/evanphx/json-patch"
+	"github.com/google/go-cmp/cmp"
+	jsonpatch "gomodules.xyz/jsonpatch/v2"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	timeleapv1alpha1 "github.com/zchee/kube-timeleap/apis/timeleap/v1alpha1"
+)
+
+func newTestPod(t *testing.T, objs ...client.Object) *Pod {
+	t.Helper()
+
+	c := newFakeClient(t, objs...)
+	decoder, err := admission.NewDecoder(c.Scheme())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := &Pod{
+		Client:     c,
+		AgentImage: "agent:test",
+	}
+	if err := r.InjectDecoder(decoder); err != nil {
+		t.Fatal(err)
+	}
+
+	return r
+}
+
+func podRequest(t *testing.T, op admissionv1beta1.Operation, pod *corev1.Pod) admission.Request {
+	t.Helper()
+
+	raw, err := json.Marshal(pod)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return admission.Request{
+		AdmissionRequest: admissionv1beta1.AdmissionRequest{
+			Operation: op,
+			Namespace: "default",
+			Object:    runtime.RawExtension{Raw: raw},
+		},
+	}
+}
+
+func TestPod_Handle(t *testing.T) {
+	app := corev1.Container{Name: "app", Image: "app"}
+	tests := []struct {
+		name      string
+		op        admissionv1beta1.Operation
+		labels    map[string]string
+		wantPatch bool
+	}{
+		{
+			name:      "OptedIn",
+			op:        admissionv1beta1.Create,
+			labels:    map[string]string{InjectLabel: InjectEnabled},
+			wantPatch: true,
+		},
+		{
+			name:   "NotOptedIn",
+			op:     admissionv1beta1.Create,
+			labels: map[string]string{InjectLabel: "disabled"},
+		},
+		{
+			name:   "AlreadyInjected",
+			op:     admissionv1beta1.Create,
+			labels: map[string]string{InjectLabel: InjectEnabled, InjectedLabel: "true"},
+		},
+		{
+			name:   "Update",
+			op:     admissionv1beta1.Update,
+			labels: map[string]string{InjectLabel: InjectEnabled},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: "pod", Labels: tt.labels},
+				Spec:       corev1.PodSpec{Containers: []corev1.Container{app}},
+			}
+			resp := newTestPod(t).Handle(context.Background(), podRequest(t, tt.op, pod))
+			if !resp.Allowed {
+				t.Fatalf("Handle() denied: %v", resp.Result)
+			}
+			if got := len(resp.Patches) > 0; got != tt.wantPatch {
+				t.Fatalf("Handle() patched = %t, want %t: %v", got, tt.wantPatch, resp.Patches)
+			}
+			if !tt.wantPatch {
+				return
+			}
+
+			injected := applyPatches(t, pod, resp.Patches)
+			if !IsInjected(injected) {
+				t.Fatal("injected pod is not labeled")
+			}
+			if s := injected.Spec.ShareProcessNamespace; s == nil || !*s {
+				t.Fatal("injected pod does not share the process namespace")
+			}
+			if n := len(injected.Spec.Containers); n != 2 {
+				t.Fatalf("len(Containers) = %d, want 2", n)
+			}
+			agent := injected.Spec.Containers[1]
+			if agent.Name != AgentContainerName || agent.Image != "agent:test" {
+				t.Fatalf("agent container = %s (%s)", agent.Name, agent.Image)
+			}
+			if caps := agent.SecurityContext.Capabilities.Add; len(caps) != 1 || caps[0] != "SYS_PTRACE" {
+				t.Fatalf("agent capabilities = %v, want [SYS_PTRACE]", caps)
+			}
+		})
+	}
+}
+
+func TestPod_Handle_Annotations(t *testing.T) {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: "app-",
+			Annotations: map[string]string{
+				OffsetAnnotation: "+30d",
+				RateAnnotation:   "60",
+			},
+		},
+		Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "app", Image: "app"}}},
+	}
+	ctx := context.Background()
+
+	r := newTestPod(t)
+	resp := r.Handle(ctx, podRequest(t, admissionv1beta1.Create, pod))
+	if !resp.Allowed {
+		t.Fatalf("Handle() denied: %v", resp.Result)
+	}
+
+	injected := applyPatches(t, pod, resp.Patches)
+	if !IsInjected(injected) {
+		t.Fatal("annotated pod is not injected")
+	}
+	name := injected.Labels[BindLabel]
+	if name == "" {
+		t.Fatal("annotated pod is not bound")
+	}
+
+	tl := &timeleapv1alpha1.TimeLeap{}
+	if err := r.Client.Get(ctx, client.ObjectKey{Namespace: "default", Name: name}, tl); err != nil {
+		t.Fatal(err)
+	}
+	want := timeleapv1alpha1.TimeLeapSpec{
+		Selector: metav1.LabelSelector{MatchLabels: map[string]string{BindLabel: name}},
+		Offset:   "+30d",
+		Rate:     "60",
+	}
+	if diff := cmp.Diff(want, tl.Spec); diff != "" {
+		t.Fatalf("(-want +got):\n%s", diff)
+	}
+
+	// the next replica binds to the same TimeLeap
+	resp = r.Handle(ctx, podRequest(t, admissionv1beta1.Create, pod))
+	if got := applyPatches(t, pod, resp.Patches).Labels[BindLabel]; got != name {
+		t.Fatalf("next replica is bound to %s, want %s", got, name)
+	}
+}
+
+func TestPod_Handle_InvalidAnnotations(t *testing.T) {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "pod",
+			Annotations: map[string]string{
+				OffsetAnnotation: "+30x",
+			},
+		},
+	}
+
+	resp := newTestPod(t).Handle(context.Background(), podRequest(t, admissionv1beta1.Create, pod))
+	if resp.Allowed {
+		t.Fatal("Handle() allowed the invalid annotations")
+	}
+	if msg := resp.Result.Message; !strings.Contains(msg, OffsetAnnotation) {
+		t.Fatalf("denial message %q does not name the annotation", msg)
+	}
+}
+
+func TestPod_Handle_Unmanaged(t *testing.T) {
+	spec := &timeleapv1alpha1.TimeLeapSpec{Offset: "+30d"}
+	name, err := TimeLeapName(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	existing := &timeleapv1alpha1.TimeLeap{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name}}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "pod",
+			Annotations: map[string]string{OffsetAnnotation: "+30d"},
+		},
+	}
+
+	resp := newTestPod(t, existing).Handle(context.Background(), podRequest(t, admissionv1beta1.Create, pod))
+	if resp.Allowed {
+		t.Fatal("Handle() bound the pod to a TimeLeap not managed by the injector")
+	}
+}
+
+func TestPod_Handle_Expired(t *testing.T) {
+	spec := &timeleapv1alpha1.TimeLeapSpec{Offset: "+30d"}
+	name, err := TimeLeapName(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired := &timeleapv1alpha1.TimeLeap{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      name,
+			Labels:    map[string]string{ManagedByLabel: ManagedByInjector},
+		},
+		Status: timeleapv1alpha1.TimeLeapStatus{
+			Conditions: []metav1.Condition{{Type: timeleapv1alpha1.ConditionExpired, Status: metav1.ConditionTrue}},
+		},
+	}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "pod",
+			Annotations: map[string]string{OffsetAnnotation: "+30d"},
+		},
+	}
+	ctx := context.Background()
+
+	r := newTestPod(t, expired)
+	if resp := r.Handle(ctx, podRequest(t, admissionv1beta1.Create, pod)); resp.Allowed {
+		t.Fatal("Handle() bound the pod to an expired TimeLeap")
+	}
+	err = r.Client.Get(ctx, client.ObjectKey{Namespace: "default", Name: name}, &timeleapv1alpha1.TimeLeap{})
+	if !apierrors.IsNotFound(err) {
+		t.Fatalf("expired TimeLeap is not deleted: %v", err)
+	}
+
+	// the retried creation binds to the recreated TimeLeap
+	if resp := r.Handle(ctx, podRequest(t, admissionv1beta1.Create, pod)); !resp.Allowed {
+		t.Fatalf("Handle() denied: %v", resp.Result)
+	}
+}
+
+func TestPod_Handle_NamespacePolicy(t *testing.T) {
+	const label = "timeleap.x-k8s.io/injection"
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "pod", Labels: map[string]string{InjectLabel: InjectEnabled}},
+	}
+	tests := []struct {
+		name      string
+		ns        *corev1.Namespace
+		wantPatch bool
+	}{
+		{
+			name:      "OptedIn",
+			ns:        &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default", Labels: map[string]string{label: InjectionEnabled}}},
+			wantPatch: true,
+		},
+		{
+			name: "NotOptedIn",
+			ns:   &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default"}},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			r := newTestPod(t, tt.ns)
+			r.Policy = NewNamespacePolicy(label, "kube-timeleap-system")
+
+			resp := r.Handle(context.Background(), podRequest(t, admissionv1beta1.Create, pod))
+			if !resp.Allowed {
+				t.Fatalf("Handle() denied: %v", resp.Result)
+			}
+			if got := len(resp.Patches) > 0; got != tt.wantPatch {
+				t.Fatalf("Handle() patched = %t, want %t", got, tt.wantPatch)
+			}
+		})
+	}
+}
+
+// applyPatches applies the JSON patches to the pod.
+func applyPatches(t *testing.T, pod *corev1.Pod, patches []jsonpatch.JsonPatchOperation) *corev1.Pod {
+	t.Helper()
+
+	original, err := json.Marshal(pod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ops, err := json.Marshal(patches)
+	if err != nil {
+		t.Fatal(err)
+	}
+	patch, err := evanjsonpatch.DecodePatch(ops)
+	if err != nil {
+		t.Fatal(err)
+	}
+	patched, err := patch.Apply(original)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := &corev1.Pod{}
+	if err := json.Unmarshal(patched, got); err != nil {
+		t.Fatal(err)
+	}
+
+	return got
+}
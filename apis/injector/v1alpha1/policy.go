@@ -0,0 +1,59 @@
+// Copyright 2020 The kube-timeleap Authors.
+// SPDX-License-Identifier: BSD-3-Clause
+
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// InjectionEnabled is the value of the namespace injection label which opts the namespace in.
+const InjectionEnabled = "enabled"
+
+// NamespacePolicy is the policy of the namespaces the pod injector acts on.
+//
+// The webhook configuration selects the opted-in namespaces too, the policy guards the injector against a
+// misconfigured or stale manifest.
+type NamespacePolicy struct {
+	// Label is the namespace label which opts the namespace in, with the InjectionEnabled value.
+	Label string
+
+	// Excluded is the namespaces the injector never acts on even if opted in.
+	Excluded []string
+}
+
+// NewNamespacePolicy returns the NamespacePolicy which opts the namespaces in by label and never acts on
+// kube-system, the namespace the manager runs in and excluded.
+func NewNamespacePolicy(label, managerNamespace string, excluded ...string) *NamespacePolicy {
+	p := &NamespacePolicy{
+		Label:    label,
+		Excluded: []string{metav1.NamespaceSystem},
+	}
+	if managerNamespace != "" {
+		p.Excluded = append(p.Excluded, managerNamespace)
+	}
+	p.Excluded = append(p.Excluded, excluded...)
+
+	return p
+}
+
+// Excludes reports whether the namespace named name is excluded regardless of its labels.
+func (p *NamespacePolicy) Excludes(name string) bool {
+	for _, ns := range p.Excluded {
+		if ns == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Allows reports whether the injector acts on the pods in ns.
+func (p *NamespacePolicy) Allows(ns *corev1.Namespace) bool {
+	if p.Excludes(ns.Name) {
+		return false
+	}
+
+	return ns.Labels[p.Label] == InjectionEnabled
+}
@@ -0,0 +1,61 @@
+// Copyright 2020 The kube-timeleap Authors.
+// SPDX-License-Identifier: BSD-3-Clause
+
+package v1alpha1
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestNamespacePolicy_Allows(t *testing.T) {
+	const label = "timeleap.x-k8s.io/injection"
+	policy := NewNamespacePolicy(label, "kube-timeleap-system", "monitoring")
+
+	tests := []struct {
+		name   string
+		ns     string
+		labels map[string]string
+		want   bool
+	}{
+		{
+			name:   "OptedIn",
+			ns:     "default",
+			labels: map[string]string{label: InjectionEnabled},
+			want:   true,
+		},
+		{
+			name:   "NotOptedIn",
+			ns:     "default",
+			labels: map[string]string{label: "disabled"},
+		},
+		{
+			name:   "KubeSystem",
+			ns:     metav1.NamespaceSystem,
+			labels: map[string]string{label: InjectionEnabled},
+		},
+		{
+			name:   "ManagerNamespace",
+			ns:     "kube-timeleap-system",
+			labels: map[string]string{label: InjectionEnabled},
+		},
+		{
+			name:   "Excluded",
+			ns:     "monitoring",
+			labels: map[string]string{label: InjectionEnabled},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: tt.ns, Labels: tt.labels}}
+			if got := policy.Allows(ns); got != tt.want {
+				t.Fatalf("Allows(%s) = %t, want %t", tt.ns, got, tt.want)
+			}
+		})
+	}
+}
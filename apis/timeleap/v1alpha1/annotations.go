@@ -0,0 +1,42 @@
+// Copyright 2020 The kube-timeleap Authors.
+// SPDX-License-Identifier: BSD-3-Clause
+
+package v1alpha1
+
+// List of pod annotations the controller uses to hand the virtual clocks to the node.
+const (
+	// TimeLeapAnnotation is the name of the TimeLeap which drives the clocks of the pod.
+	TimeLeapAnnotation = "timeleap.x-k8s.io/timeleap"
+
+	// ClocksAnnotation is the virtual clocks the pod should see, as the JSON encoded vclock.Set.
+	//
+	// The real time is restored on the pod when the annotation is removed.
+	ClocksAnnotation = "timeleap.x-k8s.io/virtual-clocks"
+
+	// SpecHashAnnotation is the hash of the TimeLeap spec fields the virtual clocks of the pod derive from.
+	//
+	// The controller continues the applied clocks as long as the hash matches, so that only a rate change
+	// does not make the virtual time jump.
+	SpecHashAnnotation = "timeleap.x-k8s.io/spec-hash"
+
+	// SkewAnnotation is the offset assigned to the pod by the skew of the TimeLeap, set only with a skew.
+	//
+	// Unlike the status of the TimeLeap, which keeps up to MaxPodResults pods, every skewed pod carries it.
+	SkewAnnotation = "timeleap.x-k8s.io/skew"
+)
+
+// List of TimeLeap labels.
+const (
+	// ManagedByLabel is the standard label of the TimeLeaps created by a component of kube-timeleap.
+	ManagedByLabel = "app.kubernetes.io/managed-by"
+
+	// ManagedByInjector is the value of the ManagedByLabel of the TimeLeaps created by the pod injector.
+	ManagedByInjector = "kube-timeleap-injector"
+)
+
+// List of TimeLeap annotations.
+const (
+	// CreatedByAnnotation is the name of the user who created the TimeLeap, stamped by the mutating webhook
+	// for auditing. The webhook keeps the original value on update.
+	CreatedByAnnotation = "timeleap.x-k8s.io/created-by"
+)
@@ -0,0 +1,210 @@
+// Copyright 2020 The kube-timeleap Authors.
+// SPDX-License-Identifier: BSD-3-Clause
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func init() {
+	SchemeBuilder.Register(&ClusterTimeLeap{}, &ClusterTimeLeapList{})
+}
+
+// ClusterTimeLeapLabel is the label of the TimeLeaps created for a ClusterTimeLeap, whose value is the name of
+// the ClusterTimeLeap.
+const ClusterTimeLeapLabel = "timeleap.x-k8s.io/cluster-timeleap"
+
+// ClusterTimeLeapSpec defines the desired state of ClusterTimeLeap.
+//
+// Exactly one of Offset or Time must be set.
+type ClusterTimeLeapSpec struct {
+	// NamespaceSelector is a label query over namespaces whose pods should see the virtual time.
+	//
+	// kube-system, the namespace the manager runs in and the namespaces excluded from the pod injection are
+	// never selected.
+	NamespaceSelector metav1.LabelSelector `json:"namespaceSelector"`
+
+	// PodSelector is a label query over pods in the selected namespaces that should see the virtual time.
+	PodSelector metav1.LabelSelector `json:"podSelector"`
+
+	// Mode is the mode of the virtual clock, same as TimeLeapSpec.Mode. Defaults to "Offset".
+	//
+	// In the "Freeze" mode every selected namespace is frozen at the same instant.
+	// +optional
+	Mode TimeLeapMode `json:"mode,omitempty"`
+
+	// Offset is the relative offset added to the real time, same as TimeLeapSpec.Offset.
+	// +kubebuilder:validation:Pattern=`^[+-]?([0-9]+(\.[0-9]+)?(ns|us|µs|ms|s|m|h|d|w))+$`
+	// +optional
+	Offset string `json:"offset,omitempty"`
+
+	// Time is the absolute wall-clock instant the selected pods should see, same as TimeLeapSpec.Time.
+	// +optional
+	Time *metav1.Time `json:"time,omitempty"`
+
+	// Slew configures how the clock converges to the target in the "Slew" mode, same as TimeLeapSpec.Slew.
+	// +optional
+	Slew *SlewSpec `json:"slew,omitempty"`
+
+	// Skew assigns each selected pod a pseudo-random offset within a range, same as TimeLeapSpec.Skew.
+	// +optional
+	Skew *SkewSpec `json:"skew,omitempty"`
+
+	// Rate is the speed of the virtual clock relative to the real clock, same as TimeLeapSpec.Rate.
+	// +kubebuilder:validation:Pattern=`^([0-9]+(\.[0-9]*)?|\.[0-9]+)$`
+	// +optional
+	Rate string `json:"rate,omitempty"`
+
+	// Clocks is the list of kernel clocks affected by the ClusterTimeLeap, same as TimeLeapSpec.Clocks.
+	// +listType=map
+	// +listMapKey=id
+	// +optional
+	Clocks []ClockSpec `json:"clocks,omitempty"`
+
+	// TTL is the lifetime of the ClusterTimeLeap since its creation.
+	//
+	// When the TTL elapses the controller deletes the TimeLeaps created in the selected namespaces, which
+	// restores the real time on the pods, and marks the ClusterTimeLeap as Expired.
+	// +optional
+	TTL *metav1.Duration `json:"ttl,omitempty"`
+
+	// DeleteOnExpiry deletes the ClusterTimeLeap once it has expired.
+	// +optional
+	DeleteOnExpiry bool `json:"deleteOnExpiry,omitempty"`
+}
+
+// ClusterTimeLeapStatus defines the observed state of ClusterTimeLeap.
+type ClusterTimeLeapStatus struct {
+	// ObservedGeneration is the most recent generation observed by the controller.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// FrozenAt is the virtual instant every selected namespace is frozen at, set only in the "Freeze" mode.
+	// +optional
+	FrozenAt *metav1.Time `json:"frozenAt,omitempty"`
+
+	// ExpirationTime is the instant the TTL of the ClusterTimeLeap elapses.
+	// +optional
+	ExpirationTime *metav1.Time `json:"expirationTime,omitempty"`
+
+	// Epoch is the anchor of the virtual clocks shared by the TimeLeaps in every selected namespace.
+	// +optional
+	Epoch *VirtualEpoch `json:"epoch,omitempty"`
+
+	// Namespaces is the selected namespaces in ascending order.
+	// +optional
+	Namespaces []string `json:"namespaces,omitempty"`
+
+	// TargetedPods is the number of pods selected in every selected namespace.
+	// +optional
+	TargetedPods int32 `json:"targetedPods,omitempty"`
+
+	// AppliedPods is the number of targeted pods which see the virtual clocks.
+	// +optional
+	AppliedPods int32 `json:"appliedPods,omitempty"`
+
+	// FailedPods is the number of targeted pods which the virtual clocks failed to be applied to.
+	// +optional
+	FailedPods int32 `json:"failedPods,omitempty"`
+
+	// Conditions is the list of the latest observations of the ClusterTimeLeap state.
+	// +listType=map
+	// +listMapKey=type
+	// +patchMergeKey=type
+	// +patchStrategy=merge
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:scope=Cluster
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Mode",type=string,JSONPath=`.spec.mode`
+// +kubebuilder:printcolumn:name="Offset",type=string,JSONPath=`.spec.offset`
+// +kubebuilder:printcolumn:name="Time",type=string,JSONPath=`.spec.time`,priority=1
+// +kubebuilder:printcolumn:name="Namespaces",type=string,JSONPath=`.status.namespaces`,priority=1
+// +kubebuilder:printcolumn:name="Targeted",type=integer,JSONPath=`.status.targetedPods`
+// +kubebuilder:printcolumn:name="Applied",type=integer,JSONPath=`.status.appliedPods`
+// +kubebuilder:printcolumn:name="Failed",type=integer,JSONPath=`.status.failedPods`
+// +kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+// +kubebuilder:printcolumn:name="Frozen At",type=date,JSONPath=`.status.frozenAt`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// ClusterTimeLeap is the Schema for the clustertimeleaps API.
+//
+// A ClusterTimeLeap drives a TimeLeap in every selected namespace, so that the namespaces see the same
+// virtual time.
+type ClusterTimeLeap struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ClusterTimeLeapSpec   `json:"spec,omitempty"`
+	Status ClusterTimeLeapStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// ClusterTimeLeapList contains a list of ClusterTimeLeap.
+type ClusterTimeLeapList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ClusterTimeLeap `json:"items"`
+}
+
+// IsFrozen reports whether the spec pins the selected pods at a single instant.
+func (s *ClusterTimeLeapSpec) IsFrozen() bool {
+	return s.Mode == FreezeMode
+}
+
+// TimeLeapSpec returns the spec of the TimeLeap created in each selected namespace.
+//
+// The TimeLeaps are anchored at epoch, and in the "Freeze" mode select frozenAt as the absolute time, so that
+// every namespace sees the same virtual time regardless of when its TimeLeap is observed. The returned spec
+// is defaulted same as the mutating webhook does, so it can be compared with the stored one. It has no TTL,
+// since the TimeLeaps live as long as the ClusterTimeLeap which expires them by itself.
+func (s *ClusterTimeLeapSpec) TimeLeapSpec(frozenAt *metav1.Time, epoch *VirtualEpoch) TimeLeapSpec {
+	spec := TimeLeapSpec{
+		Selector: *s.PodSelector.DeepCopy(),
+		Mode:     s.Mode,
+		Offset:   s.Offset,
+		Rate:     s.Rate,
+	}
+	if s.Time != nil {
+		spec.Time = s.Time.DeepCopy()
+	}
+	if s.IsFrozen() && frozenAt != nil {
+		spec.Offset = ""
+		spec.Time = frozenAt.DeepCopy()
+	}
+	if s.Slew != nil {
+		spec.Slew = s.Slew.DeepCopy()
+	}
+	if s.Skew != nil {
+		spec.Skew = s.Skew.DeepCopy()
+	}
+	if len(s.Clocks) > 0 {
+		spec.Clocks = make([]ClockSpec, len(s.Clocks))
+		copy(spec.Clocks, s.Clocks)
+	}
+	if epoch != nil {
+		spec.Epoch = &EpochSpec{
+			Time:   epoch.Time,
+			Origin: epoch.Origin,
+			Drift:  epoch.Drift,
+		}
+	}
+	spec.setDefaults()
+
+	return spec
+}
+
+// ExpirationTime returns the instant the TTL of ctl elapses, or nil if ctl has no TTL.
+func (ctl *ClusterTimeLeap) ExpirationTime() *metav1.Time {
+	if ctl.Spec.TTL == nil {
+		return nil
+	}
+	t := metav1.NewTime(ctl.CreationTimestamp.Add(ctl.Spec.TTL.Duration))
+
+	return &t
+}
@@ -0,0 +1,197 @@
+// Copyright 2020 The kube-timeleap Authors.
+// SPDX-License-Identifier: BSD-3-Clause
+
+package v1alpha1
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+func TestClusterTimeLeapSpec_TimeLeapSpec(t *testing.T) {
+	t.Parallel()
+
+	podSelector := metav1.LabelSelector{MatchLabels: map[string]string{"app": "sample"}}
+	frozenAt := metav1.NewTime(time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	tests := []struct {
+		name     string
+		spec     ClusterTimeLeapSpec
+		frozenAt *metav1.Time
+		want     TimeLeapSpec
+	}{
+		{
+			name: "Offset",
+			spec: ClusterTimeLeapSpec{
+				NamespaceSelector: metav1.LabelSelector{MatchLabels: map[string]string{"team": "a"}},
+				PodSelector:       podSelector,
+				Offset:            "+24h",
+				Rate:              "2",
+			},
+			want: TimeLeapSpec{
+				Selector: podSelector,
+				Mode:     OffsetMode,
+				Offset:   "+24h",
+				Rate:     "2",
+				Clocks:   []ClockSpec{{ID: ClockRealtime}},
+			},
+		},
+		{
+			name: "FreezeBeforeEvaluated",
+			spec: ClusterTimeLeapSpec{
+				PodSelector: podSelector,
+				Mode:        FreezeMode,
+				Offset:      "+24h",
+				Clocks:      []ClockSpec{{ID: ClockMonotonic}},
+			},
+			want: TimeLeapSpec{
+				Selector: podSelector,
+				Mode:     FreezeMode,
+				Offset:   "+24h",
+				Clocks:   []ClockSpec{{ID: ClockMonotonic}},
+			},
+		},
+		{
+			name: "FreezeAtInstant",
+			spec: ClusterTimeLeapSpec{
+				PodSelector: podSelector,
+				Mode:        FreezeMode,
+				Offset:      "+24h",
+			},
+			frozenAt: &frozenAt,
+			want: TimeLeapSpec{
+				Selector: podSelector,
+				Mode:     FreezeMode,
+				Time:     &frozenAt,
+				Clocks:   []ClockSpec{{ID: ClockRealtime}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if diff := cmp.Diff(tt.want, tt.spec.TimeLeapSpec(tt.frozenAt, nil)); diff != "" {
+				t.Fatalf("(-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func validClusterSpec() ClusterTimeLeapSpec {
+	return ClusterTimeLeapSpec{
+		NamespaceSelector: metav1.LabelSelector{MatchLabels: map[string]string{"leap": "true"}},
+		PodSelector:       metav1.LabelSelector{MatchLabels: map[string]string{"app": "sample"}},
+		Offset:            "+72h",
+	}
+}
+
+func TestValidateClusterSpec(t *testing.T) {
+	now := time.Date(2020, time.October, 1, 0, 0, 0, 0, time.UTC)
+	near := metav1.NewTime(now.Add(Week))
+
+	tests := []struct {
+		name   string
+		mutate func(*ClusterTimeLeapSpec)
+		want   []string // field paths of the errors
+	}{
+		{
+			name:   "Valid",
+			mutate: func(*ClusterTimeLeapSpec) {},
+		},
+		{
+			name:   "EmptyNamespaceSelector",
+			mutate: func(s *ClusterTimeLeapSpec) { s.NamespaceSelector = metav1.LabelSelector{} },
+			want:   []string{"spec.namespaceSelector"},
+		},
+		{
+			name:   "EmptyPodSelector",
+			mutate: func(s *ClusterTimeLeapSpec) { s.PodSelector = metav1.LabelSelector{} },
+			want:   []string{"spec.podSelector"},
+		},
+		{
+			name:   "OffsetAndTime",
+			mutate: func(s *ClusterTimeLeapSpec) { s.Time = &near },
+			want:   []string{"spec.time"},
+		},
+		{
+			name:   "InvalidRate",
+			mutate: func(s *ClusterTimeLeapSpec) { s.Rate = "0" },
+			want:   []string{"spec.rate"},
+		},
+		{
+			name: "InvalidSlew",
+			mutate: func(s *ClusterTimeLeapSpec) {
+				s.Mode = SlewMode
+				s.Slew = &SlewSpec{Period: &metav1.Duration{}, MaxRate: "1"}
+			},
+			want: []string{"spec.slew.period", "spec.slew.maxRate"},
+		},
+		{
+			name:   "NonPositiveTTL",
+			mutate: func(s *ClusterTimeLeapSpec) { s.TTL = &metav1.Duration{} },
+			want:   []string{"spec.ttl"},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			spec := validClusterSpec()
+			tt.mutate(&spec)
+
+			if diff := cmp.Diff(tt.want, errorFields(validateClusterSpec(&spec, field.NewPath("spec"), now))); diff != "" {
+				t.Fatalf("(-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestClusterTimeLeap_ValidateUpdate(t *testing.T) {
+	now := time.Date(2020, time.October, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		mutate func(*ClusterTimeLeap)
+		want   []string // field paths of the errors
+	}{
+		{
+			name:   "Offset",
+			mutate: func(ctl *ClusterTimeLeap) { ctl.Spec.Offset = "+48h" },
+		},
+		{
+			name:   "DefaultMode",
+			mutate: func(ctl *ClusterTimeLeap) { ctl.Spec.Mode = OffsetMode },
+		},
+		{
+			name:   "Mode",
+			mutate: func(ctl *ClusterTimeLeap) { ctl.Spec.Mode = FreezeMode },
+			want:   []string{"spec.mode"},
+		},
+		{
+			name:   "Invalid",
+			mutate: func(ctl *ClusterTimeLeap) { ctl.Spec.Rate = "-1" },
+			want:   []string{"spec.rate"},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			old := &ClusterTimeLeap{ObjectMeta: metav1.ObjectMeta{Name: "leap"}, Spec: validClusterSpec()}
+			ctl := old.DeepCopy()
+			tt.mutate(ctl)
+
+			if diff := cmp.Diff(tt.want, errorFields(ctl.validateUpdate(old, now))); diff != "" {
+				t.Fatalf("(-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright 2020 The kube-timeleap Authors.
+// SPDX-License-Identifier: BSD-3-Clause
+
+package v1alpha1
+
+import (
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1validation "k8s.io/apimachinery/pkg/apis/meta/v1/validation"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+// log is for logging in this package.
+var clustertimeleaplog = logf.Log.WithName("clustertimeleap-resource")
+
+// SetupWebhookWithManager setup ClusterTimeLeap webhook with manager.
+func (r *ClusterTimeLeap) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		Complete()
+}
+
+// +kubebuilder:webhook:webhookVersions=v1,verbs=create;update,path=/validate-timeleap-x-k8s-io-v1alpha1-clustertimeleap,mutating=false,failurePolicy=fail,matchPolicy=Equivalent,groups=timeleap.x-k8s.io,resources=clustertimeleaps,versions=v1alpha1,name=vclustertimeleap.kb.io,sideEffects=None
+
+// compile time check whether the ClusterTimeLeap implements webhook.Validator interface.
+var _ webhook.Validator = (*ClusterTimeLeap)(nil)
+
+// ValidateCreate implements webhook.Validator.
+//
+// ValidateCreate is a webhook will be registered for the type.
+func (r *ClusterTimeLeap) ValidateCreate() error {
+	clustertimeleaplog.Info("validate create", "name", r.Name)
+
+	return r.invalid(validateClusterSpec(&r.Spec, field.NewPath("spec"), time.Now()))
+}
+
+// ValidateUpdate implements webhook.Validator.
+//
+// ValidateUpdate is a webhook will be registered for the type.
+//
+// The mode cannot be switched, since the TimeLeaps in the selected namespaces could not follow it.
+func (r *ClusterTimeLeap) ValidateUpdate(old runtime.Object) error {
+	clustertimeleaplog.Info("validate update", "name", r.Name)
+
+	oldCTL, ok := old.(*ClusterTimeLeap)
+	if !ok {
+		return fmt.Errorf("expected a ClusterTimeLeap but got a %T", old)
+	}
+
+	return r.invalid(r.validateUpdate(oldCTL, time.Now()))
+}
+
+// ValidateDelete implements webhook.Validator.
+//
+// ValidateDelete is a webhook will be registered for the type.
+func (r *ClusterTimeLeap) ValidateDelete() error {
+	clustertimeleaplog.Info("validate delete", "name", r.Name)
+
+	return nil
+}
+
+// validateUpdate validates the update of r from old, with the real time now.
+func (r *ClusterTimeLeap) validateUpdate(old *ClusterTimeLeap, now time.Time) field.ErrorList {
+	if equality.Semantic.DeepEqual(&r.Spec, &old.Spec) {
+		// metadata only update
+		return nil
+	}
+
+	path := field.NewPath("spec")
+	var allErrs field.ErrorList
+	if mode, oldMode := modeOf(&TimeLeapSpec{Mode: r.Spec.Mode}), modeOf(&TimeLeapSpec{Mode: old.Spec.Mode}); mode != oldMode {
+		allErrs = append(allErrs, field.Forbidden(path.Child("mode"), fmt.Sprintf("cannot switch the mode of a running ClusterTimeLeap from %s to %s, create a new ClusterTimeLeap instead", oldMode, mode)))
+	}
+
+	return append(allErrs, validateClusterSpec(&r.Spec, path, now)...)
+}
+
+// invalid returns the aggregated Invalid error of allErrs, or nil if allErrs is empty.
+func (r *ClusterTimeLeap) invalid(allErrs field.ErrorList) error {
+	if len(allErrs) == 0 {
+		return nil
+	}
+
+	return apierrors.NewInvalid(GroupVersion.WithKind("ClusterTimeLeap").GroupKind(), r.Name, allErrs)
+}
+
+// validateClusterSpec validates the cluster spec at path, with the real time now.
+//
+// The spec is held to the same rules as the TimeLeaps it creates, which would be rejected otherwise.
+func validateClusterSpec(spec *ClusterTimeLeapSpec, path *field.Path, now time.Time) field.ErrorList {
+	var allErrs field.ErrorList
+
+	nsSelector := &spec.NamespaceSelector
+	if len(nsSelector.MatchLabels)+len(nsSelector.MatchExpressions) == 0 {
+		allErrs = append(allErrs, field.Required(path.Child("namespaceSelector"), "an empty selector would select every namespace"))
+	} else {
+		allErrs = append(allErrs, metav1validation.ValidateLabelSelector(nsSelector, path.Child("namespaceSelector"))...)
+	}
+	allErrs = append(allErrs, validateSelector(&spec.PodSelector, path.Child("podSelector"))...)
+	allErrs = append(allErrs, validateMode(spec.Mode, path.Child("mode"))...)
+	allErrs = append(allErrs, validateTarget(spec.Offset, spec.Time, path, now)...)
+	allErrs = append(allErrs, validateRate(spec.Rate, path.Child("rate"))...)
+	allErrs = append(allErrs, validateClocks(spec.Clocks, path.Child("clocks"))...)
+	allErrs = append(allErrs, validateSlew(spec.Mode, spec.Slew, spec.Rate, path.Child("slew"))...)
+	allErrs = append(allErrs, validateSkew(spec.Skew, path.Child("skew"))...)
+
+	if spec.TTL != nil && spec.TTL.Duration <= 0 {
+		allErrs = append(allErrs, field.Invalid(path.Child("ttl"), spec.TTL.Duration.String(), "must be positive"))
+	}
+
+	return allErrs
+}
@@ -0,0 +1,113 @@
+// Copyright 2020 The kube-timeleap Authors.
+// SPDX-License-Identifier: BSD-3-Clause
+
+package v1alpha1
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+)
+
+const (
+	// Day is the duration of the "d" offset unit.
+	Day = 24 * time.Hour
+
+	// Week is the duration of the "w" offset unit.
+	Week = 7 * Day
+)
+
+// offsetUnits maps the offset units which time.ParseDuration does not understand to its duration.
+var offsetUnits = map[byte]time.Duration{
+	'd': Day,
+	'w': Week,
+}
+
+// ParseOffset parses a signed offset string such as "+72h", "-1d12h" or "2w".
+//
+// ParseOffset accepts the same units as time.ParseDuration plus "d" and "w".
+func ParseOffset(s string) (time.Duration, error) {
+	orig := s
+	if s == "" {
+		return 0, errors.New("empty offset")
+	}
+
+	neg := false
+	switch s[0] {
+	case '-':
+		neg = true
+		s = s[1:]
+	case '+':
+		s = s[1:]
+	}
+	if s == "" {
+		return 0, fmt.Errorf("invalid offset %q", orig)
+	}
+
+	var d time.Duration
+	for s != "" {
+		// number part
+		i := 0
+		for i < len(s) && (s[i] == '.' || '0' <= s[i] && s[i] <= '9') {
+			i++
+		}
+		if i == 0 {
+			return 0, fmt.Errorf("invalid offset %q", orig)
+		}
+		num := s[:i]
+		s = s[i:]
+
+		// unit part
+		j := 0
+		for j < len(s) && s[j] != '.' && (s[j] < '0' || s[j] > '9') {
+			j++
+		}
+		if j == 0 {
+			return 0, fmt.Errorf("missing unit in offset %q", orig)
+		}
+		unit := s[:j]
+		s = s[j:]
+
+		var part time.Duration
+		if u, ok := offsetUnits[unit[0]]; ok && len(unit) == 1 {
+			f, err := strconv.ParseFloat(num, 64)
+			if err != nil {
+				return 0, fmt.Errorf("invalid offset %q: %w", orig, err)
+			}
+			v := f * float64(u)
+			// float64(math.MaxInt64) rounds up to 1<<63, which does not fit in a time.Duration.
+			if v >= math.MaxInt64 {
+				return 0, fmt.Errorf("invalid offset %q: overflow", orig)
+			}
+			part = time.Duration(v)
+		} else {
+			var err error
+			part, err = time.ParseDuration(num + unit)
+			if err != nil {
+				return 0, fmt.Errorf("invalid offset %q: %w", orig, err)
+			}
+		}
+
+		if d > math.MaxInt64-part {
+			return 0, fmt.Errorf("invalid offset %q: overflow", orig)
+		}
+		d += part
+	}
+
+	if neg {
+		d = -d
+	}
+
+	return d, nil
+}
+
+// FormatOffset formats d as a signed offset string which ParseOffset can parse.
+func FormatOffset(d time.Duration) string {
+	if d < 0 {
+		return d.String()
+	}
+
+	return "+" + d.String()
+}
@@ -0,0 +1,105 @@
+// Copyright 2020 The kube-timeleap Authors.
+// SPDX-License-Identifier: BSD-3-Clause
+
+package v1alpha1
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseOffset(t *testing.T) {
+	tests := []struct {
+		name    string
+		s       string
+		want    time.Duration
+		wantErr bool
+	}{
+		{
+			name: "Hours",
+			s:    "+72h",
+			want: 72 * time.Hour,
+		},
+		{
+			name: "NoSign",
+			s:    "30m",
+			want: 30 * time.Minute,
+		},
+		{
+			name: "Negative",
+			s:    "-1h30m",
+			want: -(time.Hour + 30*time.Minute),
+		},
+		{
+			name: "Days",
+			s:    "+30d",
+			want: 30 * Day,
+		},
+		{
+			name: "MixedUnits",
+			s:    "1w2d3h",
+			want: Week + 2*Day + 3*time.Hour,
+		},
+		{
+			name: "FractionalDay",
+			s:    "1.5d",
+			want: 36 * time.Hour,
+		},
+		{
+			name:    "Empty",
+			s:       "",
+			wantErr: true,
+		},
+		{
+			name:    "SignOnly",
+			s:       "+",
+			wantErr: true,
+		},
+		{
+			name:    "MissingUnit",
+			s:       "+72",
+			wantErr: true,
+		},
+		{
+			name:    "UnknownUnit",
+			s:       "3y",
+			wantErr: true,
+		},
+		{
+			name:    "Overflow",
+			s:       "1000000w",
+			wantErr: true,
+		},
+		{
+			name:    "OverflowBoundary",
+			s:       "106751.99116730064d", // exactly 1<<63 nanoseconds
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := ParseOffset(tt.s)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseOffset(%q) error = %v, wantErr %v", tt.s, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Fatalf("ParseOffset(%q) = %v, want %v", tt.s, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatOffset(t *testing.T) {
+	for _, d := range []time.Duration{0, 72 * time.Hour, -90 * time.Minute} {
+		got, err := ParseOffset(FormatOffset(d))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != d {
+			t.Fatalf("ParseOffset(FormatOffset(%v)) = %v", d, got)
+		}
+	}
+}
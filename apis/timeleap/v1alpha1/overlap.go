@@ -0,0 +1,75 @@
+// Copyright 2020 The kube-timeleap Authors.
+// SPDX-License-Identifier: BSD-3-Clause
+
+package v1alpha1
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// Overlap is a TimeLeap which selects some pods also selected by another TimeLeap.
+// +kubebuilder:object:generate=false
+type Overlap struct {
+	// TimeLeap is the name of the overlapping TimeLeap.
+	TimeLeap string
+
+	// Pods is the names of the pods selected by both TimeLeaps in ascending order.
+	Pods []string
+}
+
+// maxOverlapPods is the maximum number of the pods listed in the message of an Overlap.
+const maxOverlapPods = 3
+
+// String implements fmt.Stringer.
+func (o Overlap) String() string {
+	pods := o.Pods
+	more := ""
+	if len(pods) > maxOverlapPods {
+		more = fmt.Sprintf(" and %d more", len(pods)-maxOverlapPods)
+		pods = pods[:maxOverlapPods]
+	}
+
+	return fmt.Sprintf("TimeLeap %q on pods %s%s", o.TimeLeap, strings.Join(pods, ", "), more)
+}
+
+// FindOverlaps returns the TimeLeaps in others which select any of pods selected by tl, in ascending order
+// of the name.
+//
+// The pods are the targets of tl, FindOverlaps does not match them against the selector of tl. tl itself,
+// the TimeLeaps in the other namespaces, being deleted or expired in others are ignored.
+func FindOverlaps(tl *TimeLeap, others []TimeLeap, pods []corev1.Pod) []Overlap {
+	var overlaps []Overlap
+	for i := range others {
+		other := &others[i]
+		if other.Name == tl.Name || other.Namespace != tl.Namespace || other.DeletionTimestamp != nil ||
+			meta.IsStatusConditionTrue(other.Status.Conditions, ConditionExpired) {
+			continue
+		}
+
+		selector, err := metav1.LabelSelectorAsSelector(&other.Spec.Selector)
+		if err != nil || selector.Empty() {
+			continue
+		}
+
+		o := Overlap{TimeLeap: other.Name}
+		for _, pod := range pods {
+			if selector.Matches(labels.Set(pod.Labels)) {
+				o.Pods = append(o.Pods, pod.Name)
+			}
+		}
+		if len(o.Pods) > 0 {
+			sort.Strings(o.Pods)
+			overlaps = append(overlaps, o)
+		}
+	}
+	sort.Slice(overlaps, func(i, j int) bool { return overlaps[i].TimeLeap < overlaps[j].TimeLeap })
+
+	return overlaps
+}
@@ -0,0 +1,72 @@
+// Copyright 2020 The kube-timeleap Authors.
+// SPDX-License-Identifier: BSD-3-Clause
+
+package v1alpha1
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func selecting(name string, matchLabels map[string]string) TimeLeap {
+	return TimeLeap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name},
+		Spec: TimeLeapSpec{
+			Selector: metav1.LabelSelector{MatchLabels: matchLabels},
+		},
+	}
+}
+
+func labeledPod(name string, labels map[string]string) corev1.Pod {
+	return corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name, Labels: labels}}
+}
+
+func TestFindOverlaps(t *testing.T) {
+	tl := selecting("leap", map[string]string{"app": "sample"})
+	pods := []corev1.Pod{
+		labeledPod("sample-1", map[string]string{"app": "sample", "tier": "web"}),
+		labeledPod("sample-0", map[string]string{"app": "sample", "tier": "web"}),
+		labeledPod("sample-2", map[string]string{"app": "sample", "tier": "db"}),
+	}
+
+	deleted := selecting("deleted", map[string]string{"app": "sample"})
+	now := metav1.Now()
+	deleted.DeletionTimestamp = &now
+
+	expired := selecting("expired", map[string]string{"app": "sample"})
+	expired.Status.Conditions = []metav1.Condition{{Type: ConditionExpired, Status: metav1.ConditionTrue}}
+
+	other := selecting("other-namespace", map[string]string{"app": "sample"})
+	other.Namespace = "other"
+
+	others := []TimeLeap{
+		tl,
+		selecting("web", map[string]string{"tier": "web"}),
+		selecting("db", map[string]string{"tier": "db"}),
+		selecting("cache", map[string]string{"tier": "cache"}),
+		selecting("empty", nil),
+		deleted,
+		expired,
+		other,
+	}
+
+	want := []Overlap{
+		{TimeLeap: "db", Pods: []string{"sample-2"}},
+		{TimeLeap: "web", Pods: []string{"sample-0", "sample-1"}},
+	}
+	if diff := cmp.Diff(want, FindOverlaps(&tl, others, pods)); diff != "" {
+		t.Fatalf("(-want +got):\n%s", diff)
+	}
+}
+
+func TestOverlap_String(t *testing.T) {
+	o := Overlap{TimeLeap: "web", Pods: []string{"a", "b", "c", "d", "e"}}
+
+	want := `TimeLeap "web" on pods a, b, c and 2 more`
+	if got := o.String(); got != want {
+		t.Fatalf("String() = %q, want %q", got, want)
+	}
+}
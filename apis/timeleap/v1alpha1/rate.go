@@ -0,0 +1,29 @@
+// Copyright 2020 The kube-timeleap Authors.
+// SPDX-License-Identifier: BSD-3-Clause
+
+package v1alpha1
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// ParseRate parses a clock rate string such as "60" or "0.5".
+//
+// An empty string is the real-time rate 1.
+func ParseRate(s string) (float64, error) {
+	if s == "" {
+		return 1, nil
+	}
+
+	r, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid rate %q: %w", s, err)
+	}
+	if math.IsNaN(r) || math.IsInf(r, 0) || r <= 0 {
+		return 0, fmt.Errorf("invalid rate %q: must be a finite positive number", s)
+	}
+
+	return r, nil
+}
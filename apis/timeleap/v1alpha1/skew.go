@@ -0,0 +1,61 @@
+// Copyright 2020 The kube-timeleap Authors.
+// SPDX-License-Identifier: BSD-3-Clause
+
+package v1alpha1
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"time"
+)
+
+// SkewSpec assigns each selected pod a pseudo-random offset within a range, on top of the offset of the
+// TimeLeap.
+//
+// The offset of a pod is derived from Seed and the pod name only, so the same seed reproduces the same skew
+// on the pods with stable names, e.g. the pods of a StatefulSet, and a pod keeps its skew while the other
+// pods come and go.
+type SkewSpec struct {
+	// Min is the lower bound of the offset added to each pod, in the same format as TimeLeapSpec.Offset.
+	// +kubebuilder:validation:Pattern=`^[+-]?([0-9]+(\.[0-9]+)?(ns|us|µs|ms|s|m|h|d|w))+$`
+	Min string `json:"min"`
+
+	// Max is the upper bound of the offset added to each pod, in the same format as TimeLeapSpec.Offset.
+	// +kubebuilder:validation:Pattern=`^[+-]?([0-9]+(\.[0-9]+)?(ns|us|µs|ms|s|m|h|d|w))+$`
+	Max string `json:"max"`
+
+	// Seed is the seed of the pseudo-random offsets. Changing Seed reassigns the offset of every pod.
+	// +optional
+	Seed int64 `json:"seed,omitempty"`
+}
+
+// For returns the offset of the pod named podName within [Min, Max].
+func (s *SkewSpec) For(podName string) (time.Duration, error) {
+	lower, err := ParseOffset(s.Min)
+	if err != nil {
+		return 0, err
+	}
+	upper, err := ParseOffset(s.Max)
+	if err != nil {
+		return 0, err
+	}
+
+	h := fnv.New64a()
+	var seed [8]byte
+	binary.LittleEndian.PutUint64(seed[:], uint64(s.Seed))
+	_, _ = h.Write(seed[:])
+	_, _ = h.Write([]byte(podName))
+
+	// the 53 bits of mix(h) are uniform in [0, 1) as float64
+	u := float64(mix(h.Sum64())>>11) / (1 << 53)
+
+	return lower + time.Duration(u*float64(upper-lower)), nil
+}
+
+// mix is the finalizer of SplitMix64, which spreads the bits of the FNV hash of similar pod names.
+func mix(z uint64) uint64 {
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+
+	return z ^ (z >> 31)
+}
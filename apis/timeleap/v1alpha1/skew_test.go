@@ -0,0 +1,58 @@
+// Copyright 2020 The kube-timeleap Authors.
+// SPDX-License-Identifier: BSD-3-Clause
+
+package v1alpha1
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestSkewSpec_For(t *testing.T) {
+	t.Parallel()
+
+	skew := &SkewSpec{Min: "-500ms", Max: "+2s", Seed: 42}
+
+	var below, above int
+	seen := make(map[time.Duration]bool)
+	for i := 0; i < 1000; i++ {
+		name := fmt.Sprintf("etcd-%d", i)
+		got, err := skew.For(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got < -500*time.Millisecond || got > 2*time.Second {
+			t.Fatalf("For(%q) = %v, out of [-500ms, +2s]", name, got)
+		}
+		if again, _ := skew.For(name); again != got {
+			t.Fatalf("For(%q) is not reproducible: %v, then %v", name, got, again)
+		}
+		if got < 750*time.Millisecond {
+			below++
+		} else {
+			above++
+		}
+		seen[got] = true
+	}
+	// the midpoint splits 1000 uniform samples evenly, give or take
+	if below < 400 || above < 400 {
+		t.Fatalf("skew is not spread over the range: %d below and %d above the midpoint", below, above)
+	}
+	if len(seen) < 990 {
+		t.Fatalf("only %d distinct skews of 1000 pods", len(seen))
+	}
+
+	reseeded := *skew
+	reseeded.Seed = 43
+	a, _ := skew.For("etcd-0")
+	b, _ := reseeded.For("etcd-0")
+	if a == b {
+		t.Fatalf("changing the seed kept the skew %v", a)
+	}
+
+	fixed := &SkewSpec{Min: "+1s", Max: "+1s"}
+	if got, _ := fixed.For("etcd-0"); got != time.Second {
+		t.Fatalf("For() = %v, want the only offset in the range 1s", got)
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright 2020 The kube-timeleap Authors.
+// SPDX-License-Identifier: BSD-3-Clause
+
+package v1alpha1
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// mutatePath is the path of the mutating webhook of TimeLeap, same as the path the webhook builder generates.
+const mutatePath = "/mutate-timeleap-x-k8s-io-v1alpha1-timeleap"
+
+// defaulter is the mutating admission handler of TimeLeap.
+//
+// defaulter applies Default, and the defaults which depend on the manager config or the admission request
+// which a webhook.Defaulter cannot see.
+type defaulter struct {
+	// defaultTTL is the TTL of the TimeLeaps created without one. Zero disables the default.
+	defaultTTL time.Duration
+
+	decoder *admission.Decoder
+}
+
+// compile time check whether the defaulter implements admission.DecoderInjector and admission.Handler interfaces.
+var (
+	_ admission.DecoderInjector = (*defaulter)(nil)
+	_ admission.Handler         = (*defaulter)(nil)
+)
+
+// InjectDecoder implements admission.DecoderInjector.
+func (d *defaulter) InjectDecoder(decoder *admission.Decoder) error {
+	d.decoder = decoder
+	return nil
+}
+
+// Handle implements admission.Handler.
+func (d *defaulter) Handle(ctx context.Context, req admission.Request) admission.Response {
+	tl := &TimeLeap{}
+	if err := d.decoder.Decode(req, tl); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	tl.Default()
+
+	switch req.Operation {
+	case admissionv1beta1.Create:
+		tl.SetDefaultTTL(d.defaultTTL)
+		setAnnotation(tl, CreatedByAnnotation, req.UserInfo.Username)
+
+	case admissionv1beta1.Update:
+		old := &TimeLeap{}
+		if err := d.decoder.DecodeRaw(req.OldObject, old); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		// the annotation is for auditing, so it's never overwritten by the later updates
+		setAnnotation(tl, CreatedByAnnotation, old.Annotations[CreatedByAnnotation])
+	}
+
+	marshaled, err := json.Marshal(tl)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+
+	return admission.PatchResponseFromRaw(req.Object.Raw, marshaled)
+}
+
+// SetDefaultTTL sets the TTL of r to ttl if r has none, as the mutating webhook does on creation. Zero ttl
+// disables the default.
+//
+// The TimeLeaps controlled by another object, e.g. a ClusterTimeLeap or a TimeLeapSchedule, are left without
+// a TTL, since they live as long as their owner which expires them by itself. So are the TimeLeaps created by
+// the pod injector, which the pods created later with the same annotations are bound to.
+func (r *TimeLeap) SetDefaultTTL(ttl time.Duration) {
+	if r.Spec.TTL != nil || ttl <= 0 || metav1.GetControllerOf(r) != nil || r.Labels[ManagedByLabel] == ManagedByInjector {
+		return
+	}
+
+	r.Spec.TTL = &metav1.Duration{Duration: ttl}
+}
+
+// setAnnotation sets the annotation key of tl to value, or removes it if value is empty.
+func setAnnotation(tl *TimeLeap, key, value string) {
+	if value == "" {
+		delete(tl.Annotations, key)
+		return
+	}
+
+	if tl.Annotations == nil {
+		tl.Annotations = make(map[string]string)
+	}
+	tl.Annotations[key] = value
+}
@@ -0,0 +1,179 @@
+// Copyright 2020 The kube-timeleap Authors.
+// SPDX-License-Identifier: BSD-3-Clause
+
+package v1alpha1
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	evanjsonpatch "github.com/evanphx/json-patch"
+	"github.com/google/go-cmp/cmp"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+func TestTimeLeap_Default(t *testing.T) {
+	at := metav1.NewTime(time.Date(2030, time.January, 1, 9, 0, 0, 500, time.FixedZone("JST", 9*60*60)))
+	tl := &TimeLeap{Spec: TimeLeapSpec{Time: &at}}
+	tl.Default()
+
+	want := TimeLeapSpec{
+		Mode:   OffsetMode,
+		Time:   &metav1.Time{Time: time.Date(2030, time.January, 1, 0, 0, 0, 0, time.UTC)},
+		Clocks: []ClockSpec{{ID: ClockRealtime}},
+	}
+	if diff := cmp.Diff(want, tl.Spec); diff != "" {
+		t.Fatalf("(-want +got):\n%s", diff)
+	}
+	if loc := tl.Spec.Time.Location(); loc != time.UTC {
+		t.Fatalf("Time location = %v, want UTC", loc)
+	}
+}
+
+func newTestDefaulter(t *testing.T, ttl time.Duration) *defaulter {
+	t.Helper()
+
+	decoder, err := admission.NewDecoder(newFakeClient(t).Scheme())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := &defaulter{defaultTTL: ttl}
+	if err := d.InjectDecoder(decoder); err != nil {
+		t.Fatal(err)
+	}
+
+	return d
+}
+
+func rawTimeLeap(t *testing.T, tl *TimeLeap) []byte {
+	t.Helper()
+
+	raw, err := json.Marshal(tl)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return raw
+}
+
+// handle handles req by d and returns the patched TimeLeap.
+func handle(t *testing.T, d *defaulter, req admission.Request) *TimeLeap {
+	t.Helper()
+
+	resp := d.Handle(context.Background(), req)
+	if !resp.Allowed {
+		t.Fatalf("Handle() denied: %v", resp.Result)
+	}
+
+	ops, err := json.Marshal(resp.Patches)
+	if err != nil {
+		t.Fatal(err)
+	}
+	patch, err := evanjsonpatch.DecodePatch(ops)
+	if err != nil {
+		t.Fatal(err)
+	}
+	patched, err := patch.Apply(req.Object.Raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tl := &TimeLeap{}
+	if err := json.Unmarshal(patched, tl); err != nil {
+		t.Fatal(err)
+	}
+
+	return tl
+}
+
+func TestDefaulter_Handle(t *testing.T) {
+	d := newTestDefaulter(t, 24*time.Hour)
+	user := authenticationv1.UserInfo{Username: "alice@example.com"}
+
+	created := handle(t, d, admission.Request{AdmissionRequest: admissionv1beta1.AdmissionRequest{
+		Operation: admissionv1beta1.Create,
+		UserInfo:  user,
+		Object:    runtime.RawExtension{Raw: rawTimeLeap(t, &TimeLeap{Spec: validSpec()})},
+	}})
+	if got := created.Annotations[CreatedByAnnotation]; got != user.Username {
+		t.Fatalf("created-by = %q, want %q", got, user.Username)
+	}
+	if ttl := created.Spec.TTL; ttl == nil || ttl.Duration != 24*time.Hour {
+		t.Fatalf("TTL = %v, want 24h", ttl)
+	}
+	if created.Spec.Mode != OffsetMode || len(created.Spec.Clocks) != 1 {
+		t.Fatalf("Default() is not applied: %+v", created.Spec)
+	}
+
+	// the later updates by the other users, or tampering the annotation, do not overwrite the creator
+	tampered := created.DeepCopy()
+	tampered.Annotations[CreatedByAnnotation] = "mallory"
+	tampered.Spec.TTL = nil
+	updated := handle(t, d, admission.Request{AdmissionRequest: admissionv1beta1.AdmissionRequest{
+		Operation: admissionv1beta1.Update,
+		UserInfo:  authenticationv1.UserInfo{Username: "bob@example.com"},
+		Object:    runtime.RawExtension{Raw: rawTimeLeap(t, tampered)},
+		OldObject: runtime.RawExtension{Raw: rawTimeLeap(t, created)},
+	}})
+	if got := updated.Annotations[CreatedByAnnotation]; got != user.Username {
+		t.Fatalf("created-by = %q after update, want %q", got, user.Username)
+	}
+	if updated.Spec.TTL != nil {
+		t.Fatalf("TTL = %v after removed on update, want nil", updated.Spec.TTL)
+	}
+}
+
+func TestDefaulter_Handle_NoDefaultTTL(t *testing.T) {
+	d := newTestDefaulter(t, 0)
+
+	created := handle(t, d, admission.Request{AdmissionRequest: admissionv1beta1.AdmissionRequest{
+		Operation: admissionv1beta1.Create,
+		Object:    runtime.RawExtension{Raw: rawTimeLeap(t, &TimeLeap{Spec: validSpec()})},
+	}})
+	if created.Spec.TTL != nil {
+		t.Fatalf("TTL = %v, want nil", created.Spec.TTL)
+	}
+}
+
+func TestDefaulter_Handle_Owned(t *testing.T) {
+	d := newTestDefaulter(t, 24*time.Hour)
+
+	owned := &TimeLeap{
+		ObjectMeta: metav1.ObjectMeta{
+			OwnerReferences: []metav1.OwnerReference{
+				*metav1.NewControllerRef(&TimeLeapSchedule{ObjectMeta: metav1.ObjectMeta{Name: "month-end", UID: "uid"}}, GroupVersion.WithKind("TimeLeapSchedule")),
+			},
+		},
+		Spec: validSpec(),
+	}
+	created := handle(t, d, admission.Request{AdmissionRequest: admissionv1beta1.AdmissionRequest{
+		Operation: admissionv1beta1.Create,
+		Object:    runtime.RawExtension{Raw: rawTimeLeap(t, owned)},
+	}})
+	if created.Spec.TTL != nil {
+		t.Fatalf("TTL = %v, want nil for the TimeLeap expired by its owner", created.Spec.TTL)
+	}
+}
+
+func TestDefaulter_Handle_Injected(t *testing.T) {
+	d := newTestDefaulter(t, 24*time.Hour)
+
+	injected := &TimeLeap{
+		ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{ManagedByLabel: ManagedByInjector}},
+		Spec:       validSpec(),
+	}
+	created := handle(t, d, admission.Request{AdmissionRequest: admissionv1beta1.AdmissionRequest{
+		Operation: admissionv1beta1.Create,
+		Object:    runtime.RawExtension{Raw: rawTimeLeap(t, injected)},
+	}})
+	if created.Spec.TTL != nil {
+		t.Fatalf("TTL = %v, want nil for the TimeLeap shared by the pods created later", created.Spec.TTL)
+	}
+}
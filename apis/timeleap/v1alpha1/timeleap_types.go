@@ -4,6 +4,9 @@
 package v1alpha1
 
 import (
+	"math"
+	"time"
+
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -11,17 +14,364 @@ func init() {
 	SchemeBuilder.Register(&TimeLeap{}, &TimeLeapList{})
 }
 
+// TimeLeapMode is the mode of the virtual clock.
+// +kubebuilder:validation:Enum=Offset;Freeze;Slew
+type TimeLeapMode string
+
+const (
+	// OffsetMode shifts the clock by the offset and keeps it running.
+	OffsetMode TimeLeapMode = "Offset"
+
+	// FreezeMode pins the clock at a single instant until the spec is updated.
+	FreezeMode TimeLeapMode = "Freeze"
+
+	// SlewMode converges the clock to the offset gradually and keeps it running, never jumping it.
+	SlewMode TimeLeapMode = "Slew"
+)
+
+// List of the defaults of SlewSpec.
+const (
+	// DefaultSlewPeriod is the default real duration the clock converges to the target over.
+	DefaultSlewPeriod = time.Hour
+
+	// DefaultSlewMaxRate is the default bound of the correction applied every real second.
+	DefaultSlewMaxRate = 0.5
+)
+
+// SlewSpec configures how the clock converges to the target in the "Slew" mode.
+type SlewSpec struct {
+	// Period is the real duration the clock converges to the target over. Defaults to 1h.
+	//
+	// The clock converges slower if that would exceed MaxRate.
+	// +optional
+	Period *metav1.Duration `json:"period,omitempty"`
+
+	// MaxRate bounds the correction applied every real second, in real seconds, e.g. "0.5" makes the
+	// clock at the real-time rate run between half and one and a half as fast as the real clock while
+	// converging. Defaults to "0.5", or half the Rate if that is below 1.
+	//
+	// The clock runs at Rate minus MaxRate while slowing down, so MaxRate must be below the Rate for the
+	// clock never to go backwards.
+	// +kubebuilder:validation:Pattern=`^([0-9]+(\.[0-9]*)?|\.[0-9]+)$`
+	// +optional
+	MaxRate string `json:"maxRate,omitempty"`
+}
+
+// ClockID is the name of a kernel clock, as the clockid_t constant of clock_gettime(2).
+// +kubebuilder:validation:Enum=CLOCK_REALTIME;CLOCK_MONOTONIC;CLOCK_BOOTTIME
+type ClockID string
+
+const (
+	// ClockRealtime is the wall clock, read by gettimeofday(2) and time(2) too.
+	ClockRealtime ClockID = "CLOCK_REALTIME"
+
+	// ClockMonotonic is the monotonic clock which does not count the suspended time.
+	ClockMonotonic ClockID = "CLOCK_MONOTONIC"
+
+	// ClockBoottime is the monotonic clock which counts the suspended time.
+	ClockBoottime ClockID = "CLOCK_BOOTTIME"
+)
+
+// ClockSpec selects a kernel clock affected by the TimeLeap.
+type ClockSpec struct {
+	// ID is the kernel clock. Its coarse and raw variants follow the same virtual clock.
+	ID ClockID `json:"id"`
+
+	// Offset overrides the offset of the TimeLeap for this clock, in the same format as TimeLeapSpec.Offset.
+	// +kubebuilder:validation:Pattern=`^[+-]?([0-9]+(\.[0-9]+)?(ns|us|µs|ms|s|m|h|d|w))+$`
+	// +optional
+	Offset string `json:"offset,omitempty"`
+}
+
 // TimeLeapSpec defines the desired state of TimeLeap.
+//
+// Exactly one of Offset or Time must be set.
 type TimeLeapSpec struct {
-	// Foo is an example field of TimeLeap. Edit TimeLeap_types.go to remove/update
-	Foo string `json:"foo,omitempty"`
+	// Selector is a label query over pods in the TimeLeap namespace that should see the virtual time.
+	Selector metav1.LabelSelector `json:"selector"`
+
+	// Mode is the mode of the virtual clock. Defaults to "Offset".
+	//
+	// In the "Freeze" mode every time read returns the instant selected by Offset or Time, evaluated
+	// when the spec is observed, until the spec is updated. Rate is ignored while frozen.
+	// +optional
+	Mode TimeLeapMode `json:"mode,omitempty"`
+
+	// Offset is the relative offset added to the real time, e.g. "+72h" or "-30m".
+	//
+	// In addition to the units accepted by time.ParseDuration, "d" (24h) and "w" (7d) are accepted.
+	// +kubebuilder:validation:Pattern=`^[+-]?([0-9]+(\.[0-9]+)?(ns|us|µs|ms|s|m|h|d|w))+$`
+	// +optional
+	Offset string `json:"offset,omitempty"`
+
+	// Time is the absolute wall-clock instant the selected pods should see when the leap is applied.
+	// +optional
+	Time *metav1.Time `json:"time,omitempty"`
+
+	// Slew configures how the clock converges to the target in the "Slew" mode.
+	//
+	// In the "Slew" mode the pods start from their current time, which is the real time for the pods not
+	// driven yet, and converge to the instant selected by Offset or Time. Updating the spec converges from
+	// the current time again.
+	// +optional
+	Slew *SlewSpec `json:"slew,omitempty"`
+
+	// Skew assigns each selected pod a pseudo-random offset within a range on top of Offset or Time, e.g.
+	// to test consensus or cache expiry under clock skew. The offset of each pod is recorded in its
+	// "timeleap.x-k8s.io/skew" annotation, and in status.pods as long as the pod is listed there.
+	// +optional
+	Skew *SkewSpec `json:"skew,omitempty"`
+
+	// Rate is the speed of the virtual clock relative to the real clock, e.g. "60" runs an hour every minute.
+	//
+	// Changing Rate of an applied TimeLeap continues the virtual time from the instant of the change,
+	// so the virtual clock never jumps. Defaults to "1".
+	// +kubebuilder:validation:Pattern=`^([0-9]+(\.[0-9]*)?|\.[0-9]+)$`
+	// +optional
+	Rate string `json:"rate,omitempty"`
+
+	// Clocks is the list of kernel clocks affected by the TimeLeap. Defaults to CLOCK_REALTIME only.
+	//
+	// Shifting CLOCK_MONOTONIC or CLOCK_BOOTTIME affects the timers of the language runtimes too,
+	// so they should be listed only when the workload needs it.
+	// +listType=map
+	// +listMapKey=id
+	// +optional
+	Clocks []ClockSpec `json:"clocks,omitempty"`
+
+	// TTL is the lifetime of the TimeLeap since its creation.
+	//
+	// When the TTL elapses the controller restores the real time on every affected pod and
+	// marks the TimeLeap as Expired. Expired TimeLeaps are never applied again.
+	// +optional
+	TTL *metav1.Duration `json:"ttl,omitempty"`
+
+	// DeleteOnExpiry deletes the TimeLeap once it has expired and the real time has been restored.
+	// +optional
+	DeleteOnExpiry bool `json:"deleteOnExpiry,omitempty"`
+
+	// Suspend restores the real time on the selected pods while keeping the TimeLeap and its epoch.
+	//
+	// Setting Suspend back to false applies the virtual clocks again. A TimeLeap running at a rate other
+	// than 1 resumes from the virtual instant it was suspended at, and the "Slew" mode converges from the
+	// real time again instead of jumping.
+	// +optional
+	Suspend bool `json:"suspend,omitempty"`
+
+	// Epoch anchors the virtual clocks at the given epoch instead of the one the controller chooses when the
+	// spec is observed, so that several TimeLeaps agree on the virtual time however late they are observed.
+	//
+	// The ClusterTimeLeap sets the epoch it has chosen on the TimeLeaps it creates. Suspending such a TimeLeap
+	// does not pause the shared epoch, so it resumes at the virtual time of the others.
+	// +optional
+	Epoch *EpochSpec `json:"epoch,omitempty"`
+}
+
+// EpochSpec is the epoch shared by several TimeLeaps, see VirtualEpoch.
+type EpochSpec struct {
+	// Time is the real instant the virtual clocks are anchored at.
+	Time metav1.MicroTime `json:"time"`
+
+	// Origin is the real instant the offsets of the spec are evaluated at.
+	Origin metav1.MicroTime `json:"origin"`
+
+	// Drift is the offset the virtual clocks have gained from Origin to Time by the rates in effect then.
+	// +kubebuilder:validation:Pattern=`^[+-]?([0-9]+(\.[0-9]+)?(ns|us|µs|ms|s|m|h|d|w))+$`
+	// +optional
+	Drift string `json:"drift,omitempty"`
 }
 
 // TimeLeapStatus defines the observed state of TimeLeap.
-type TimeLeapStatus struct{}
+type TimeLeapStatus struct {
+	// ObservedGeneration is the most recent generation observed by the controller.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// FrozenAt is the virtual instant the selected pods are frozen at, set only in the "Freeze" mode.
+	// +optional
+	FrozenAt *metav1.Time `json:"frozenAt,omitempty"`
+
+	// ExpirationTime is the instant the TTL of the TimeLeap elapses.
+	// +optional
+	ExpirationTime *metav1.Time `json:"expirationTime,omitempty"`
+
+	// Epoch is the shared anchor of the virtual clocks of every targeted pod.
+	// +optional
+	Epoch *VirtualEpoch `json:"epoch,omitempty"`
+
+	// TargetOffset is the offset from the real time the virtual clock converges to, of the targeted pod
+	// furthest from it.
+	// +optional
+	TargetOffset string `json:"targetOffset,omitempty"`
+
+	// CurrentOffset is the offset from the real time the virtual clock reads, of the targeted pod furthest
+	// from the target. It differs from TargetOffset only while slewing.
+	// +optional
+	CurrentOffset string `json:"currentOffset,omitempty"`
+
+	// TargetedPods is the number of pods selected by the TimeLeap.
+	// +optional
+	TargetedPods int32 `json:"targetedPods,omitempty"`
+
+	// AppliedPods is the number of targeted pods which see the virtual clocks.
+	// +optional
+	AppliedPods int32 `json:"appliedPods,omitempty"`
+
+	// FailedPods is the number of targeted pods which the virtual clocks failed to be applied to.
+	// +optional
+	FailedPods int32 `json:"failedPods,omitempty"`
+
+	// Pods is the per-pod results, failed pods first.
+	//
+	// The list is bounded to MaxPodResults entries, the counts above cover every targeted pod.
+	// +listType=map
+	// +listMapKey=name
+	// +optional
+	Pods []PodResult `json:"pods,omitempty"`
+
+	// Conditions is the list of the latest observations of the TimeLeap state.
+	// +listType=map
+	// +listMapKey=type
+	// +patchMergeKey=type
+	// +patchStrategy=merge
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
+}
+
+// VirtualEpoch is the real instant the virtual clocks of every targeted pod are anchored at.
+//
+// The controller chooses the epoch once per spec and anchors every pod at it regardless of when the pod is
+// applied, so the pods of a TimeLeap agree on the virtual time to within the skew of the host clocks.
+type VirtualEpoch struct {
+	// Time is the real instant the virtual clocks are anchored at. It moves forward on every rate change.
+	Time metav1.MicroTime `json:"time"`
+
+	// Origin is the real instant the offsets of the spec are evaluated at, which is Time when the spec was
+	// last updated other than the rate.
+	Origin metav1.MicroTime `json:"origin"`
+
+	// Drift is the offset the virtual clocks have gained from Origin to Time by the rates in effect then.
+	// +optional
+	Drift string `json:"drift,omitempty"`
+
+	// Rate is the rate of the virtual clocks since Time, same as TimeLeapSpec.Rate.
+	// +optional
+	Rate string `json:"rate,omitempty"`
+
+	// SpecHash is the hash of the spec the epoch was chosen for.
+	SpecHash string `json:"specHash"`
+
+	// SuspendedAt is the real instant the TimeLeap was suspended at, set only while suspended.
+	// +optional
+	SuspendedAt *metav1.MicroTime `json:"suspendedAt,omitempty"`
+}
+
+// MaxPodResults is the maximum number of per-pod results recorded in the TimeLeapStatus.
+const MaxPodResults = 32
+
+// PodState is the state of the virtual clocks on a pod.
+type PodState string
+
+const (
+	// PodPending means the virtual clocks are not applied to the pod yet.
+	PodPending PodState = "Pending"
+
+	// PodApplied means the pod sees the virtual clocks.
+	PodApplied PodState = "Applied"
+
+	// PodFailed means the virtual clocks failed to be applied to the pod.
+	PodFailed PodState = "Failed"
+)
+
+// PodResult is the result of applying the virtual clocks to a pod.
+type PodResult struct {
+	// Name is the name of the pod.
+	Name string `json:"name"`
+
+	// State is the state of the virtual clocks on the pod.
+	State PodState `json:"state"`
+
+	// Skew is the offset assigned to the pod by the skew of the TimeLeap. The pod annotation
+	// "timeleap.x-k8s.io/skew" records it too, which is kept for the pods beyond MaxPodResults.
+	// +optional
+	Skew string `json:"skew,omitempty"`
+
+	// Message is the reason the pod is pending, or the error it failed with.
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// List of TimeLeap condition types.
+const (
+	// ConditionReady reports whether every targeted pod sees the virtual clocks.
+	ConditionReady = "Ready"
+
+	// ConditionProgressing reports whether the virtual clocks are being applied to some targeted pods.
+	ConditionProgressing = "Progressing"
+
+	// ConditionDegraded reports whether the virtual clocks failed to be applied to some targeted pods.
+	ConditionDegraded = "Degraded"
+
+	// ConditionExpired is the terminal condition of a TimeLeap whose TTL has elapsed.
+	ConditionExpired = "Expired"
+
+	// ConditionSuspended reports whether the TimeLeap is suspended and the selected pods see the real time.
+	ConditionSuspended = "Suspended"
+
+	// ConditionConflict reports whether the TimeLeap selects some pods also selected by other TimeLeaps,
+	// e.g. after the pod labels have changed.
+	ConditionConflict = "Conflict"
+)
+
+// List of TimeLeap condition reasons.
+const (
+	// ReasonApplied means every targeted pod sees the virtual clocks.
+	ReasonApplied = "Applied"
+
+	// ReasonApplying means the virtual clocks are still being applied to some targeted pods.
+	ReasonApplying = "Applying"
+
+	// ReasonNoTargets means the selector does not match any pod.
+	ReasonNoTargets = "NoTargets"
+
+	// ReasonPodsFailed means the virtual clocks failed to be applied to some targeted pods.
+	ReasonPodsFailed = "PodsFailed"
+
+	// ReasonAsExpected means the condition is in the expected state.
+	ReasonAsExpected = "AsExpected"
+
+	// ReasonTTLExpired is the reason of the Expired condition once the real time is restored.
+	ReasonTTLExpired = "TTLExpired"
+
+	// ReasonTerminating means the TimeLeap is being deleted and the real time is being restored.
+	ReasonTerminating = "Terminating"
+
+	// ReasonRestoreFailed means the real time failed to be restored on some pods.
+	ReasonRestoreFailed = "RestoreFailed"
+
+	// ReasonSuspended means the TimeLeap is suspended.
+	ReasonSuspended = "Suspended"
+
+	// ReasonOverlapping means some targeted pods are also selected by other TimeLeaps.
+	ReasonOverlapping = "Overlapping"
+)
+
+// Finalizer is the finalizer which holds a deleted TimeLeap until the real time is restored on every pod it drives.
+const Finalizer = "timeleap.x-k8s.io/finalizer"
 
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Mode",type=string,JSONPath=`.spec.mode`
+// +kubebuilder:printcolumn:name="Offset",type=string,JSONPath=`.spec.offset`
+// +kubebuilder:printcolumn:name="Time",type=string,JSONPath=`.spec.time`,priority=1
+// +kubebuilder:printcolumn:name="Current Offset",type=string,JSONPath=`.status.currentOffset`,priority=1
+// +kubebuilder:printcolumn:name="Targeted",type=integer,JSONPath=`.status.targetedPods`
+// +kubebuilder:printcolumn:name="Applied",type=integer,JSONPath=`.status.appliedPods`
+// +kubebuilder:printcolumn:name="Failed",type=integer,JSONPath=`.status.failedPods`
+// +kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+// +kubebuilder:printcolumn:name="Frozen At",type=date,JSONPath=`.status.frozenAt`
+// +kubebuilder:printcolumn:name="Suspended",type=boolean,JSONPath=`.spec.suspend`,priority=1
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 
 // TimeLeap is the Schema for the timeleaps API.
 type TimeLeap struct {
@@ -40,3 +390,110 @@ type TimeLeapList struct {
 	metav1.ListMeta `json:"metadata,omitempty"`
 	Items           []TimeLeap `json:"items"`
 }
+
+// IsFrozen reports whether the spec pins the selected pods at a single instant.
+func (s *TimeLeapSpec) IsFrozen() bool {
+	return s.Mode == FreezeMode
+}
+
+// IsSlewing reports whether the spec converges the selected pods to the target gradually.
+func (s *TimeLeapSpec) IsSlewing() bool {
+	return s.Mode == SlewMode
+}
+
+// SlewRate returns the correction applied every real second to converge the clock by slew.
+//
+// The correction completes the slew over the period of the spec, bounded by its max rate. The default max
+// rate is scaled down with a rate below 1, so the clock slowing down never goes backwards.
+func (s *TimeLeapSpec) SlewRate(slew time.Duration) (float64, error) {
+	r, err := ParseRate(s.Rate)
+	if err != nil {
+		return 0, err
+	}
+	period, maxRate := DefaultSlewPeriod, DefaultSlewMaxRate*math.Min(r, 1)
+	if s.Slew != nil {
+		if s.Slew.Period != nil {
+			period = s.Slew.Period.Duration
+		}
+		if s.Slew.MaxRate != "" {
+			r, err := ParseRate(s.Slew.MaxRate)
+			if err != nil {
+				return 0, err
+			}
+			maxRate = r
+		}
+	}
+	if slew < 0 {
+		slew = -slew
+	}
+
+	rate := float64(slew) / float64(period)
+	if rate > maxRate {
+		rate = maxRate
+	}
+
+	return rate, nil
+}
+
+// OffsetAt returns the offset from the real time now to the virtual time the spec selects.
+func (s *TimeLeapSpec) OffsetAt(now time.Time) (time.Duration, error) {
+	if s.Time != nil {
+		return s.Time.Sub(now), nil
+	}
+	if s.Offset == "" {
+		return 0, nil
+	}
+
+	return ParseOffset(s.Offset)
+}
+
+// ClockIDs returns the kernel clocks affected by the spec.
+func (s *TimeLeapSpec) ClockIDs() []ClockID {
+	if len(s.Clocks) == 0 {
+		return []ClockID{ClockRealtime}
+	}
+
+	ids := make([]ClockID, len(s.Clocks))
+	for i, c := range s.Clocks {
+		ids[i] = c.ID
+	}
+
+	return ids
+}
+
+// ClockOffsetAt returns the offset of the kernel clock id from the real time now.
+//
+// The clocks which do not override the offset share the offset of the spec.
+func (s *TimeLeapSpec) ClockOffsetAt(id ClockID, now time.Time) (time.Duration, error) {
+	for _, c := range s.Clocks {
+		if c.ID == id && c.Offset != "" {
+			return ParseOffset(c.Offset)
+		}
+	}
+
+	return s.OffsetAt(now)
+}
+
+// setDefaults fills in the defaults of the spec.
+func (s *TimeLeapSpec) setDefaults() {
+	if s.Mode == "" {
+		s.Mode = OffsetMode
+	}
+	if len(s.Clocks) == 0 {
+		s.Clocks = []ClockSpec{{ID: ClockRealtime}}
+	}
+	if s.Time != nil {
+		t := metav1.NewTime(s.Time.UTC()).Rfc3339Copy()
+		s.Time = &t
+	}
+}
+
+// ExpirationTime returns the instant the TTL of tl elapses, or nil if tl has no TTL.
+func (tl *TimeLeap) ExpirationTime() *metav1.Time {
+	if tl.Spec.TTL == nil {
+		return nil
+	}
+	t := metav1.NewTime(tl.CreationTimestamp.Add(tl.Spec.TTL.Duration))
+
+	return &t
+}
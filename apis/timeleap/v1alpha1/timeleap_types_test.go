@@ -0,0 +1,65 @@
+// Copyright 2020 The kube-timeleap Authors.
+// SPDX-License-Identifier: BSD-3-Clause
+
+package v1alpha1
+
+import (
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestTimeLeapSpec_SlewRate(t *testing.T) {
+	tests := []struct {
+		name  string
+		rate  string
+		slew  *SlewSpec
+		delta time.Duration
+		want  float64
+	}{
+		{
+			name:  "WithinPeriod",
+			delta: 30 * time.Minute,
+			want:  0.5,
+		},
+		{
+			name:  "DefaultMaxRate",
+			delta: 2 * time.Hour,
+			want:  DefaultSlewMaxRate,
+		},
+		{
+			name:  "DefaultMaxRateBelowRate",
+			rate:  "0.5",
+			delta: -2 * time.Hour,
+			want:  0.25,
+		},
+		{
+			name:  "DefaultMaxRateFastRate",
+			rate:  "60",
+			delta: 2 * time.Hour,
+			want:  DefaultSlewMaxRate,
+		},
+		{
+			name:  "MaxRate",
+			slew:  &SlewSpec{Period: &metav1.Duration{Duration: time.Minute}, MaxRate: "0.9"},
+			delta: time.Hour,
+			want:  0.9,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			spec := TimeLeapSpec{Mode: SlewMode, Rate: tt.rate, Slew: tt.slew}
+			got, err := spec.SlewRate(tt.delta)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Fatalf("SlewRate(%v) = %v, want %v", tt.delta, got, tt.want)
+			}
+		})
+	}
+}
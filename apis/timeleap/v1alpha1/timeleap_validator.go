@@ -0,0 +1,152 @@
+// Copyright 2020 The kube-timeleap Authors.
+// SPDX-License-Identifier: BSD-3-Clause
+
+package v1alpha1
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// validatePath is the path of the validating webhook of TimeLeap, same as the path the webhook builder generates.
+const validatePath = "/validate-timeleap-x-k8s-io-v1alpha1-timeleap"
+
+// validator is the validating admission handler of TimeLeap.
+//
+// validator applies ValidateCreate and ValidateUpdate, and rejects the TimeLeaps which select the pods
+// already selected by the other TimeLeaps, which a webhook.Validator cannot see.
+//
+// Only the pods which exist at admission are compared, the selectors themselves are not. The overlaps on
+// the pods created later are reported by the controller as the Conflict condition instead.
+type validator struct {
+	client  client.Client
+	decoder *admission.Decoder
+}
+
+// compile time check whether the validator implements admission.DecoderInjector and admission.Handler interfaces.
+var (
+	_ admission.DecoderInjector = (*validator)(nil)
+	_ admission.Handler         = (*validator)(nil)
+)
+
+// InjectDecoder implements admission.DecoderInjector.
+func (v *validator) InjectDecoder(decoder *admission.Decoder) error {
+	v.decoder = decoder
+	return nil
+}
+
+// Handle implements admission.Handler.
+func (v *validator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	tl := &TimeLeap{}
+	now := time.Now()
+
+	var allErrs field.ErrorList
+	switch req.Operation {
+	case admissionv1beta1.Create:
+		if err := v.decoder.Decode(req, tl); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		timeleaplog.Info("validate create", "name", tl.Name)
+
+		allErrs = tl.validateCreate(now)
+
+	case admissionv1beta1.Update:
+		old := &TimeLeap{}
+		if err := v.decoder.DecodeRaw(req.Object, tl); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		if err := v.decoder.DecodeRaw(req.OldObject, old); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		timeleaplog.Info("validate update", "name", tl.Name)
+
+		allErrs = tl.validateUpdate(old, now)
+		if equality.Semantic.DeepEqual(&tl.Spec.Selector, &old.Spec.Selector) {
+			// the overlaps which appear later are reported by the controller
+			return validationResponse(tl.invalid(allErrs))
+		}
+
+	default:
+		// TimeLeaps can always be deleted
+		return admission.Allowed("")
+	}
+
+	if len(allErrs) == 0 {
+		errs, err := v.validateOverlaps(ctx, tl, req.Namespace)
+		if err != nil {
+			// the pod injector creates TimeLeaps at pod creation, which an API hiccup must not block, and the
+			// controller reports the overlaps anyway
+			timeleaplog.Error(err, "unable to validate overlaps", "name", tl.Name)
+			return admission.Allowed("").WithWarnings("overlaps with the other TimeLeaps are not validated: " + err.Error())
+		}
+		allErrs = append(allErrs, errs...)
+	}
+
+	return validationResponse(tl.invalid(allErrs))
+}
+
+// validateOverlaps validates that tl does not select any existing pod selected by the other TimeLeaps in the
+// namespace.
+func (v *validator) validateOverlaps(ctx context.Context, tl *TimeLeap, namespace string) (field.ErrorList, error) {
+	if tl.Namespace == "" {
+		tl.Namespace = namespace
+	}
+
+	selector, err := metav1.LabelSelectorAsSelector(&tl.Spec.Selector)
+	if err != nil {
+		return nil, nil // reported by validateSpec
+	}
+
+	pods := &corev1.PodList{}
+	if err := v.client.List(ctx, pods, client.InNamespace(tl.Namespace), client.MatchingLabelsSelector{Selector: selector}); err != nil {
+		return nil, fmt.Errorf("list pods: %w", err)
+	}
+	if len(pods.Items) == 0 {
+		return nil, nil
+	}
+
+	tls := &TimeLeapList{}
+	if err := v.client.List(ctx, tls, client.InNamespace(tl.Namespace)); err != nil {
+		return nil, fmt.Errorf("list TimeLeaps: %w", err)
+	}
+
+	var allErrs field.ErrorList
+	for _, o := range FindOverlaps(tl, tls.Items, pods.Items) {
+		allErrs = append(allErrs, field.Forbidden(field.NewPath("spec", "selector"),
+			fmt.Sprintf("overlaps with %s, a pod can be driven by one TimeLeap only", o)))
+	}
+
+	return allErrs, nil
+}
+
+// validationResponse returns the response of the validation error err, same as the webhook.Validator response.
+func validationResponse(err error) admission.Response {
+	if err == nil {
+		return admission.Allowed("")
+	}
+
+	var apiStatus apierrors.APIStatus
+	if errors.As(err, &apiStatus) {
+		status := apiStatus.Status()
+		return admission.Response{
+			AdmissionResponse: admissionv1beta1.AdmissionResponse{
+				Allowed: false,
+				Result:  &status,
+			},
+		}
+	}
+
+	return admission.Denied(err.Error())
+}
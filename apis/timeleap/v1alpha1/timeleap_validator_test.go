@@ -0,0 +1,154 @@
+// Copyright 2020 The kube-timeleap Authors.
+// SPDX-License-Identifier: BSD-3-Clause
+
+package v1alpha1
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+func newTestValidator(t *testing.T, objs ...client.Object) *validator {
+	t.Helper()
+
+	c := newFakeClient(t, objs...)
+	decoder, err := admission.NewDecoder(c.Scheme())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v := &validator{client: c}
+	if err := v.InjectDecoder(decoder); err != nil {
+		t.Fatal(err)
+	}
+
+	return v
+}
+
+func TestValidator_Handle(t *testing.T) {
+	web := selecting("web", map[string]string{"tier": "web"})
+	web.Spec.Offset = "+24h"
+	pod := labeledPod("sample-0", map[string]string{"app": "sample", "tier": "web"})
+	db := labeledPod("db-0", map[string]string{"app": "db"})
+
+	tests := []struct {
+		name    string
+		op      admissionv1beta1.Operation
+		old     *TimeLeap
+		mutate  func(*TimeLeap)
+		wantErr string
+	}{
+		{
+			name:    "CreateOverlapping",
+			op:      admissionv1beta1.Create,
+			wantErr: `spec.selector: Forbidden: overlaps with TimeLeap "web" on pods sample-0`,
+		},
+		{
+			name: "CreateDisjoint",
+			op:   admissionv1beta1.Create,
+			mutate: func(tl *TimeLeap) {
+				tl.Spec.Selector.MatchLabels = map[string]string{"app": "db"}
+			},
+		},
+		{
+			name: "CreateInvalid",
+			op:   admissionv1beta1.Create,
+			mutate: func(tl *TimeLeap) {
+				tl.Spec.Rate = "-1"
+			},
+			wantErr: "spec.rate",
+		},
+		{
+			name: "UpdateSelectorToOverlap",
+			op:   admissionv1beta1.Update,
+			old: func() *TimeLeap {
+				tl := &TimeLeap{Spec: validSpec()}
+				tl.Namespace, tl.Name = "default", "leap"
+				tl.Spec.Selector.MatchLabels = map[string]string{"app": "db"}
+				return tl
+			}(),
+			wantErr: `overlaps with TimeLeap "web"`,
+		},
+		{
+			name: "UpdateKeepingSelector",
+			op:   admissionv1beta1.Update,
+			old: func() *TimeLeap {
+				tl := &TimeLeap{Spec: validSpec()}
+				tl.Namespace, tl.Name = "default", "leap"
+				return tl
+			}(),
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			tl := &TimeLeap{Spec: validSpec()}
+			tl.Namespace, tl.Name = "default", "leap"
+			if tt.mutate != nil {
+				tt.mutate(tl)
+			}
+
+			req := admission.Request{AdmissionRequest: admissionv1beta1.AdmissionRequest{
+				Operation: tt.op,
+				Namespace: "default",
+				Object:    runtime.RawExtension{Raw: rawTimeLeap(t, tl)},
+			}}
+			if tt.old != nil {
+				req.OldObject = runtime.RawExtension{Raw: rawTimeLeap(t, tt.old)}
+			}
+
+			resp := newTestValidator(t, web.DeepCopy(), pod.DeepCopy(), db.DeepCopy()).Handle(context.Background(), req)
+			if tt.wantErr == "" {
+				if !resp.Allowed {
+					t.Fatalf("Handle() denied: %v", resp.Result)
+				}
+				return
+			}
+			if resp.Allowed {
+				t.Fatal("Handle() allowed")
+			}
+			if msg := resp.Result.Message; !strings.Contains(msg, tt.wantErr) {
+				t.Fatalf("Handle() message = %q, want to contain %q", msg, tt.wantErr)
+			}
+		})
+	}
+}
+
+// failingListClient is the client which fails to list any object.
+type failingListClient struct {
+	client.Client
+}
+
+func (failingListClient) List(context.Context, client.ObjectList, ...client.ListOption) error {
+	return errors.New("etcdserver: request timed out")
+}
+
+func TestValidator_HandleListError(t *testing.T) {
+	v := newTestValidator(t)
+	v.client = failingListClient{Client: v.client}
+
+	tl := &TimeLeap{Spec: validSpec()}
+	tl.Namespace, tl.Name = "default", "leap"
+	req := admission.Request{AdmissionRequest: admissionv1beta1.AdmissionRequest{
+		Operation: admissionv1beta1.Create,
+		Namespace: "default",
+		Object:    runtime.RawExtension{Raw: rawTimeLeap(t, tl)},
+	}}
+
+	resp := v.Handle(context.Background(), req)
+	if !resp.Allowed {
+		t.Fatalf("Handle() denied: %v", resp.Result)
+	}
+	if len(resp.Warnings) != 1 || !strings.Contains(resp.Warnings[0], "request timed out") {
+		t.Fatalf("Handle() warnings = %q, want the list error", resp.Warnings)
+	}
+}
@@ -4,17 +4,36 @@
 package v1alpha1
 
 import (
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 	ctrl "sigs.k8s.io/controller-runtime"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
+
+	"github.com/zchee/kube-timeleap/pkg/config"
 )
 
 // log is for logging in this package.
 var timeleaplog = logf.Log.WithName("timeleap-resource")
 
 // SetupWebhookWithManager setup TimeLeap webhook with manager.
+//
+// The webhooks are registered ahead of the builder, which then skips the paths, so that they can see the
+// admission request and the other objects in the cluster.
 func (r *TimeLeap) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	mgr.GetWebhookServer().Register(mutatePath, &webhook.Admission{
+		Handler: &defaulter{defaultTTL: config.DefaultTTL()},
+	})
+	mgr.GetWebhookServer().Register(validatePath, &webhook.Admission{
+		Handler: &validator{client: mgr.GetClient()},
+	})
+
 	return ctrl.NewWebhookManagedBy(mgr).
 		For(r).
 		Complete()
@@ -28,10 +47,13 @@ var _ webhook.Defaulter = (*TimeLeap)(nil)
 // Default implements webhook.Defaulter.
 //
 // Default is a webhook will be registered for the type.
+//
+// Default fills in the defaults which depend on the TimeLeap only. The defaults which depend on the manager
+// config or the creating user are filled in by the mutating webhook.
 func (r *TimeLeap) Default() {
 	timeleaplog.Info("default", "name", r.Name)
 
-	// TODO(user): fill in your defaulting logic.
+	r.Spec.setDefaults()
 }
 
 // +kubebuilder:webhook:webhookVersions=v1,verbs=create;update,path=/validate-timeleap-x-k8s-io-v1alpha1-timeleap,mutating=false,failurePolicy=fail,matchPolicy=Equivalent,groups=timeleap.x-k8s.io,resources=timeleaps,versions=v1alpha1,name=vtimeleap.kb.io,sideEffects=None
@@ -45,8 +67,7 @@ var _ webhook.Validator = (*TimeLeap)(nil)
 func (r *TimeLeap) ValidateCreate() error {
 	timeleaplog.Info("validate create", "name", r.Name)
 
-	// TODO(user): fill in your validation logic upon object creation.
-	return nil
+	return r.invalid(r.validateCreate(time.Now()))
 }
 
 // ValidateUpdate implements webhook.Validator.
@@ -55,16 +76,49 @@ func (r *TimeLeap) ValidateCreate() error {
 func (r *TimeLeap) ValidateUpdate(old runtime.Object) error {
 	timeleaplog.Info("validate update", "name", r.Name)
 
-	// TODO(user): fill in your validation logic upon object update.
-	return nil
+	oldTL, ok := old.(*TimeLeap)
+	if !ok {
+		return fmt.Errorf("expected a TimeLeap but got a %T", old)
+	}
+
+	return r.invalid(r.validateUpdate(oldTL, time.Now()))
 }
 
 // ValidateDelete implements webhook.Validator.
 //
 // ValidateDelete is a webhook will be registered for the type.
+//
+// TimeLeaps can always be deleted, the controller restores the real time on the pods before letting them go.
 func (r *TimeLeap) ValidateDelete() error {
 	timeleaplog.Info("validate delete", "name", r.Name)
 
-	// TODO(user): fill in your validation logic upon object deletion.
 	return nil
 }
+
+// validateCreate validates the creation of r, with the real time now.
+func (r *TimeLeap) validateCreate(now time.Time) field.ErrorList {
+	return validateSpec(&r.Spec, field.NewPath("spec"), now)
+}
+
+// validateUpdate validates the update of r from old, with the real time now.
+func (r *TimeLeap) validateUpdate(old *TimeLeap, now time.Time) field.ErrorList {
+	path := field.NewPath("spec")
+	expired := meta.IsStatusConditionTrue(old.Status.Conditions, ConditionExpired)
+	allErrs := validateSpecUpdate(&r.Spec, &old.Spec, expired, path)
+	if equality.Semantic.DeepEqual(&r.Spec, &old.Spec) {
+		// metadata only update, e.g. the finalizer; do not reject it because the spec has become
+		// out of the bounds relative to the current time
+		return allErrs
+	}
+
+	return append(allErrs, validateSpec(&r.Spec, path, now)...)
+}
+
+// invalid returns the aggregated Invalid error of allErrs, or nil if allErrs is empty.
+func (r *TimeLeap) invalid(allErrs field.ErrorList) error {
+	if len(allErrs) == 0 {
+		return nil
+	}
+
+	return apierrors.NewInvalid(GroupVersion.WithKind("TimeLeap").GroupKind(), r.Name, allErrs)
+}
@@ -0,0 +1,195 @@
+// Copyright 2020 The kube-timeleap Authors.
+// SPDX-License-Identifier: BSD-3-Clause
+
+package v1alpha1
+
+import (
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func init() {
+	SchemeBuilder.Register(&TimeLeapSchedule{}, &TimeLeapScheduleList{})
+}
+
+// TimeLeapScheduleLabel is the label of the TimeLeap driven by a TimeLeapSchedule, whose value is the name of
+// the TimeLeapSchedule.
+const TimeLeapScheduleLabel = "timeleap.x-k8s.io/schedule"
+
+// ScheduleStep is a step of a TimeLeapSchedule.
+//
+// Exactly one of Offset or Time must be set.
+type ScheduleStep struct {
+	// Offset is the relative offset added to the real time during the step, same as TimeLeapSpec.Offset.
+	// +kubebuilder:validation:Pattern=`^[+-]?([0-9]+(\.[0-9]+)?(ns|us|µs|ms|s|m|h|d|w))+$`
+	// +optional
+	Offset string `json:"offset,omitempty"`
+
+	// Time is the absolute wall-clock instant the selected pods jump to at the start of the step,
+	// same as TimeLeapSpec.Time.
+	// +optional
+	Time *metav1.Time `json:"time,omitempty"`
+
+	// Dwell is how long the step lasts in the real time before the schedule moves on to the next step.
+	Dwell metav1.Duration `json:"dwell"`
+}
+
+// TimeLeapScheduleSpec defines the desired state of TimeLeapSchedule.
+type TimeLeapScheduleSpec struct {
+	// Selector is a label query over pods in the TimeLeapSchedule namespace that should see the virtual time.
+	Selector metav1.LabelSelector `json:"selector"`
+
+	// Mode is the mode of the virtual clock during every step, same as TimeLeapSpec.Mode. Defaults to "Offset".
+	// +optional
+	Mode TimeLeapMode `json:"mode,omitempty"`
+
+	// Slew configures how the clock converges to the target of every step in the "Slew" mode, same as
+	// TimeLeapSpec.Slew.
+	// +optional
+	Slew *SlewSpec `json:"slew,omitempty"`
+
+	// Skew assigns each selected pod a pseudo-random offset within a range, same as TimeLeapSpec.Skew.
+	// +optional
+	Skew *SkewSpec `json:"skew,omitempty"`
+
+	// Rate is the speed of the virtual clock during every step, same as TimeLeapSpec.Rate.
+	// +kubebuilder:validation:Pattern=`^([0-9]+(\.[0-9]*)?|\.[0-9]+)$`
+	// +optional
+	Rate string `json:"rate,omitempty"`
+
+	// Clocks is the list of kernel clocks affected by the TimeLeapSchedule, same as TimeLeapSpec.Clocks.
+	// +listType=map
+	// +listMapKey=id
+	// +optional
+	Clocks []ClockSpec `json:"clocks,omitempty"`
+
+	// Steps is the ordered list of the time jumps.
+	//
+	// The steps are walked through in order, and the real time is restored once the last step has dwelt.
+	// Updating the spec restarts the schedule from the first step.
+	// +kubebuilder:validation:MinItems=1
+	Steps []ScheduleStep `json:"steps"`
+}
+
+// TimeLeapScheduleStatus defines the observed state of TimeLeapSchedule.
+type TimeLeapScheduleStatus struct {
+	// ObservedGeneration is the most recent generation observed by the controller.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// CurrentStep is the index of the current step in spec.steps, or the number of steps once completed.
+	// +optional
+	CurrentStep int32 `json:"currentStep"`
+
+	// StepStartTime is the real time the current step has started at.
+	// +optional
+	StepStartTime *metav1.Time `json:"stepStartTime,omitempty"`
+
+	// NextStepTime is the real time the schedule moves on to the next step at, unset once completed.
+	// +optional
+	NextStepTime *metav1.Time `json:"nextStepTime,omitempty"`
+
+	// CompletionTime is the real time the last step has dwelt at.
+	// +optional
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+
+	// Conditions is the list of the latest observations of the TimeLeapSchedule state.
+	// +listType=map
+	// +listMapKey=type
+	// +patchMergeKey=type
+	// +patchStrategy=merge
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
+}
+
+// List of TimeLeapSchedule condition types.
+const (
+	// ConditionCompleted is the terminal condition of a TimeLeapSchedule whose every step has dwelt.
+	ConditionCompleted = "Completed"
+)
+
+// List of TimeLeapSchedule condition reasons.
+const (
+	// ReasonStepping means the TimeLeapSchedule is walking through the steps.
+	ReasonStepping = "Stepping"
+
+	// ReasonStepsCompleted means every step has dwelt and the real time is restored.
+	ReasonStepsCompleted = "StepsCompleted"
+)
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Mode",type=string,JSONPath=`.spec.mode`
+// +kubebuilder:printcolumn:name="Step",type=integer,JSONPath=`.status.currentStep`
+// +kubebuilder:printcolumn:name="Next Step",type=date,JSONPath=`.status.nextStepTime`
+// +kubebuilder:printcolumn:name="Completed",type=string,JSONPath=`.status.conditions[?(@.type=="Completed")].status`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// TimeLeapSchedule is the Schema for the timeleapschedules API.
+//
+// A TimeLeapSchedule drives a TimeLeap named after it through a sequence of time jumps.
+type TimeLeapSchedule struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   TimeLeapScheduleSpec   `json:"spec,omitempty"`
+	Status TimeLeapScheduleStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// TimeLeapScheduleList contains a list of TimeLeapSchedule.
+type TimeLeapScheduleList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []TimeLeapSchedule `json:"items"`
+}
+
+// StepSpec returns the spec of the TimeLeap during the step at index i.
+//
+// The returned spec is defaulted same as the mutating webhook does, so it can be compared with the stored one.
+// It has no TTL, since the TimeLeap lives until the schedule completes.
+func (s *TimeLeapScheduleSpec) StepSpec(i int) TimeLeapSpec {
+	step := s.Steps[i]
+	spec := TimeLeapSpec{
+		Selector: *s.Selector.DeepCopy(),
+		Mode:     s.Mode,
+		Offset:   step.Offset,
+		Rate:     s.Rate,
+	}
+	if step.Time != nil {
+		spec.Time = step.Time.DeepCopy()
+	}
+	if s.Slew != nil {
+		spec.Slew = s.Slew.DeepCopy()
+	}
+	if s.Skew != nil {
+		spec.Skew = s.Skew.DeepCopy()
+	}
+	if len(s.Clocks) > 0 {
+		spec.Clocks = make([]ClockSpec, len(s.Clocks))
+		copy(spec.Clocks, s.Clocks)
+	}
+	spec.setDefaults()
+
+	return spec
+}
+
+// Advance returns the index of the step in progress at now and the real time it has started at, given the
+// step at index i has started at start.
+//
+// The steps are timed from the start of the previous step, so a late observation does not shift the
+// following steps. The returned index is len(s.Steps) once every step has dwelt, with the completion time.
+func (s *TimeLeapScheduleSpec) Advance(i int, start, now time.Time) (int, time.Time) {
+	for i < len(s.Steps) {
+		end := start.Add(s.Steps[i].Dwell.Duration)
+		if now.Before(end) {
+			break
+		}
+		i++
+		start = end
+	}
+
+	return i, start
+}
@@ -0,0 +1,185 @@
+// Copyright 2020 The kube-timeleap Authors.
+// SPDX-License-Identifier: BSD-3-Clause
+
+package v1alpha1
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+func validScheduleSpec() TimeLeapScheduleSpec {
+	monthEnd := metav1.NewTime(time.Date(2021, time.January, 31, 23, 59, 0, 0, time.UTC))
+
+	return TimeLeapScheduleSpec{
+		Selector: metav1.LabelSelector{MatchLabels: map[string]string{"app": "sample"}},
+		Steps: []ScheduleStep{
+			{Time: &monthEnd, Dwell: metav1.Duration{Duration: 5 * time.Minute}},
+			{Offset: "+1w", Dwell: metav1.Duration{Duration: 10 * time.Minute}},
+		},
+	}
+}
+
+func TestTimeLeapScheduleSpec_StepSpec(t *testing.T) {
+	t.Parallel()
+
+	spec := validScheduleSpec()
+	monthEnd := metav1.NewTime(spec.Steps[0].Time.Time)
+
+	tests := []struct {
+		name string
+		step int
+		want TimeLeapSpec
+	}{
+		{
+			name: "Time",
+			step: 0,
+			want: TimeLeapSpec{
+				Selector: spec.Selector,
+				Mode:     OffsetMode,
+				Time:     &monthEnd,
+				Clocks:   []ClockSpec{{ID: ClockRealtime}},
+			},
+		},
+		{
+			name: "Offset",
+			step: 1,
+			want: TimeLeapSpec{
+				Selector: spec.Selector,
+				Mode:     OffsetMode,
+				Offset:   "+1w",
+				Clocks:   []ClockSpec{{ID: ClockRealtime}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if diff := cmp.Diff(tt.want, spec.StepSpec(tt.step)); diff != "" {
+				t.Fatalf("(-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestTimeLeapScheduleSpec_Advance(t *testing.T) {
+	t.Parallel()
+
+	spec := validScheduleSpec()
+	start := time.Date(2020, time.October, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		step      int
+		now       time.Time
+		wantStep  int
+		wantStart time.Time
+	}{
+		{
+			name:      "InFirstStep",
+			now:       start.Add(time.Minute),
+			wantStep:  0,
+			wantStart: start,
+		},
+		{
+			name:      "AtStepEnd",
+			now:       start.Add(5 * time.Minute),
+			wantStep:  1,
+			wantStart: start.Add(5 * time.Minute),
+		},
+		{
+			name:      "ObservedLate",
+			now:       start.Add(14 * time.Minute),
+			wantStep:  1,
+			wantStart: start.Add(5 * time.Minute),
+		},
+		{
+			name:      "Completed",
+			now:       start.Add(time.Hour),
+			wantStep:  2,
+			wantStart: start.Add(15 * time.Minute),
+		},
+		{
+			name:      "FromSecondStep",
+			step:      1,
+			now:       start.Add(9 * time.Minute),
+			wantStep:  1,
+			wantStart: start,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			step, stepStart := spec.Advance(tt.step, start, tt.now)
+			if step != tt.wantStep || !stepStart.Equal(tt.wantStart) {
+				t.Fatalf("got step %d started at %s, want step %d started at %s", step, stepStart, tt.wantStep, tt.wantStart)
+			}
+		})
+	}
+}
+
+func TestValidateScheduleSpec(t *testing.T) {
+	now := time.Date(2020, time.October, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		mutate func(*TimeLeapScheduleSpec)
+		want   []string // field paths of the errors
+	}{
+		{
+			name:   "Valid",
+			mutate: func(*TimeLeapScheduleSpec) {},
+		},
+		{
+			name:   "EmptySelector",
+			mutate: func(s *TimeLeapScheduleSpec) { s.Selector = metav1.LabelSelector{} },
+			want:   []string{"spec.selector"},
+		},
+		{
+			name:   "NoSteps",
+			mutate: func(s *TimeLeapScheduleSpec) { s.Steps = nil },
+			want:   []string{"spec.steps"},
+		},
+		{
+			name:   "StepWithoutTarget",
+			mutate: func(s *TimeLeapScheduleSpec) { s.Steps[1].Offset = "" },
+			want:   []string{"spec.steps[1].offset"},
+		},
+		{
+			name:   "StepOffsetTooFar",
+			mutate: func(s *TimeLeapScheduleSpec) { s.Steps[1].Offset = "+40000d" },
+			want:   []string{"spec.steps[1].offset"},
+		},
+		{
+			name:   "NonPositiveDwell",
+			mutate: func(s *TimeLeapScheduleSpec) { s.Steps[0].Dwell = metav1.Duration{} },
+			want:   []string{"spec.steps[0].dwell"},
+		},
+		{
+			name:   "InvalidRate",
+			mutate: func(s *TimeLeapScheduleSpec) { s.Rate = "0" },
+			want:   []string{"spec.rate"},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			spec := validScheduleSpec()
+			tt.mutate(&spec)
+
+			if diff := cmp.Diff(tt.want, errorFields(validateScheduleSpec(&spec, field.NewPath("spec"), now))); diff != "" {
+				t.Fatalf("(-want +got):\n%s", diff)
+			}
+		})
+	}
+}
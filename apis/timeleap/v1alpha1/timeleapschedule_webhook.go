@@ -0,0 +1,104 @@
+// Copyright 2020 The kube-timeleap Authors.
+// SPDX-License-Identifier: BSD-3-Clause
+
+package v1alpha1
+
+import (
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+// log is for logging in this package.
+var timeleapschedulelog = logf.Log.WithName("timeleapschedule-resource")
+
+// SetupWebhookWithManager setup TimeLeapSchedule webhook with manager.
+func (r *TimeLeapSchedule) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		Complete()
+}
+
+// +kubebuilder:webhook:webhookVersions=v1,verbs=create;update,path=/validate-timeleap-x-k8s-io-v1alpha1-timeleapschedule,mutating=false,failurePolicy=fail,matchPolicy=Equivalent,groups=timeleap.x-k8s.io,resources=timeleapschedules,versions=v1alpha1,name=vtimeleapschedule.kb.io,sideEffects=None
+
+// compile time check whether the TimeLeapSchedule implements webhook.Validator interface.
+var _ webhook.Validator = (*TimeLeapSchedule)(nil)
+
+// ValidateCreate implements webhook.Validator.
+//
+// ValidateCreate is a webhook will be registered for the type.
+func (r *TimeLeapSchedule) ValidateCreate() error {
+	timeleapschedulelog.Info("validate create", "name", r.Name)
+
+	return r.invalid(validateScheduleSpec(&r.Spec, field.NewPath("spec"), time.Now()))
+}
+
+// ValidateUpdate implements webhook.Validator.
+//
+// ValidateUpdate is a webhook will be registered for the type.
+//
+// Any update is allowed as long as the new spec is valid, the schedule restarts from the first step.
+func (r *TimeLeapSchedule) ValidateUpdate(old runtime.Object) error {
+	timeleapschedulelog.Info("validate update", "name", r.Name)
+
+	oldTLS, ok := old.(*TimeLeapSchedule)
+	if !ok {
+		return fmt.Errorf("expected a TimeLeapSchedule but got a %T", old)
+	}
+	if equality.Semantic.DeepEqual(&r.Spec, &oldTLS.Spec) {
+		// metadata only update
+		return nil
+	}
+
+	return r.invalid(validateScheduleSpec(&r.Spec, field.NewPath("spec"), time.Now()))
+}
+
+// ValidateDelete implements webhook.Validator.
+//
+// ValidateDelete is a webhook will be registered for the type.
+func (r *TimeLeapSchedule) ValidateDelete() error {
+	timeleapschedulelog.Info("validate delete", "name", r.Name)
+
+	return nil
+}
+
+// invalid returns the aggregated Invalid error of allErrs, or nil if allErrs is empty.
+func (r *TimeLeapSchedule) invalid(allErrs field.ErrorList) error {
+	if len(allErrs) == 0 {
+		return nil
+	}
+
+	return apierrors.NewInvalid(GroupVersion.WithKind("TimeLeapSchedule").GroupKind(), r.Name, allErrs)
+}
+
+// validateScheduleSpec validates the schedule spec at path, with the real time now.
+func validateScheduleSpec(spec *TimeLeapScheduleSpec, path *field.Path, now time.Time) field.ErrorList {
+	var allErrs field.ErrorList
+
+	allErrs = append(allErrs, validateSelector(&spec.Selector, path.Child("selector"))...)
+	allErrs = append(allErrs, validateMode(spec.Mode, path.Child("mode"))...)
+	allErrs = append(allErrs, validateRate(spec.Rate, path.Child("rate"))...)
+	allErrs = append(allErrs, validateClocks(spec.Clocks, path.Child("clocks"))...)
+	allErrs = append(allErrs, validateSlew(spec.Mode, spec.Slew, spec.Rate, path.Child("slew"))...)
+	allErrs = append(allErrs, validateSkew(spec.Skew, path.Child("skew"))...)
+
+	if len(spec.Steps) == 0 {
+		allErrs = append(allErrs, field.Required(path.Child("steps"), "at least one step is required"))
+	}
+	for i, step := range spec.Steps {
+		idx := path.Child("steps").Index(i)
+		allErrs = append(allErrs, validateTarget(step.Offset, step.Time, idx, now)...)
+		if step.Dwell.Duration <= 0 {
+			allErrs = append(allErrs, field.Invalid(idx.Child("dwell"), step.Dwell.Duration.String(), "must be positive"))
+		}
+	}
+
+	return allErrs
+}
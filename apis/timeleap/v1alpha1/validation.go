@@ -0,0 +1,226 @@
+// Copyright 2020 The kube-timeleap Authors.
+// SPDX-License-Identifier: BSD-3-Clause
+
+package v1alpha1
+
+import (
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	metav1validation "k8s.io/apimachinery/pkg/apis/meta/v1/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// List of the bounds of the TimeLeap spec.
+const (
+	// MaxOffset is the maximum distance of the virtual time from the real time.
+	MaxOffset = 100 * 365 * Day
+
+	// MinRate is the minimum rate of the virtual clock, a second every day.
+	MinRate = 1.0 / 86400
+
+	// MaxRate is the maximum rate of the virtual clock, a day every second.
+	MaxRate = 86400.0
+)
+
+// validateSpec validates the spec at path, with the real time now.
+func validateSpec(spec *TimeLeapSpec, path *field.Path, now time.Time) field.ErrorList {
+	var allErrs field.ErrorList
+
+	allErrs = append(allErrs, validateSelector(&spec.Selector, path.Child("selector"))...)
+	allErrs = append(allErrs, validateMode(spec.Mode, path.Child("mode"))...)
+	allErrs = append(allErrs, validateTarget(spec.Offset, spec.Time, path, now)...)
+	allErrs = append(allErrs, validateRate(spec.Rate, path.Child("rate"))...)
+	allErrs = append(allErrs, validateClocks(spec.Clocks, path.Child("clocks"))...)
+	allErrs = append(allErrs, validateSlew(spec.Mode, spec.Slew, spec.Rate, path.Child("slew"))...)
+	allErrs = append(allErrs, validateSkew(spec.Skew, path.Child("skew"))...)
+	allErrs = append(allErrs, validateEpoch(spec.Epoch, path.Child("epoch"))...)
+
+	if spec.TTL != nil && spec.TTL.Duration <= 0 {
+		allErrs = append(allErrs, field.Invalid(path.Child("ttl"), spec.TTL.Duration.String(), "must be positive"))
+	}
+
+	return allErrs
+}
+
+// validateSelector validates the pod selector at path.
+func validateSelector(selector *metav1.LabelSelector, path *field.Path) field.ErrorList {
+	if len(selector.MatchLabels)+len(selector.MatchExpressions) == 0 {
+		return field.ErrorList{field.Required(path, "an empty selector would select every pod in the namespace")}
+	}
+
+	return metav1validation.ValidateLabelSelector(selector, path)
+}
+
+// validateMode validates the mode at path.
+func validateMode(mode TimeLeapMode, path *field.Path) field.ErrorList {
+	switch mode {
+	case "", OffsetMode, FreezeMode, SlewMode:
+		return nil
+	default:
+		return field.ErrorList{field.NotSupported(path, mode, []string{string(OffsetMode), string(FreezeMode), string(SlewMode)})}
+	}
+}
+
+// validateTarget validates the offset and time fields under path, with the real time now.
+func validateTarget(offset string, t *metav1.Time, path *field.Path, now time.Time) field.ErrorList {
+	switch {
+	case offset != "" && t != nil:
+		return field.ErrorList{field.Forbidden(path.Child("time"), "offset and time are mutually exclusive")}
+	case offset == "" && t == nil:
+		return field.ErrorList{field.Required(path.Child("offset"), "either offset or time is required")}
+	case offset != "":
+		return validateOffset(offset, path.Child("offset"))
+	default:
+		if d := t.Sub(now); d > MaxOffset || d < -MaxOffset {
+			return field.ErrorList{field.Invalid(path.Child("time"), t.UTC().Format(time.RFC3339),
+				fmt.Sprintf("must be within %dd of the current time", MaxOffset/Day))}
+		}
+		return nil
+	}
+}
+
+// validateRate validates the rate at path.
+func validateRate(rate string, path *field.Path) field.ErrorList {
+	r, err := ParseRate(rate)
+	if err != nil {
+		return field.ErrorList{field.Invalid(path, rate, err.Error())}
+	}
+	if r < MinRate || r > MaxRate {
+		return field.ErrorList{field.Invalid(path, rate, fmt.Sprintf("must be between %g and %g", MinRate, MaxRate))}
+	}
+
+	return nil
+}
+
+// validateClocks validates the clocks at path.
+func validateClocks(clocks []ClockSpec, path *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	seen := make(map[ClockID]bool, len(clocks))
+	for i, c := range clocks {
+		idx := path.Index(i)
+		switch c.ID {
+		case ClockRealtime, ClockMonotonic, ClockBoottime:
+		default:
+			allErrs = append(allErrs, field.NotSupported(idx.Child("id"), c.ID, []string{string(ClockRealtime), string(ClockMonotonic), string(ClockBoottime)}))
+		}
+		if seen[c.ID] {
+			allErrs = append(allErrs, field.Duplicate(idx.Child("id"), c.ID))
+		}
+		seen[c.ID] = true
+
+		if c.Offset != "" {
+			allErrs = append(allErrs, validateOffset(c.Offset, idx.Child("offset"))...)
+		}
+	}
+
+	return allErrs
+}
+
+// validateSlew validates the slew at path for the mode and the rate.
+func validateSlew(mode TimeLeapMode, slew *SlewSpec, rate string, path *field.Path) field.ErrorList {
+	if slew == nil {
+		return nil
+	}
+	if mode != SlewMode {
+		return field.ErrorList{field.Forbidden(path, fmt.Sprintf("slew is only allowed in the %s mode", SlewMode))}
+	}
+
+	var allErrs field.ErrorList
+	if slew.Period != nil && slew.Period.Duration <= 0 {
+		allErrs = append(allErrs, field.Invalid(path.Child("period"), slew.Period.Duration.String(), "must be positive"))
+	}
+	if slew.MaxRate != "" {
+		// the clock slows down to the rate minus the max rate, the invalid rate is reported by validateRate
+		if r, err := ParseRate(slew.MaxRate); err != nil {
+			allErrs = append(allErrs, field.Invalid(path.Child("maxRate"), slew.MaxRate, err.Error()))
+		} else if clockRate, err := ParseRate(rate); err == nil && r >= clockRate {
+			allErrs = append(allErrs, field.Invalid(path.Child("maxRate"), slew.MaxRate, fmt.Sprintf("must be below the rate %g, or the clock would go backwards", clockRate)))
+		}
+	}
+
+	return allErrs
+}
+
+// validateSkew validates the skew at path.
+func validateSkew(skew *SkewSpec, path *field.Path) field.ErrorList {
+	if skew == nil {
+		return nil
+	}
+
+	allErrs := validateOffset(skew.Min, path.Child("min"))
+	allErrs = append(allErrs, validateOffset(skew.Max, path.Child("max"))...)
+	if len(allErrs) > 0 {
+		return allErrs
+	}
+
+	lower, _ := ParseOffset(skew.Min)
+	upper, _ := ParseOffset(skew.Max)
+	if lower > upper {
+		allErrs = append(allErrs, field.Invalid(path.Child("max"), skew.Max, fmt.Sprintf("must not be less than min %s", skew.Min)))
+	}
+
+	return allErrs
+}
+
+// validateOffset validates the offset string at path.
+func validateOffset(offset string, path *field.Path) field.ErrorList {
+	d, err := ParseOffset(offset)
+	if err != nil {
+		return field.ErrorList{field.Invalid(path, offset, err.Error())}
+	}
+	if d > MaxOffset || d < -MaxOffset {
+		return field.ErrorList{field.Invalid(path, offset, fmt.Sprintf("must be within %dd", MaxOffset/Day))}
+	}
+
+	return nil
+}
+
+// validateEpoch validates the shared epoch at path.
+func validateEpoch(ep *EpochSpec, path *field.Path) field.ErrorList {
+	if ep == nil {
+		return nil
+	}
+
+	var allErrs field.ErrorList
+	if ep.Time.Before(&ep.Origin) {
+		allErrs = append(allErrs, field.Invalid(path.Child("time"), ep.Time, "must not be before the origin"))
+	}
+	if ep.Drift != "" {
+		if _, err := ParseOffset(ep.Drift); err != nil {
+			allErrs = append(allErrs, field.Invalid(path.Child("drift"), ep.Drift, err.Error()))
+		}
+	}
+
+	return allErrs
+}
+
+// validateSpecUpdate validates the update of the spec at path from old.
+func validateSpecUpdate(spec, old *TimeLeapSpec, expired bool, path *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	if expired {
+		if !equality.Semantic.DeepEqual(spec, old) {
+			allErrs = append(allErrs, field.Forbidden(path, "the spec of an expired TimeLeap is immutable"))
+		}
+		return allErrs
+	}
+
+	if modeOf(spec) != modeOf(old) {
+		allErrs = append(allErrs, field.Forbidden(path.Child("mode"), fmt.Sprintf("cannot switch the mode of a running TimeLeap from %s to %s, create a new TimeLeap instead", modeOf(old), modeOf(spec))))
+	}
+
+	return allErrs
+}
+
+// modeOf returns the mode of spec with the default applied.
+func modeOf(spec *TimeLeapSpec) TimeLeapMode {
+	if spec.Mode == "" {
+		return OffsetMode
+	}
+
+	return spec.Mode
+}
@@ -0,0 +1,287 @@
+// Copyright 2020 The kube-timeleap Authors.
+// SPDX-License-Identifier: BSD-3-Clause
+
+package v1alpha1
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+func validSpec() TimeLeapSpec {
+	return TimeLeapSpec{
+		Selector: metav1.LabelSelector{MatchLabels: map[string]string{"app": "sample"}},
+		Offset:   "+72h",
+	}
+}
+
+func TestValidateSpec(t *testing.T) {
+	now := time.Date(2020, time.October, 1, 0, 0, 0, 0, time.UTC)
+	far := metav1.NewTime(now.Add(200 * 365 * Day))
+	near := metav1.NewTime(now.Add(Week))
+
+	tests := []struct {
+		name   string
+		mutate func(*TimeLeapSpec)
+		want   []string // field paths of the errors
+	}{
+		{
+			name:   "Valid",
+			mutate: func(*TimeLeapSpec) {},
+		},
+		{
+			name: "ValidTime",
+			mutate: func(s *TimeLeapSpec) {
+				s.Offset = ""
+				s.Time = &near
+			},
+		},
+		{
+			name: "EmptySelector",
+			mutate: func(s *TimeLeapSpec) {
+				s.Selector = metav1.LabelSelector{}
+			},
+			want: []string{"spec.selector"},
+		},
+		{
+			name: "InvalidSelector",
+			mutate: func(s *TimeLeapSpec) {
+				s.Selector.MatchExpressions = []metav1.LabelSelectorRequirement{{Key: "app", Operator: "Like"}}
+			},
+			want: []string{"spec.selector.matchExpressions[0].operator"},
+		},
+		{
+			name: "OffsetAndTime",
+			mutate: func(s *TimeLeapSpec) {
+				s.Time = &near
+			},
+			want: []string{"spec.time"},
+		},
+		{
+			name: "NoOffsetNorTime",
+			mutate: func(s *TimeLeapSpec) {
+				s.Offset = ""
+			},
+			want: []string{"spec.offset"},
+		},
+		{
+			name: "MalformedOffset",
+			mutate: func(s *TimeLeapSpec) {
+				s.Offset = "+72x"
+			},
+			want: []string{"spec.offset"},
+		},
+		{
+			name: "AbsurdOffset",
+			mutate: func(s *TimeLeapSpec) {
+				s.Offset = "-40000d"
+			},
+			want: []string{"spec.offset"},
+		},
+		{
+			name: "AbsurdTime",
+			mutate: func(s *TimeLeapSpec) {
+				s.Offset = ""
+				s.Time = &far
+			},
+			want: []string{"spec.time"},
+		},
+		{
+			name: "NegativeRate",
+			mutate: func(s *TimeLeapSpec) {
+				s.Rate = "-1"
+			},
+			want: []string{"spec.rate"},
+		},
+		{
+			name: "AbsurdRate",
+			mutate: func(s *TimeLeapSpec) {
+				s.Rate = "1000000"
+			},
+			want: []string{"spec.rate"},
+		},
+		{
+			name: "Clocks",
+			mutate: func(s *TimeLeapSpec) {
+				s.Clocks = []ClockSpec{
+					{ID: ClockRealtime},
+					{ID: ClockRealtime},
+					{ID: "CLOCK_TAI"},
+					{ID: ClockMonotonic, Offset: "1y"},
+				}
+			},
+			want: []string{"spec.clocks[1].id", "spec.clocks[2].id", "spec.clocks[3].offset"},
+		},
+		{
+			name: "NonPositiveTTL",
+			mutate: func(s *TimeLeapSpec) {
+				s.TTL = &metav1.Duration{}
+			},
+			want: []string{"spec.ttl"},
+		},
+		{
+			name: "ValidSlew",
+			mutate: func(s *TimeLeapSpec) {
+				s.Mode = SlewMode
+				s.Slew = &SlewSpec{Period: &metav1.Duration{Duration: time.Hour}, MaxRate: "0.1"}
+			},
+		},
+		{
+			name: "SlewOutsideSlewMode",
+			mutate: func(s *TimeLeapSpec) {
+				s.Slew = &SlewSpec{MaxRate: "0.1"}
+			},
+			want: []string{"spec.slew"},
+		},
+		{
+			name: "InvalidSlew",
+			mutate: func(s *TimeLeapSpec) {
+				s.Mode = SlewMode
+				s.Slew = &SlewSpec{Period: &metav1.Duration{}, MaxRate: "1"}
+			},
+			want: []string{"spec.slew.period", "spec.slew.maxRate"},
+		},
+		{
+			name: "SlewAboveRate",
+			mutate: func(s *TimeLeapSpec) {
+				s.Mode = SlewMode
+				s.Rate = "0.5"
+				s.Slew = &SlewSpec{MaxRate: "0.5"}
+			},
+			want: []string{"spec.slew.maxRate"},
+		},
+		{
+			name: "ValidSkew",
+			mutate: func(s *TimeLeapSpec) {
+				s.Skew = &SkewSpec{Min: "-1s", Max: "+1s", Seed: 7}
+			},
+		},
+		{
+			name: "InvertedSkew",
+			mutate: func(s *TimeLeapSpec) {
+				s.Skew = &SkewSpec{Min: "+1s", Max: "-1s"}
+			},
+			want: []string{"spec.skew.max"},
+		},
+		{
+			name: "InvalidSkew",
+			mutate: func(s *TimeLeapSpec) {
+				s.Skew = &SkewSpec{Min: "soon", Max: "+40000d"}
+			},
+			want: []string{"spec.skew.min", "spec.skew.max"},
+		},
+		{
+			name: "ValidEpoch",
+			mutate: func(s *TimeLeapSpec) {
+				s.Epoch = &EpochSpec{Time: metav1.NewMicroTime(now), Origin: metav1.NewMicroTime(now.Add(-time.Hour)), Drift: "+1h"}
+			},
+		},
+		{
+			name: "InvalidEpoch",
+			mutate: func(s *TimeLeapSpec) {
+				s.Epoch = &EpochSpec{Time: metav1.NewMicroTime(now.Add(-time.Hour)), Origin: metav1.NewMicroTime(now), Drift: "soon"}
+			},
+			want: []string{"spec.epoch.time", "spec.epoch.drift"},
+		},
+		{
+			name: "EveryError",
+			mutate: func(s *TimeLeapSpec) {
+				s.Selector = metav1.LabelSelector{}
+				s.Mode = "Rewind"
+				s.Offset = "soon"
+				s.Rate = "0"
+			},
+			want: []string{"spec.selector", "spec.mode", "spec.offset", "spec.rate"},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			spec := validSpec()
+			tt.mutate(&spec)
+
+			if diff := cmp.Diff(tt.want, errorFields(validateSpec(&spec, field.NewPath("spec"), now))); diff != "" {
+				t.Fatalf("(-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestTimeLeap_ValidateUpdate(t *testing.T) {
+	tests := []struct {
+		name    string
+		expired bool
+		mutate  func(*TimeLeap)
+		wantErr bool
+	}{
+		{
+			name: "Offset",
+			mutate: func(tl *TimeLeap) {
+				tl.Spec.Offset = "+24h"
+			},
+		},
+		{
+			name: "Mode",
+			mutate: func(tl *TimeLeap) {
+				tl.Spec.Mode = FreezeMode
+			},
+			wantErr: true,
+		},
+		{
+			name: "DefaultMode",
+			mutate: func(tl *TimeLeap) {
+				tl.Spec.Mode = OffsetMode
+			},
+		},
+		{
+			name:    "Expired",
+			expired: true,
+			mutate: func(tl *TimeLeap) {
+				tl.Spec.Offset = "+24h"
+			},
+			wantErr: true,
+		},
+		{
+			name:    "ExpiredMetadata",
+			expired: true,
+			mutate: func(tl *TimeLeap) {
+				tl.Finalizers = nil
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			old := &TimeLeap{
+				ObjectMeta: metav1.ObjectMeta{Name: "leap", Finalizers: []string{Finalizer}},
+				Spec:       validSpec(),
+			}
+			if tt.expired {
+				old.Status.Conditions = []metav1.Condition{{Type: ConditionExpired, Status: metav1.ConditionTrue}}
+			}
+			tl := old.DeepCopy()
+			tt.mutate(tl)
+
+			if err := tl.ValidateUpdate(old); (err != nil) != tt.wantErr {
+				t.Fatalf("ValidateUpdate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func errorFields(errs field.ErrorList) []string {
+	var fields []string
+	for _, err := range errs {
+		fields = append(fields, err.Field)
+	}
+
+	return fields
+}
@@ -8,16 +8,259 @@
 package v1alpha1
 
 import (
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClockSpec) DeepCopyInto(out *ClockSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClockSpec.
+func (in *ClockSpec) DeepCopy() *ClockSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ClockSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterTimeLeap) DeepCopyInto(out *ClusterTimeLeap) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterTimeLeap.
+func (in *ClusterTimeLeap) DeepCopy() *ClusterTimeLeap {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterTimeLeap)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ClusterTimeLeap) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterTimeLeapList) DeepCopyInto(out *ClusterTimeLeapList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]ClusterTimeLeap, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterTimeLeapList.
+func (in *ClusterTimeLeapList) DeepCopy() *ClusterTimeLeapList {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterTimeLeapList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ClusterTimeLeapList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterTimeLeapSpec) DeepCopyInto(out *ClusterTimeLeapSpec) {
+	*out = *in
+	in.NamespaceSelector.DeepCopyInto(&out.NamespaceSelector)
+	in.PodSelector.DeepCopyInto(&out.PodSelector)
+	if in.Time != nil {
+		in, out := &in.Time, &out.Time
+		*out = (*in).DeepCopy()
+	}
+	if in.Slew != nil {
+		in, out := &in.Slew, &out.Slew
+		*out = new(SlewSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Skew != nil {
+		in, out := &in.Skew, &out.Skew
+		*out = new(SkewSpec)
+		**out = **in
+	}
+	if in.Clocks != nil {
+		in, out := &in.Clocks, &out.Clocks
+		*out = make([]ClockSpec, len(*in))
+		copy(*out, *in)
+	}
+	if in.TTL != nil {
+		in, out := &in.TTL, &out.TTL
+		*out = new(v1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterTimeLeapSpec.
+func (in *ClusterTimeLeapSpec) DeepCopy() *ClusterTimeLeapSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterTimeLeapSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterTimeLeapStatus) DeepCopyInto(out *ClusterTimeLeapStatus) {
+	*out = *in
+	if in.FrozenAt != nil {
+		in, out := &in.FrozenAt, &out.FrozenAt
+		*out = (*in).DeepCopy()
+	}
+	if in.ExpirationTime != nil {
+		in, out := &in.ExpirationTime, &out.ExpirationTime
+		*out = (*in).DeepCopy()
+	}
+	if in.Epoch != nil {
+		in, out := &in.Epoch, &out.Epoch
+		*out = new(VirtualEpoch)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Namespaces != nil {
+		in, out := &in.Namespaces, &out.Namespaces
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterTimeLeapStatus.
+func (in *ClusterTimeLeapStatus) DeepCopy() *ClusterTimeLeapStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterTimeLeapStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EpochSpec) DeepCopyInto(out *EpochSpec) {
+	*out = *in
+	in.Time.DeepCopyInto(&out.Time)
+	in.Origin.DeepCopyInto(&out.Origin)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EpochSpec.
+func (in *EpochSpec) DeepCopy() *EpochSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(EpochSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PodResult) DeepCopyInto(out *PodResult) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PodResult.
+func (in *PodResult) DeepCopy() *PodResult {
+	if in == nil {
+		return nil
+	}
+	out := new(PodResult)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ScheduleStep) DeepCopyInto(out *ScheduleStep) {
+	*out = *in
+	if in.Time != nil {
+		in, out := &in.Time, &out.Time
+		*out = (*in).DeepCopy()
+	}
+	out.Dwell = in.Dwell
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ScheduleStep.
+func (in *ScheduleStep) DeepCopy() *ScheduleStep {
+	if in == nil {
+		return nil
+	}
+	out := new(ScheduleStep)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SkewSpec) DeepCopyInto(out *SkewSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SkewSpec.
+func (in *SkewSpec) DeepCopy() *SkewSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(SkewSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SlewSpec) DeepCopyInto(out *SlewSpec) {
+	*out = *in
+	if in.Period != nil {
+		in, out := &in.Period, &out.Period
+		*out = new(v1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SlewSpec.
+func (in *SlewSpec) DeepCopy() *SlewSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(SlewSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *TimeLeap) DeepCopyInto(out *TimeLeap) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
-	out.Spec = in.Spec
-	out.Status = in.Status
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TimeLeap.
@@ -70,9 +313,170 @@ func (in *TimeLeapList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TimeLeapSchedule) DeepCopyInto(out *TimeLeapSchedule) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TimeLeapSchedule.
+func (in *TimeLeapSchedule) DeepCopy() *TimeLeapSchedule {
+	if in == nil {
+		return nil
+	}
+	out := new(TimeLeapSchedule)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *TimeLeapSchedule) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TimeLeapScheduleList) DeepCopyInto(out *TimeLeapScheduleList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]TimeLeapSchedule, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TimeLeapScheduleList.
+func (in *TimeLeapScheduleList) DeepCopy() *TimeLeapScheduleList {
+	if in == nil {
+		return nil
+	}
+	out := new(TimeLeapScheduleList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *TimeLeapScheduleList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TimeLeapScheduleSpec) DeepCopyInto(out *TimeLeapScheduleSpec) {
+	*out = *in
+	in.Selector.DeepCopyInto(&out.Selector)
+	if in.Slew != nil {
+		in, out := &in.Slew, &out.Slew
+		*out = new(SlewSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Skew != nil {
+		in, out := &in.Skew, &out.Skew
+		*out = new(SkewSpec)
+		**out = **in
+	}
+	if in.Clocks != nil {
+		in, out := &in.Clocks, &out.Clocks
+		*out = make([]ClockSpec, len(*in))
+		copy(*out, *in)
+	}
+	if in.Steps != nil {
+		in, out := &in.Steps, &out.Steps
+		*out = make([]ScheduleStep, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TimeLeapScheduleSpec.
+func (in *TimeLeapScheduleSpec) DeepCopy() *TimeLeapScheduleSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(TimeLeapScheduleSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TimeLeapScheduleStatus) DeepCopyInto(out *TimeLeapScheduleStatus) {
+	*out = *in
+	if in.StepStartTime != nil {
+		in, out := &in.StepStartTime, &out.StepStartTime
+		*out = (*in).DeepCopy()
+	}
+	if in.NextStepTime != nil {
+		in, out := &in.NextStepTime, &out.NextStepTime
+		*out = (*in).DeepCopy()
+	}
+	if in.CompletionTime != nil {
+		in, out := &in.CompletionTime, &out.CompletionTime
+		*out = (*in).DeepCopy()
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TimeLeapScheduleStatus.
+func (in *TimeLeapScheduleStatus) DeepCopy() *TimeLeapScheduleStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(TimeLeapScheduleStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *TimeLeapSpec) DeepCopyInto(out *TimeLeapSpec) {
 	*out = *in
+	in.Selector.DeepCopyInto(&out.Selector)
+	if in.Time != nil {
+		in, out := &in.Time, &out.Time
+		*out = (*in).DeepCopy()
+	}
+	if in.Slew != nil {
+		in, out := &in.Slew, &out.Slew
+		*out = new(SlewSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Skew != nil {
+		in, out := &in.Skew, &out.Skew
+		*out = new(SkewSpec)
+		**out = **in
+	}
+	if in.Clocks != nil {
+		in, out := &in.Clocks, &out.Clocks
+		*out = make([]ClockSpec, len(*in))
+		copy(*out, *in)
+	}
+	if in.TTL != nil {
+		in, out := &in.TTL, &out.TTL
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.Epoch != nil {
+		in, out := &in.Epoch, &out.Epoch
+		*out = new(EpochSpec)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TimeLeapSpec.
@@ -88,6 +492,31 @@ func (in *TimeLeapSpec) DeepCopy() *TimeLeapSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *TimeLeapStatus) DeepCopyInto(out *TimeLeapStatus) {
 	*out = *in
+	if in.FrozenAt != nil {
+		in, out := &in.FrozenAt, &out.FrozenAt
+		*out = (*in).DeepCopy()
+	}
+	if in.ExpirationTime != nil {
+		in, out := &in.ExpirationTime, &out.ExpirationTime
+		*out = (*in).DeepCopy()
+	}
+	if in.Epoch != nil {
+		in, out := &in.Epoch, &out.Epoch
+		*out = new(VirtualEpoch)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Pods != nil {
+		in, out := &in.Pods, &out.Pods
+		*out = make([]PodResult, len(*in))
+		copy(*out, *in)
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TimeLeapStatus.
@@ -99,3 +528,24 @@ func (in *TimeLeapStatus) DeepCopy() *TimeLeapStatus {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtualEpoch) DeepCopyInto(out *VirtualEpoch) {
+	*out = *in
+	in.Time.DeepCopyInto(&out.Time)
+	in.Origin.DeepCopyInto(&out.Origin)
+	if in.SuspendedAt != nil {
+		in, out := &in.SuspendedAt, &out.SuspendedAt
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtualEpoch.
+func (in *VirtualEpoch) DeepCopy() *VirtualEpoch {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtualEpoch)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -4,6 +4,7 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"os"
 
@@ -41,6 +42,7 @@ func init() {
 var (
 	flagMetricsAddr          string
 	flagEnableLeaderElection bool
+	flagAgentImage           string
 )
 
 const (
@@ -50,6 +52,9 @@ const (
 
 	flagEnableLeaderElectionName = "enable-leader-election"
 	flagEnableLeaderElectioUsage = "Enable leader election for controller manager. Enabling this will ensure there is only one active controller manager."
+
+	flagAgentImageName  = "agent-image"
+	flagAgentImageUsage = "The image of the time-leap agent container injected into the opted-in pods, pinned to a tag or digest. Required."
 )
 
 const (
@@ -61,6 +66,7 @@ const (
 func main() {
 	flag.StringVar(&flagMetricsAddr, flagMetricsAddrName, flagMetricsAddrValue, flagMetricsAddrUsage)
 	flag.BoolVar(&flagEnableLeaderElection, flagEnableLeaderElectionName, false, flagEnableLeaderElectioUsage)
+	flag.StringVar(&flagAgentImage, flagAgentImageName, "", flagAgentImageUsage)
 	flag.Parse()
 
 	env, err := config.Process()
@@ -72,6 +78,12 @@ func main() {
 	logger := logging.NewLogger(env.Debug)
 	logf.SetLogger(logger)
 
+	// the injected pods never start without a pullable agent image, so refuse to guess one
+	if flagAgentImage == "" {
+		setupLog.Error(errors.New("--"+flagAgentImageName+" is not set"), "unable to inject the time-leap agent")
+		os.Exit(1)
+	}
+
 	mgr, err := manager.New(crconfig.GetConfigOrDie(), manager.Options{
 		Scheme:             scheme,
 		MetricsBindAddress: flagMetricsAddr,
@@ -85,6 +97,8 @@ func main() {
 		os.Exit(1)
 	}
 
+	policy := injectorv1alpha1.NewNamespacePolicy(env.InjectionLabel, env.PodNamespace, env.ExcludedNamespaces...)
+
 	if err := (&timeleapcontrollers.TimeLeapReconciler{
 		Client: mgr.GetClient(),
 		Reader: mgr.GetAPIReader(),
@@ -94,15 +108,42 @@ func main() {
 		setupLog.Error(err, "unable to create controller", "controller", "TimeLeap")
 		os.Exit(1)
 	}
+	if err := (&timeleapcontrollers.ClusterTimeLeapReconciler{
+		Client: mgr.GetClient(),
+		Log:    logf.Log.WithName("controllers").WithName("timeleap").WithName("ClusterTimeLeap"),
+		Scheme: mgr.GetScheme(),
+		Policy: policy,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "ClusterTimeLeap")
+		os.Exit(1)
+	}
+	if err := (&timeleapcontrollers.TimeLeapScheduleReconciler{
+		Client: mgr.GetClient(),
+		Log:    logf.Log.WithName("controllers").WithName("timeleap").WithName("TimeLeapSchedule"),
+		Scheme: mgr.GetScheme(),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "TimeLeapSchedule")
+		os.Exit(1)
+	}
 	if err := (&timeleapv1alpha1.TimeLeap{}).SetupWebhookWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create webhook", "webhook", "TimeLeap")
 		os.Exit(1)
 	}
+	if err := (&timeleapv1alpha1.ClusterTimeLeap{}).SetupWebhookWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create webhook", "webhook", "ClusterTimeLeap")
+		os.Exit(1)
+	}
+	if err := (&timeleapv1alpha1.TimeLeapSchedule{}).SetupWebhookWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create webhook", "webhook", "TimeLeapSchedule")
+		os.Exit(1)
+	}
 	// +kubebuilder:scaffold:builder
 
 	podInjector := &admission.Webhook{
 		Handler: &injectorv1alpha1.Pod{
-			Client: mgr.GetClient(),
+			Client:     mgr.GetClient(),
+			AgentImage: flagAgentImage,
+			Policy:     policy,
 		},
 	}
 	podInjector.InjectLogger(logf.Log.WithName("injector").WithName("Pod"))
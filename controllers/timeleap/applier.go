@@ -0,0 +1,107 @@
+// Copyright 2020 The kube-timeleap Authors.
+// SPDX-License-Identifier: BSD-3-Clause
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	timeleapv1alpha1 "github.com/zchee/kube-timeleap/apis/timeleap/v1alpha1"
+	"github.com/zchee/kube-timeleap/pkg/vclock"
+)
+
+// Leap is the virtual clocks applied to a pod by a TimeLeap.
+type Leap struct {
+	// TimeLeap is the name of the TimeLeap which drives the clocks.
+	TimeLeap string
+
+	// SpecHash is the hash of the TimeLeap spec fields the clocks derive from.
+	SpecHash string
+
+	// Clocks is the virtual clocks.
+	Clocks vclock.Set
+
+	// Skew is the offset assigned to the pod by the skew of the TimeLeap, as formatted by
+	// timeleapv1alpha1.FormatOffset. It's empty without a skew.
+	Skew string
+}
+
+// Applier applies the virtual clocks to the pods on their nodes.
+type Applier interface {
+	// Applied returns the leap applied to the pod, or nil if the pod sees the real time.
+	Applied(pod *corev1.Pod) (*Leap, error)
+
+	// Apply applies the leap to the pod.
+	Apply(ctx context.Context, pod *corev1.Pod, leap *Leap) error
+
+	// Restore restores the real time on the pod.
+	Restore(ctx context.Context, pod *corev1.Pod) error
+}
+
+// AnnotationApplier is the Applier which hands the virtual clocks to the time-leap agent of the pod through
+// the pod annotations, which the agent reads from the downward API.
+type AnnotationApplier struct {
+	Client client.Client
+}
+
+// compile time check whether the AnnotationApplier implements Applier interface.
+var _ Applier = (*AnnotationApplier)(nil)
+
+// Applied implements Applier.
+func (a *AnnotationApplier) Applied(pod *corev1.Pod) (*Leap, error) {
+	name := pod.Annotations[timeleapv1alpha1.TimeLeapAnnotation]
+	data := pod.Annotations[timeleapv1alpha1.ClocksAnnotation]
+	if name == "" || data == "" {
+		return nil, nil
+	}
+
+	leap := &Leap{
+		TimeLeap: name,
+		SpecHash: pod.Annotations[timeleapv1alpha1.SpecHashAnnotation],
+		Skew:     pod.Annotations[timeleapv1alpha1.SkewAnnotation],
+	}
+	if err := json.Unmarshal([]byte(data), &leap.Clocks); err != nil {
+		return nil, fmt.Errorf("invalid %s annotation: %w", timeleapv1alpha1.ClocksAnnotation, err)
+	}
+
+	return leap, nil
+}
+
+// Apply implements Applier.
+func (a *AnnotationApplier) Apply(ctx context.Context, pod *corev1.Pod, leap *Leap) error {
+	data, err := json.Marshal(leap.Clocks)
+	if err != nil {
+		return fmt.Errorf("encode clocks: %w", err)
+	}
+
+	patch := client.MergeFrom(pod.DeepCopy())
+	if pod.Annotations == nil {
+		pod.Annotations = make(map[string]string)
+	}
+	pod.Annotations[timeleapv1alpha1.TimeLeapAnnotation] = leap.TimeLeap
+	pod.Annotations[timeleapv1alpha1.SpecHashAnnotation] = leap.SpecHash
+	pod.Annotations[timeleapv1alpha1.ClocksAnnotation] = string(data)
+	if leap.Skew != "" {
+		pod.Annotations[timeleapv1alpha1.SkewAnnotation] = leap.Skew
+	} else {
+		delete(pod.Annotations, timeleapv1alpha1.SkewAnnotation)
+	}
+
+	return a.Client.Patch(ctx, pod, patch)
+}
+
+// Restore implements Applier.
+func (a *AnnotationApplier) Restore(ctx context.Context, pod *corev1.Pod) error {
+	patch := client.MergeFrom(pod.DeepCopy())
+	delete(pod.Annotations, timeleapv1alpha1.TimeLeapAnnotation)
+	delete(pod.Annotations, timeleapv1alpha1.SpecHashAnnotation)
+	delete(pod.Annotations, timeleapv1alpha1.ClocksAnnotation)
+	delete(pod.Annotations, timeleapv1alpha1.SkewAnnotation)
+
+	return a.Client.Patch(ctx, pod, patch)
+}
@@ -0,0 +1,261 @@
+// Copyright 2020 The kube-timeleap Authors.
+// SPDX-License-Identifier: BSD-3-Clause
+
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	timeleapv1alpha1 "github.com/zchee/kube-timeleap/apis/timeleap/v1alpha1"
+	"github.com/zchee/kube-timeleap/pkg/vclock"
+)
+
+// specHash returns the hash of the spec fields the virtual clocks of tl derive from.
+//
+// The rate is deliberately excluded, a rate change continues the applied clocks instead of starting over. So
+// is the shared epoch but its origin, which moves on the rate change of the owner.
+func specHash(tl *timeleapv1alpha1.TimeLeap, frozenAt *metav1.Time) string {
+	var origin *metav1.MicroTime
+	if ep := tl.Spec.Epoch; ep != nil {
+		origin = &ep.Origin
+	}
+
+	h := fnv.New32a()
+	_ = json.NewEncoder(h).Encode(struct {
+		Mode     timeleapv1alpha1.TimeLeapMode
+		Offset   string
+		Time     *metav1.Time
+		Clocks   []timeleapv1alpha1.ClockSpec
+		Slew     *timeleapv1alpha1.SlewSpec
+		Skew     *timeleapv1alpha1.SkewSpec
+		FrozenAt *metav1.Time
+		Origin   *metav1.MicroTime `json:",omitempty"`
+	}{
+		Mode:     tl.Spec.Mode,
+		Offset:   tl.Spec.Offset,
+		Time:     tl.Spec.Time,
+		Clocks:   tl.Spec.Clocks,
+		Slew:     tl.Spec.Slew,
+		Skew:     tl.Spec.Skew,
+		FrozenAt: frozenAt,
+		Origin:   origin,
+	})
+
+	return fmt.Sprintf("%08x", h.Sum32())
+}
+
+// virtualEpoch returns the epoch the virtual clocks of every pod targeted by tl are anchored at.
+//
+// The epoch shared by the owner of tl is taken as is. Otherwise it's chosen by nextEpoch.
+func virtualEpoch(tl *timeleapv1alpha1.TimeLeap, hash string, now time.Time) (*timeleapv1alpha1.VirtualEpoch, error) {
+	shared := tl.Spec.Epoch
+	if shared == nil {
+		return nextEpoch(tl.Status.Epoch, hash, tl.Spec.Rate, tl.Spec.IsFrozen(), tl.Spec.Suspend, now)
+	}
+
+	ep := &timeleapv1alpha1.VirtualEpoch{
+		Time:     shared.Time,
+		Origin:   shared.Origin,
+		Drift:    shared.Drift,
+		Rate:     tl.Spec.Rate,
+		SpecHash: hash,
+	}
+	if tl.Spec.Suspend {
+		// the owner keeps the epoch running, so the virtual time does not stand still while suspended
+		at := metav1.NewMicroTime(now.Truncate(time.Microsecond))
+		ep.SuspendedAt = &at
+		if prev := tl.Status.Epoch; prev != nil && prev.SuspendedAt != nil {
+			ep.SuspendedAt = prev.SuspendedAt
+		}
+	}
+
+	return ep, nil
+}
+
+// nextEpoch returns the epoch following prev for the spec of hash at rate.
+//
+// A new epoch is chosen at now when the spec hash changes. A rate change moves the epoch to now and
+// accumulates the offset gained at the previous rate in the drift, so the pods applied afterwards continue
+// the virtual time of the pods applied before. Resuming a suspended spec moves the epoch likewise and takes
+// the suspended span out of the drift, unless it runs at the real-time rate. The epoch of a frozen spec never
+// moves.
+func nextEpoch(prev *timeleapv1alpha1.VirtualEpoch, hash, rateValue string, frozen, suspend bool, now time.Time) (*timeleapv1alpha1.VirtualEpoch, error) {
+	// the epoch is stored in microseconds, so choose one the status can represent
+	at := metav1.NewMicroTime(now.Truncate(time.Microsecond))
+
+	if prev == nil || prev.SpecHash != hash {
+		ep := &timeleapv1alpha1.VirtualEpoch{
+			Time:     at,
+			Origin:   at,
+			Rate:     rateValue,
+			SpecHash: hash,
+		}
+		if suspend {
+			ep.SuspendedAt = &at
+		}
+		return ep, nil
+	}
+	if suspend {
+		if prev.SuspendedAt != nil {
+			return prev, nil
+		}
+		ep := prev.DeepCopy()
+		ep.SuspendedAt = &at
+		return ep, nil
+	}
+
+	prevRate, err := timeleapv1alpha1.ParseRate(prev.Rate)
+	if err != nil {
+		return nil, fmt.Errorf("epoch: %w", err)
+	}
+	rate, err := timeleapv1alpha1.ParseRate(rateValue)
+	if err != nil {
+		return nil, err
+	}
+	resumed := prev.SuspendedAt != nil
+	if !resumed && (frozen || rate == prevRate) {
+		return prev, nil
+	}
+	if frozen {
+		ep := prev.DeepCopy()
+		ep.SuspendedAt = nil
+		return ep, nil
+	}
+
+	drift, err := epochDrift(prev)
+	if err != nil {
+		return nil, err
+	}
+	until := at.Time
+	if resumed {
+		until = prev.SuspendedAt.Time
+		if prevRate != 1 {
+			// the virtual clocks stood still while suspended
+			drift -= at.Sub(until)
+		}
+	}
+	drift += time.Duration(float64(until.Sub(prev.Time.Time)) * (prevRate - 1))
+
+	ep := &timeleapv1alpha1.VirtualEpoch{
+		Time:     at,
+		Origin:   prev.Origin,
+		Rate:     rateValue,
+		SpecHash: hash,
+	}
+	if drift != 0 {
+		ep.Drift = timeleapv1alpha1.FormatOffset(drift)
+	}
+
+	return ep, nil
+}
+
+// epochDrift returns the drift of ep.
+func epochDrift(ep *timeleapv1alpha1.VirtualEpoch) (time.Duration, error) {
+	if ep.Drift == "" {
+		return 0, nil
+	}
+	drift, err := timeleapv1alpha1.ParseOffset(ep.Drift)
+	if err != nil {
+		return 0, fmt.Errorf("epoch: %w", err)
+	}
+
+	return drift, nil
+}
+
+// desiredClocks returns the virtual clocks of tl anchored at ep to apply to a pod at now, shifted by the skew
+// of the pod.
+//
+// Every pod gets the same clocks but the skew, so the pods agree on the virtual time however late they are
+// applied. In the "Slew" mode the clocks of a pod which does not follow ep yet instead start from the time
+// the pod reads at now, and converge to the shared clocks.
+func desiredClocks(tl *timeleapv1alpha1.TimeLeap, ep *timeleapv1alpha1.VirtualEpoch, frozenAt *metav1.Time, skew time.Duration, applied *Leap, now time.Time) (vclock.Set, error) {
+	rate, err := timeleapv1alpha1.ParseRate(ep.Rate)
+	if err != nil {
+		return nil, fmt.Errorf("epoch: %w", err)
+	}
+	if rate == 1 {
+		rate = 0 // the zero value is the real-time rate
+	}
+	drift, err := epochDrift(ep)
+	if err != nil {
+		return nil, err
+	}
+	anchor, origin := ep.Time.Time, ep.Origin.Time
+	continued := applied != nil && applied.TimeLeap == tl.Name && applied.SpecHash == ep.SpecHash
+
+	set := make(vclock.Set)
+	for _, name := range tl.Spec.ClockIDs() {
+		id, err := vclock.ParseID(string(name))
+		if err != nil {
+			return nil, err
+		}
+
+		offset, err := tl.Spec.ClockOffsetAt(name, origin)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		offset += drift
+		if frozenAt != nil && !hasOwnOffset(tl, name) {
+			offset = frozenAt.Sub(anchor)
+		}
+		c := vclock.Clock{
+			Epoch:  anchor,
+			Offset: offset + skew,
+			Rate:   rate,
+			Frozen: frozenAt != nil,
+		}
+
+		if tl.Spec.IsSlewing() {
+			prev, ok := applied.lookup(id)
+			if ok && continued {
+				// keep converging, and follow the rate change at the epoch
+				if !prev.Epoch.After(anchor) && prev.Rate != rate {
+					prev = prev.Rebase(anchor, rate)
+				}
+				set[id] = prev
+				continue
+			}
+
+			// converge from the time the pod currently reads instead of jumping
+			var current time.Duration
+			if ok && applied.TimeLeap == tl.Name {
+				current = prev.OffsetAt(now)
+			}
+			c = c.Rebase(now, rate)
+			if c.Slew = c.Offset - current; c.Slew != 0 {
+				if c.SlewRate, err = tl.Spec.SlewRate(c.Slew); err != nil {
+					return nil, fmt.Errorf("%s: %w", name, err)
+				}
+			}
+		}
+		set[id] = c
+	}
+
+	return set, nil
+}
+
+// hasOwnOffset reports whether the clock overrides the offset of tl.
+func hasOwnOffset(tl *timeleapv1alpha1.TimeLeap, id timeleapv1alpha1.ClockID) bool {
+	for _, c := range tl.Spec.Clocks {
+		if c.ID == id {
+			return c.Offset != ""
+		}
+	}
+
+	return false
+}
+
+// lookup returns the applied virtual clock which replaces the kernel clock id.
+func (l *Leap) lookup(id vclock.ID) (vclock.Clock, bool) {
+	if l == nil {
+		return vclock.Clock{}, false
+	}
+	c, ok := l.Clocks[id]
+
+	return c, ok
+}
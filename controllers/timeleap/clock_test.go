@@ -0,0 +1,204 @@
+// Copyright 2020 The kube-timeleap Authors.
+// SPDX-License-Identifier: BSD-3-Clause
+
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	timeleapv1alpha1 "github.com/zchee/kube-timeleap/apis/timeleap/v1alpha1"
+	"github.com/zchee/kube-timeleap/pkg/vclock"
+)
+
+var epoch = time.Date(2020, time.October, 1, 0, 0, 0, 0, time.UTC)
+
+func Test_desiredClocks(t *testing.T) {
+	tl := &timeleapv1alpha1.TimeLeap{
+		ObjectMeta: metav1.ObjectMeta{Name: "leap"},
+		Spec: timeleapv1alpha1.TimeLeapSpec{
+			Offset: "+72h",
+			Clocks: []timeleapv1alpha1.ClockSpec{
+				{ID: timeleapv1alpha1.ClockRealtime},
+				{ID: timeleapv1alpha1.ClockMonotonic, Offset: "+1h"},
+			},
+		},
+	}
+	hash := specHash(tl, nil)
+	ep, err := virtualEpoch(tl, hash, epoch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tl.Status.Epoch = ep
+
+	clocks, err := desiredClocks(tl, ep, nil, 0, nil, epoch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := vclock.Set{
+		vclock.Realtime:  {Epoch: epoch, Offset: 72 * time.Hour},
+		vclock.Monotonic: {Epoch: epoch, Offset: time.Hour},
+	}
+	if !clocks.Equal(want) {
+		t.Fatalf("desiredClocks() = %v, want %v", clocks, want)
+	}
+
+	t.Run("RateChange", func(t *testing.T) {
+		applied := &Leap{TimeLeap: tl.Name, SpecHash: hash, Clocks: clocks}
+
+		tl := tl.DeepCopy()
+		tl.Spec.Rate = "60"
+		if got := specHash(tl, nil); got != hash {
+			t.Fatalf("rate changed the spec hash: %s -> %s", hash, got)
+		}
+
+		changed := epoch.Add(time.Minute)
+		ep, err := virtualEpoch(tl, hash, changed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ep.Time.Time.Equal(changed) || !ep.Origin.Time.Equal(epoch) {
+			t.Fatalf("epoch = %+v, want moved to %v from %v", ep, changed, epoch)
+		}
+		rebased, err := desiredClocks(tl, ep, nil, 0, applied, changed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// a pod applied after the rate change continues the same virtual time
+		later := changed.Add(time.Hour)
+		joined, err := desiredClocks(tl, ep, nil, 0, nil, later)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !joined.Equal(rebased) {
+			t.Fatalf("joined = %v, want %v", joined, rebased)
+		}
+		for id, c := range rebased {
+			if before, after := clocks[id].At(changed), c.At(changed); !before.Equal(after) {
+				t.Fatalf("%v jumped at the rate change: %v -> %v", id, before, after)
+			}
+			if c.Rate != 60 {
+				t.Fatalf("%v rate = %v, want 60", id, c.Rate)
+			}
+		}
+	})
+
+	t.Run("OffsetChange", func(t *testing.T) {
+		applied := &Leap{TimeLeap: tl.Name, SpecHash: hash, Clocks: clocks}
+
+		tl := tl.DeepCopy()
+		tl.Spec.Offset = "+24h"
+		now := epoch.Add(time.Minute)
+		ep, err := virtualEpoch(tl, specHash(tl, nil), now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := desiredClocks(tl, ep, nil, 0, applied, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := now.Add(24 * time.Hour); !got[vclock.Realtime].At(now).Equal(want) {
+			t.Fatalf("realtime = %v, want %v", got[vclock.Realtime].At(now), want)
+		}
+	})
+
+	t.Run("Frozen", func(t *testing.T) {
+		tl := tl.DeepCopy()
+		tl.Spec.Mode = timeleapv1alpha1.FreezeMode
+		frozen := metav1.NewTime(epoch.Add(48 * time.Hour))
+
+		ep, err := virtualEpoch(tl, specHash(tl, &frozen), epoch)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := desiredClocks(tl, ep, &frozen, 0, nil, epoch)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if at := got[vclock.Realtime].At(epoch.Add(time.Hour)); !at.Equal(frozen.Time) {
+			t.Fatalf("realtime = %v, want frozen at %v", at, frozen.Time)
+		}
+	})
+
+	t.Run("Slew", func(t *testing.T) {
+		tl := tl.DeepCopy()
+		tl.Spec.Mode = timeleapv1alpha1.SlewMode
+		tl.Spec.Offset = "+30m"
+		tl.Spec.Clocks = nil
+		tl.Spec.Slew = &timeleapv1alpha1.SlewSpec{Period: &metav1.Duration{Duration: 2 * time.Hour}, MaxRate: "0.5"}
+
+		// the pod starts from the real time and converges over the period
+		ep, err := virtualEpoch(tl, specHash(tl, nil), epoch)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tl.Status.Epoch = ep
+		got, err := desiredClocks(tl, ep, nil, 0, nil, epoch)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c := got[vclock.Realtime]
+		if off := c.OffsetAt(epoch); off != 0 {
+			t.Fatalf("offset at the start = %v, want 0", off)
+		}
+		if want := epoch.Add(2 * time.Hour); !c.SlewEnd().Equal(want) {
+			t.Fatalf("SlewEnd() = %v, want %v", c.SlewEnd(), want)
+		}
+
+		// a new target converges from the current time at the bounded rate
+		applied := &Leap{TimeLeap: tl.Name, SpecHash: specHash(tl, nil), Clocks: got}
+		changed := epoch.Add(time.Hour)
+		tl.Spec.Offset = "-72h"
+		if ep, err = virtualEpoch(tl, specHash(tl, nil), changed); err != nil {
+			t.Fatal(err)
+		}
+		next, err := desiredClocks(tl, ep, nil, 0, applied, changed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		n := next[vclock.Realtime]
+		if before, after := c.At(changed), n.At(changed); !before.Equal(after) {
+			t.Fatalf("realtime jumped at the target change: %v -> %v", before, after)
+		}
+		if n.SlewRate != 0.5 {
+			t.Fatalf("slew rate = %v, want bounded to 0.5", n.SlewRate)
+		}
+	})
+	t.Run("SharedEpoch", func(t *testing.T) {
+		tl := tl.DeepCopy()
+		target := metav1.NewTime(epoch.Add(30 * 24 * time.Hour))
+		tl.Spec.Offset = ""
+		tl.Spec.Time = &target
+		tl.Spec.Rate = "2"
+		tl.Spec.Clocks = nil
+
+		ep, err := virtualEpoch(tl, specHash(tl, nil), epoch)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tl.Status.Epoch = ep
+
+		// the replicas applied at different moments read the same virtual time
+		first, err := desiredClocks(tl, ep, nil, 0, nil, epoch)
+		if err != nil {
+			t.Fatal(err)
+		}
+		later := epoch.Add(10 * time.Minute)
+		if got, err := virtualEpoch(tl, specHash(tl, nil), later); err != nil || got != ep {
+			t.Fatalf("virtualEpoch() = %+v, %v, want the epoch kept", got, err)
+		}
+		second, err := desiredClocks(tl, ep, nil, 0, nil, later)
+		if err != nil {
+			t.Fatal(err)
+		}
+		now := later.Add(time.Hour)
+		if a, b := first[vclock.Realtime].At(now), second[vclock.Realtime].At(now); !a.Equal(b) {
+			t.Fatalf("replicas disagree: %v != %v", a, b)
+		}
+		if want := target.Add(2 * (time.Hour + 10*time.Minute)); !first[vclock.Realtime].At(now).Equal(want) {
+			t.Fatalf("realtime = %v, want %v", first[vclock.Realtime].At(now), want)
+		}
+	})
+}
@@ -0,0 +1,282 @@
+// Copyright 2020 The kube-timeleap Authors.
+// SPDX-License-Identifier: BSD-3-Clause
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	kerrors "k8s.io/apimachinery/pkg/util/errors"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	injectorv1alpha1 "github.com/zchee/kube-timeleap/apis/injector/v1alpha1"
+	timeleapv1alpha1 "github.com/zchee/kube-timeleap/apis/timeleap/v1alpha1"
+)
+
+// ClusterTimeLeapReconciler reconciles a ClusterTimeLeap object.
+//
+// The ClusterTimeLeapReconciler drives the ClusterTimeLeap through a TimeLeap in each selected namespace,
+// which is owned by the ClusterTimeLeap and named after it.
+type ClusterTimeLeapReconciler struct {
+	client.Client
+	Log    logr.Logger
+	Scheme *runtime.Scheme
+
+	// Policy is the policy of the pod injector, whose excluded namespaces are never selected either. Only
+	// kube-system is excluded if nil.
+	Policy *injectorv1alpha1.NamespacePolicy
+}
+
+// compile time check whether the ClusterTimeLeapReconciler implements ctrlreconcile.Reconciler interface.
+var _ reconcile.Reconciler = (*ClusterTimeLeapReconciler)(nil)
+
+// +kubebuilder:rbac:groups=timeleap.x-k8s.io,resources=clustertimeleaps,verbs=get;list;watch;update;patch;delete
+// +kubebuilder:rbac:groups=timeleap.x-k8s.io,resources=clustertimeleaps/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=timeleap.x-k8s.io,resources=clustertimeleaps/finalizers,verbs=update
+// +kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch
+
+// Reconcile implements a reconcile.Reconciler.
+func (r *ClusterTimeLeapReconciler) Reconcile(ctx context.Context, req reconcile.Request) (reconcile.Result, error) {
+	log := r.Log.WithValues("clustertimeleap", req.Name)
+
+	ctl := &timeleapv1alpha1.ClusterTimeLeap{}
+	if err := r.Client.Get(ctx, req.NamespacedName, ctl); err != nil {
+		return reconcile.Result{}, client.IgnoreNotFound(err)
+	}
+	if !ctl.DeletionTimestamp.IsZero() {
+		// the owned TimeLeaps are garbage collected, and restore the real time by their finalizer
+		return reconcile.Result{}, nil
+	}
+
+	now := time.Now()
+	status := ctl.Status.DeepCopy()
+	status.ObservedGeneration = ctl.Generation
+
+	children, err := r.ownedTimeLeaps(ctx, ctl)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+
+	var result reconcile.Result
+	status.ExpirationTime = ctl.ExpirationTime()
+	if expiry := status.ExpirationTime; expiry != nil {
+		if !now.Before(expiry.Time) {
+			return r.expire(ctx, log, ctl, status, children)
+		}
+		result.RequeueAfter = expiry.Sub(now)
+	}
+
+	frozenAt, err := clusterFrozenAt(ctl, now)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	status.FrozenAt = frozenAt
+	hash := specHash(&timeleapv1alpha1.TimeLeap{Spec: ctl.Spec.TimeLeapSpec(frozenAt, nil)}, frozenAt)
+	ep, err := nextEpoch(ctl.Status.Epoch, hash, ctl.Spec.Rate, ctl.Spec.IsFrozen(), false, now)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	status.Epoch = ep
+
+	namespaces, err := r.selectNamespaces(ctx, ctl)
+	if err != nil {
+		return reconcile.Result{}, fmt.Errorf("select namespaces: %w", err)
+	}
+	status.Namespaces = namespaces
+
+	var errs []error
+	spec := ctl.Spec.TimeLeapSpec(frozenAt, ep)
+	selected := make(map[string]bool, len(namespaces))
+	for _, ns := range namespaces {
+		selected[ns] = true
+		if err := syncOwnedTimeLeap(ctx, r.Client, r.Scheme, ctl, timeleapv1alpha1.ClusterTimeLeapLabel, ns, children[ns], spec); err != nil {
+			errs = append(errs, fmt.Errorf("namespace %s: %w", ns, err))
+		}
+	}
+	for ns, tl := range children {
+		if selected[ns] {
+			continue
+		}
+		if err := r.Client.Delete(ctx, tl); client.IgnoreNotFound(err) != nil {
+			errs = append(errs, fmt.Errorf("namespace %s: delete TimeLeap: %w", ns, err))
+			continue
+		}
+		log.Info("released namespace", "namespace", ns)
+	}
+
+	status.TargetedPods, status.AppliedPods, status.FailedPods = 0, 0, 0
+	for ns, tl := range children {
+		if !selected[ns] {
+			continue
+		}
+		status.TargetedPods += tl.Status.TargetedPods
+		status.AppliedPods += tl.Status.AppliedPods
+		status.FailedPods += tl.Status.FailedPods
+	}
+	setCountConditions(&status.Conditions, ctl.Generation, status.TargetedPods, status.AppliedPods, status.FailedPods)
+
+	if err := r.updateStatus(ctx, ctl, status); err != nil {
+		return reconcile.Result{}, err
+	}
+
+	if err := kerrors.NewAggregate(errs); err != nil {
+		return reconcile.Result{}, err
+	}
+
+	return result, nil
+}
+
+// ownedTimeLeaps returns the TimeLeaps owned by ctl keyed by their namespace.
+func (r *ClusterTimeLeapReconciler) ownedTimeLeaps(ctx context.Context, ctl *timeleapv1alpha1.ClusterTimeLeap) (map[string]*timeleapv1alpha1.TimeLeap, error) {
+	tls := &timeleapv1alpha1.TimeLeapList{}
+	if err := r.Client.List(ctx, tls, client.MatchingLabels{timeleapv1alpha1.ClusterTimeLeapLabel: ctl.Name}); err != nil {
+		return nil, fmt.Errorf("list owned TimeLeaps: %w", err)
+	}
+
+	children := make(map[string]*timeleapv1alpha1.TimeLeap, len(tls.Items))
+	for i := range tls.Items {
+		tl := &tls.Items[i]
+		if metav1.IsControlledBy(tl, ctl) {
+			children[tl.Namespace] = tl
+		}
+	}
+
+	return children, nil
+}
+
+// selectNamespaces returns the names of the active namespaces selected by ctl in ascending order.
+func (r *ClusterTimeLeapReconciler) selectNamespaces(ctx context.Context, ctl *timeleapv1alpha1.ClusterTimeLeap) ([]string, error) {
+	selector, err := metav1.LabelSelectorAsSelector(&ctl.Spec.NamespaceSelector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid namespace selector: %w", err)
+	}
+
+	nss := &corev1.NamespaceList{}
+	if err := r.Client.List(ctx, nss, client.MatchingLabelsSelector{Selector: selector}); err != nil {
+		return nil, err
+	}
+
+	policy := r.Policy
+	if policy == nil {
+		policy = injectorv1alpha1.NewNamespacePolicy("", "")
+	}
+
+	var names []string
+	for _, ns := range nss.Items {
+		if policy.Excludes(ns.Name) || ns.Status.Phase == corev1.NamespaceTerminating {
+			continue
+		}
+		names = append(names, ns.Name)
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
+
+// expire deletes the TimeLeaps owned by the expired ctl and marks it as Expired.
+//
+// ctl is deleted afterwards if it requests so.
+func (r *ClusterTimeLeapReconciler) expire(ctx context.Context, log logr.Logger, ctl *timeleapv1alpha1.ClusterTimeLeap, status *timeleapv1alpha1.ClusterTimeLeapStatus, children map[string]*timeleapv1alpha1.TimeLeap) (reconcile.Result, error) {
+	for ns, tl := range children {
+		if err := r.Client.Delete(ctx, tl); client.IgnoreNotFound(err) != nil {
+			return reconcile.Result{}, fmt.Errorf("namespace %s: delete TimeLeap: %w", ns, err)
+		}
+	}
+
+	if !meta.IsStatusConditionTrue(ctl.Status.Conditions, timeleapv1alpha1.ConditionExpired) {
+		status.FrozenAt = nil
+		status.Epoch = nil
+		status.Namespaces = nil
+		status.TargetedPods, status.AppliedPods, status.FailedPods = 0, 0, 0
+		setExpiredConditionsOn(&status.Conditions, ctl.Generation, fmt.Sprintf("TTL %s elapsed, deleted the TimeLeaps in %d namespaces", ctl.Spec.TTL.Duration, len(children)))
+		if err := r.updateStatus(ctx, ctl, status); err != nil {
+			return reconcile.Result{}, err
+		}
+		log.Info("expired", "namespaces", len(children))
+	}
+
+	if ctl.Spec.DeleteOnExpiry {
+		if err := r.Client.Delete(ctx, ctl); err != nil {
+			return reconcile.Result{}, client.IgnoreNotFound(err)
+		}
+		log.Info("deleted expired ClusterTimeLeap")
+	}
+
+	return reconcile.Result{}, nil
+}
+
+// updateStatus updates the status of ctl to status if it has changed.
+func (r *ClusterTimeLeapReconciler) updateStatus(ctx context.Context, ctl *timeleapv1alpha1.ClusterTimeLeap, status *timeleapv1alpha1.ClusterTimeLeapStatus) error {
+	if equality.Semantic.DeepEqual(&ctl.Status, status) {
+		return nil
+	}
+
+	ctl.Status = *status
+	if err := r.Client.Status().Update(ctx, ctl); err != nil {
+		return fmt.Errorf("update status: %w", err)
+	}
+
+	return nil
+}
+
+// clusterFrozenAt returns the virtual instant a frozen ClusterTimeLeap pins every selected namespace at,
+// or nil if ctl is not frozen.
+//
+// The instant is evaluated once per spec generation, same as the TimeLeap.
+func clusterFrozenAt(ctl *timeleapv1alpha1.ClusterTimeLeap, now time.Time) (*metav1.Time, error) {
+	if !ctl.Spec.IsFrozen() {
+		return nil, nil
+	}
+	if ctl.Status.FrozenAt != nil && ctl.Status.ObservedGeneration == ctl.Generation {
+		return ctl.Status.FrozenAt, nil
+	}
+
+	spec := ctl.Spec.TimeLeapSpec(nil, nil)
+	offset, err := spec.OffsetAt(now)
+	if err != nil {
+		return nil, err
+	}
+	t := metav1.NewTime(now.Add(offset)).Rfc3339Copy()
+
+	return &t, nil
+}
+
+// namespaceToClusterTimeLeaps maps the namespace to every ClusterTimeLeap, since its labels might have
+// changed to be selected or unselected.
+func (r *ClusterTimeLeapReconciler) namespaceToClusterTimeLeaps(obj client.Object) []reconcile.Request {
+	ctls := &timeleapv1alpha1.ClusterTimeLeapList{}
+	if err := r.Client.List(context.Background(), ctls); err != nil {
+		r.Log.Error(err, "unable to list ClusterTimeLeaps")
+		return nil
+	}
+
+	reqs := make([]reconcile.Request, len(ctls.Items))
+	for i, ctl := range ctls.Items {
+		reqs[i] = reconcile.Request{NamespacedName: client.ObjectKey{Name: ctl.Name}}
+	}
+
+	return reqs
+}
+
+// SetupWithManager setups the Controller with manager.Manager.
+func (r *ClusterTimeLeapReconciler) SetupWithManager(mgr manager.Manager) error {
+	return builder.ControllerManagedBy(mgr).
+		For(&timeleapv1alpha1.ClusterTimeLeap{}).
+		Owns(&timeleapv1alpha1.TimeLeap{}).
+		Watches(&source.Kind{Type: &corev1.Namespace{}}, handler.EnqueueRequestsFromMapFunc(r.namespaceToClusterTimeLeaps)).
+		Complete(r)
+}
@@ -0,0 +1,317 @@
+// Copyright 2020 The kube-timeleap Authors.
+// SPDX-License-Identifier: BSD-3-Clause
+
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	injectorv1alpha1 "github.com/zchee/kube-timeleap/apis/injector/v1alpha1"
+	timeleapv1alpha1 "github.com/zchee/kube-timeleap/apis/timeleap/v1alpha1"
+	"github.com/zchee/kube-timeleap/pkg/vclock"
+)
+
+func TestClusterTimeLeapReconciler_Reconcile(t *testing.T) {
+	namespace := func(name string, labels map[string]string) *corev1.Namespace {
+		return &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels}}
+	}
+	selected := map[string]string{"leap": "true"}
+	ctl := &timeleapv1alpha1.ClusterTimeLeap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       "leap",
+			UID:        "ctl-uid",
+			Generation: 1,
+		},
+		Spec: timeleapv1alpha1.ClusterTimeLeapSpec{
+			NamespaceSelector: metav1.LabelSelector{MatchLabels: selected},
+			PodSelector:       metav1.LabelSelector{MatchLabels: map[string]string{"app": "sample"}},
+			Offset:            "+24h",
+		},
+	}
+	ctx := context.Background()
+
+	r := newTestReconciler(t, nil,
+		ctl,
+		namespace("team-a", selected),
+		namespace("team-b", selected),
+		namespace("team-c", nil),
+		namespace(metav1.NamespaceSystem, selected),
+		namespace("kube-timeleap-system", selected),
+		namespace("sandbox", selected),
+	)
+	cr := &ClusterTimeLeapReconciler{
+		Client: r.Client,
+		Log:    log.NullLogger{},
+		Scheme: r.Scheme,
+		Policy: injectorv1alpha1.NewNamespacePolicy("timeleap.x-k8s.io/injection", "kube-timeleap-system", "sandbox"),
+	}
+	req := reconcile.Request{NamespacedName: client.ObjectKey{Name: ctl.Name}}
+	if _, err := cr.Reconcile(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+
+	got := &timeleapv1alpha1.ClusterTimeLeap{}
+	if err := r.Client.Get(ctx, req.NamespacedName, got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Status.Epoch == nil {
+		t.Fatal("epoch is not chosen")
+	}
+
+	// every namespace is anchored at the epoch of the ClusterTimeLeap
+	want := ctl.Spec.TimeLeapSpec(nil, got.Status.Epoch)
+	for _, ns := range []string{"team-a", "team-b"} {
+		tl := &timeleapv1alpha1.TimeLeap{}
+		if err := r.Client.Get(ctx, client.ObjectKey{Namespace: ns, Name: ctl.Name}, tl); err != nil {
+			t.Fatalf("namespace %s: %v", ns, err)
+		}
+		if !metav1.IsControlledBy(tl, ctl) {
+			t.Errorf("namespace %s: TimeLeap is not controlled by the ClusterTimeLeap", ns)
+		}
+		if diff := cmp.Diff(want, tl.Spec); diff != "" {
+			t.Errorf("namespace %s: (-want, +got)\n%s", ns, diff)
+		}
+	}
+	for _, ns := range []string{"team-c", metav1.NamespaceSystem, "kube-timeleap-system", "sandbox"} {
+		err := r.Client.Get(ctx, client.ObjectKey{Namespace: ns, Name: ctl.Name}, &timeleapv1alpha1.TimeLeap{})
+		if !apierrors.IsNotFound(err) {
+			t.Errorf("namespace %s: got %v, want NotFound", ns, err)
+		}
+	}
+
+	if diff := cmp.Diff([]string{"team-a", "team-b"}, got.Status.Namespaces); diff != "" {
+		t.Errorf("status.namespaces: (-want, +got)\n%s", diff)
+	}
+
+	// unselecting a namespace releases its TimeLeap
+	ns := &corev1.Namespace{}
+	if err := r.Client.Get(ctx, client.ObjectKey{Name: "team-b"}, ns); err != nil {
+		t.Fatal(err)
+	}
+	ns.Labels = nil
+	if err := r.Client.Update(ctx, ns); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cr.Reconcile(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+	err := r.Client.Get(ctx, client.ObjectKey{Namespace: "team-b", Name: ctl.Name}, &timeleapv1alpha1.TimeLeap{})
+	if !apierrors.IsNotFound(err) {
+		t.Errorf("namespace team-b: got %v, want NotFound", err)
+	}
+}
+
+func TestClusterTimeLeapReconciler_NotOwned(t *testing.T) {
+	ctl := &timeleapv1alpha1.ClusterTimeLeap{
+		ObjectMeta: metav1.ObjectMeta{Name: "leap", UID: "ctl-uid"},
+		Spec: timeleapv1alpha1.ClusterTimeLeapSpec{
+			PodSelector: metav1.LabelSelector{MatchLabels: map[string]string{"app": "sample"}},
+			Offset:      "+24h",
+		},
+	}
+	existing := &timeleapv1alpha1.TimeLeap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "leap"},
+		Spec: timeleapv1alpha1.TimeLeapSpec{
+			Selector: metav1.LabelSelector{MatchLabels: map[string]string{"app": "other"}},
+			Offset:   "+1h",
+		},
+	}
+	ctx := context.Background()
+
+	r := newTestReconciler(t, nil, ctl, existing, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default"}})
+	cr := &ClusterTimeLeapReconciler{Client: r.Client, Log: log.NullLogger{}, Scheme: r.Scheme}
+	if _, err := cr.Reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKey{Name: ctl.Name}}); err == nil {
+		t.Fatal("got nil, want error for the TimeLeap not owned by the ClusterTimeLeap")
+	}
+
+	got := &timeleapv1alpha1.TimeLeap{}
+	if err := r.Client.Get(ctx, client.ObjectKey{Namespace: "default", Name: "leap"}, got); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(existing.Spec, got.Spec); diff != "" {
+		t.Errorf("existing TimeLeap was modified: (-want, +got)\n%s", diff)
+	}
+}
+
+func TestClusterTimeLeapReconciler_DefaultTTL(t *testing.T) {
+	selected := map[string]string{"leap": "true"}
+	ctl := &timeleapv1alpha1.ClusterTimeLeap{
+		ObjectMeta: metav1.ObjectMeta{Name: "leap", UID: "ctl-uid", Generation: 1},
+		Spec: timeleapv1alpha1.ClusterTimeLeapSpec{
+			NamespaceSelector: metav1.LabelSelector{MatchLabels: selected},
+			PodSelector:       metav1.LabelSelector{MatchLabels: map[string]string{"app": "sample"}},
+			Offset:            "+24h",
+		},
+	}
+	ctx := context.Background()
+	key := client.ObjectKey{Namespace: "team-a", Name: ctl.Name}
+
+	// DEFAULT_TTL=1h, while the ClusterTimeLeap has no TTL
+	r := newTestReconciler(t, nil, ctl, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-a", Labels: selected}})
+	c := &defaultingClient{Client: r.Client, defaultTTL: time.Hour}
+	cr := &ClusterTimeLeapReconciler{Client: c, Log: log.NullLogger{}, Scheme: r.Scheme}
+	reconcileCluster := func(t *testing.T) {
+		t.Helper()
+
+		if _, err := cr.Reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKey{Name: ctl.Name}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	reconcileCluster(t)
+	child := &timeleapv1alpha1.TimeLeap{}
+	if err := c.Get(ctx, key, child); err != nil {
+		t.Fatal(err)
+	}
+	if child.Spec.TTL != nil {
+		t.Fatalf("TTL = %v, want nil for the TimeLeap expired by the ClusterTimeLeap", child.Spec.TTL)
+	}
+
+	// the child created with the default TTL before has expired, and the namespace is back on the real time
+	child.Spec.TTL = &metav1.Duration{Duration: time.Hour}
+	child.Status.Conditions = []metav1.Condition{{
+		Type:               timeleapv1alpha1.ConditionExpired,
+		Status:             metav1.ConditionTrue,
+		Reason:             timeleapv1alpha1.ReasonTTLExpired,
+		LastTransitionTime: metav1.Now(),
+	}}
+	if err := c.Update(ctx, child); err != nil {
+		t.Fatal(err)
+	}
+	reconcileCluster(t)
+	reconcileCluster(t)
+	child = &timeleapv1alpha1.TimeLeap{}
+	if err := c.Get(ctx, key, child); err != nil {
+		t.Fatal(err)
+	}
+	if child.Spec.TTL != nil || meta.IsStatusConditionTrue(child.Status.Conditions, timeleapv1alpha1.ConditionExpired) {
+		t.Fatalf("TimeLeap = %+v, want recreated without a TTL", child)
+	}
+}
+
+func TestClusterTimeLeapReconciler_SharedEpoch(t *testing.T) {
+	at := metav1.NewTime(time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	tests := []struct {
+		name string
+		spec timeleapv1alpha1.ClusterTimeLeapSpec
+	}{
+		{
+			name: "Time",
+			spec: timeleapv1alpha1.ClusterTimeLeapSpec{Time: &at},
+		},
+		{
+			name: "Rate",
+			spec: timeleapv1alpha1.ClusterTimeLeapSpec{Offset: "+24h", Rate: "2"},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			selected := map[string]string{"leap": "true"}
+			ctl := &timeleapv1alpha1.ClusterTimeLeap{
+				ObjectMeta: metav1.ObjectMeta{Name: "leap", UID: "ctl-uid", Generation: 1},
+				Spec:       tt.spec,
+			}
+			ctl.Spec.NamespaceSelector = metav1.LabelSelector{MatchLabels: selected}
+			ctl.Spec.PodSelector = metav1.LabelSelector{MatchLabels: map[string]string{"app": "sample"}}
+			pod := func(namespace string) *corev1.Pod {
+				return &corev1.Pod{
+					ObjectMeta: metav1.ObjectMeta{
+						Namespace: namespace,
+						Name:      "sample",
+						Labels:    map[string]string{"app": "sample", injectorv1alpha1.InjectedLabel: "true"},
+					},
+				}
+			}
+			ctx := context.Background()
+			req := reconcile.Request{NamespacedName: client.ObjectKey{Name: ctl.Name}}
+
+			r := newTestReconciler(t, nil,
+				ctl,
+				&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-a", Labels: selected}},
+				&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-b"}},
+				pod("team-a"),
+				pod("team-b"),
+			)
+			cr := &ClusterTimeLeapReconciler{Client: r.Client, Log: log.NullLogger{}, Scheme: r.Scheme}
+			reconcileCluster := func(t *testing.T) *timeleapv1alpha1.ClusterTimeLeap {
+				t.Helper()
+
+				if _, err := cr.Reconcile(ctx, req); err != nil {
+					t.Fatal(err)
+				}
+				got := &timeleapv1alpha1.ClusterTimeLeap{}
+				if err := r.Client.Get(ctx, req.NamespacedName, got); err != nil {
+					t.Fatal(err)
+				}
+
+				return got
+			}
+			applyNamespace := func(t *testing.T, namespace string) vclock.Clock {
+				t.Helper()
+
+				key := client.ObjectKey{Namespace: namespace, Name: ctl.Name}
+				if _, err := r.Reconcile(ctx, reconcile.Request{NamespacedName: key}); err != nil {
+					t.Fatal(err)
+				}
+				p := &corev1.Pod{}
+				if err := r.Client.Get(ctx, client.ObjectKey{Namespace: namespace, Name: "sample"}, p); err != nil {
+					t.Fatal(err)
+				}
+				leap, err := r.Applier.Applied(p)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if leap == nil {
+					t.Fatalf("namespace %s: the virtual clocks are not applied", namespace)
+				}
+
+				return leap.Clocks[vclock.Realtime]
+			}
+
+			// team-a was selected an hour ago
+			got := reconcileCluster(t)
+			anchor := metav1.NewMicroTime(got.Status.Epoch.Time.Add(-time.Hour))
+			got.Status.Epoch.Time, got.Status.Epoch.Origin = anchor, anchor
+			if err := r.Client.Status().Update(ctx, got); err != nil {
+				t.Fatal(err)
+			}
+			reconcileCluster(t)
+			a := applyNamespace(t, "team-a")
+
+			// and team-b is labeled now
+			ns := &corev1.Namespace{}
+			if err := r.Client.Get(ctx, client.ObjectKey{Name: "team-b"}, ns); err != nil {
+				t.Fatal(err)
+			}
+			ns.Labels = selected
+			if err := r.Client.Update(ctx, ns); err != nil {
+				t.Fatal(err)
+			}
+			reconcileCluster(t)
+			b := applyNamespace(t, "team-b")
+
+			if !a.Epoch.Equal(anchor.Time) || !b.Epoch.Equal(anchor.Time) {
+				t.Fatalf("anchored at %v and %v, want both at %v", a.Epoch, b.Epoch, anchor.Time)
+			}
+			now := time.Now()
+			if va, vb := a.At(now), b.At(now); !va.Equal(vb) {
+				t.Fatalf("team-a reads %v and team-b reads %v, want the same virtual time", va, vb)
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright 2020 The kube-timeleap Authors.
+// SPDX-License-Identifier: BSD-3-Clause
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	timeleapv1alpha1 "github.com/zchee/kube-timeleap/apis/timeleap/v1alpha1"
+)
+
+// syncOwnedTimeLeap creates or updates the TimeLeap controlled by owner in the namespace to spec.
+//
+// The TimeLeap is named after owner and labeled with label whose value is the owner name. tl is the existing
+// TimeLeap, or nil if it is not created yet.
+//
+// The TTL of spec is applied as is, so the TimeLeap lives as long as owner wants. A TimeLeap which has
+// expired on its own, e.g. by a TTL given before, is deleted to be recreated, since the spec of an expired
+// TimeLeap is immutable.
+func syncOwnedTimeLeap(ctx context.Context, c client.Client, scheme *runtime.Scheme, owner client.Object, label, namespace string, tl *timeleapv1alpha1.TimeLeap, spec timeleapv1alpha1.TimeLeapSpec) error {
+	if tl == nil {
+		tl = &timeleapv1alpha1.TimeLeap{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: namespace,
+				Name:      owner.GetName(),
+				Labels: map[string]string{
+					label: owner.GetName(),
+				},
+			},
+			Spec: spec,
+		}
+		if err := controllerutil.SetControllerReference(owner, tl, scheme); err != nil {
+			return err
+		}
+		if err := c.Create(ctx, tl); err != nil {
+			if apierrors.IsAlreadyExists(err) {
+				return fmt.Errorf("TimeLeap %s already exists and is not owned by %s", tl.Name, owner.GetName())
+			}
+			return fmt.Errorf("create TimeLeap: %w", err)
+		}
+		return nil
+	}
+
+	switch {
+	case !tl.DeletionTimestamp.IsZero():
+		// recreated once the real time is restored
+		return nil
+
+	case meta.IsStatusConditionTrue(tl.Status.Conditions, timeleapv1alpha1.ConditionExpired):
+		if err := c.Delete(ctx, tl); client.IgnoreNotFound(err) != nil {
+			return fmt.Errorf("delete expired TimeLeap: %w", err)
+		}
+		return nil
+
+	case tl.Spec.Mode != spec.Mode:
+		// the mode of a running TimeLeap is immutable, so restore the real time and start over
+		if err := c.Delete(ctx, tl); client.IgnoreNotFound(err) != nil {
+			return fmt.Errorf("delete TimeLeap to switch the mode: %w", err)
+		}
+		return nil
+
+	case !equality.Semantic.DeepEqual(&tl.Spec, &spec):
+		tl.Spec = spec
+		if err := c.Update(ctx, tl); err != nil {
+			return fmt.Errorf("update TimeLeap: %w", err)
+		}
+	}
+
+	return nil
+}
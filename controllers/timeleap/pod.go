@@ -0,0 +1,195 @@
+// Copyright 2020 The kube-timeleap Authors.
+// SPDX-License-Identifier: BSD-3-Clause
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	kerrors "k8s.io/apimachinery/pkg/util/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	injectorv1alpha1 "github.com/zchee/kube-timeleap/apis/injector/v1alpha1"
+	timeleapv1alpha1 "github.com/zchee/kube-timeleap/apis/timeleap/v1alpha1"
+	"github.com/zchee/kube-timeleap/pkg/vclock"
+)
+
+// targetPods returns the live pods selected by tl.
+func (r *TimeLeapReconciler) targetPods(ctx context.Context, tl *timeleapv1alpha1.TimeLeap) ([]corev1.Pod, error) {
+	selector, err := metav1.LabelSelectorAsSelector(&tl.Spec.Selector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid selector: %w", err)
+	}
+
+	pods := &corev1.PodList{}
+	if err := r.Client.List(ctx, pods, client.InNamespace(tl.Namespace), client.MatchingLabelsSelector{Selector: selector}); err != nil {
+		return nil, err
+	}
+
+	targets := pods.Items[:0]
+	for _, pod := range pods.Items {
+		if isPodLive(&pod) {
+			targets = append(targets, pod)
+		}
+	}
+
+	return targets, nil
+}
+
+// isPodLive reports whether the pod may still read the clocks.
+func isPodLive(pod *corev1.Pod) bool {
+	if pod.DeletionTimestamp != nil {
+		return false
+	}
+
+	return pod.Status.Phase != corev1.PodSucceeded && pod.Status.Phase != corev1.PodFailed
+}
+
+// applyPod applies the virtual clocks of tl to the pod, and returns the result with the applied clocks.
+//
+// The returned error is non-nil only if the failure is worth retrying.
+func (r *TimeLeapReconciler) applyPod(ctx context.Context, tl *timeleapv1alpha1.TimeLeap, ep *timeleapv1alpha1.VirtualEpoch, frozenAt *metav1.Time, pod *corev1.Pod, now time.Time) (timeleapv1alpha1.PodResult, vclock.Set, error) {
+	res := timeleapv1alpha1.PodResult{
+		Name:  pod.Name,
+		State: timeleapv1alpha1.PodFailed,
+	}
+
+	if !injectorv1alpha1.IsInjected(pod) {
+		res.Message = fmt.Sprintf("the time-leap agent is not injected, label the pod template with %s=%s and recreate the pod", injectorv1alpha1.InjectLabel, injectorv1alpha1.InjectEnabled)
+		return res, nil, nil
+	}
+
+	applied, err := r.Applier.Applied(pod)
+	if err != nil {
+		res.Message = err.Error()
+		return res, nil, nil
+	}
+	if applied != nil && applied.TimeLeap != tl.Name {
+		res.Message = fmt.Sprintf("the pod is driven by TimeLeap %q", applied.TimeLeap)
+		return res, nil, nil
+	}
+
+	var skew time.Duration
+	if tl.Spec.Skew != nil {
+		if skew, err = tl.Spec.Skew.For(pod.Name); err != nil {
+			res.Message = fmt.Sprintf("skew: %v", err)
+			return res, nil, nil
+		}
+		res.Skew = timeleapv1alpha1.FormatOffset(skew)
+	}
+
+	clocks, err := desiredClocks(tl, ep, frozenAt, skew, applied, now)
+	if err != nil {
+		res.Message = err.Error()
+		return res, nil, nil
+	}
+
+	if applied == nil || applied.SpecHash != ep.SpecHash || applied.Skew != res.Skew || !applied.Clocks.Equal(clocks) {
+		leap := &Leap{
+			TimeLeap: tl.Name,
+			SpecHash: ep.SpecHash,
+			Clocks:   clocks,
+			Skew:     res.Skew,
+		}
+		if err := r.Applier.Apply(ctx, pod, leap); err != nil {
+			res.Message = fmt.Sprintf("apply: %v", err)
+			return res, nil, err
+		}
+	}
+
+	res.State = timeleapv1alpha1.PodApplied
+
+	return res, clocks, nil
+}
+
+// releasePods restores the real time on the pods driven by tl which are no longer selected by it.
+func (r *TimeLeapReconciler) releasePods(ctx context.Context, tl *timeleapv1alpha1.TimeLeap, targets []corev1.Pod) (int, error) {
+	selected := make(map[string]bool, len(targets))
+	for _, pod := range targets {
+		selected[pod.Name] = true
+	}
+
+	restored, _, err := r.restorePods(ctx, tl, func(pod *corev1.Pod) bool {
+		return !selected[pod.Name]
+	})
+
+	return restored, err
+}
+
+// restorePods restores the real time on the pods driven by tl which match the filter, and returns the number of
+// restored pods and the results of the pods it failed on. A nil filter matches every pod.
+//
+// The pods are found by the applied leap rather than the selector, since the pod labels might have changed
+// since the virtual clocks were applied. A failed pod does not stop the others from being restored, the
+// returned error aggregates every failure.
+func (r *TimeLeapReconciler) restorePods(ctx context.Context, tl *timeleapv1alpha1.TimeLeap, filter func(*corev1.Pod) bool) (int, []timeleapv1alpha1.PodResult, error) {
+	pods := &corev1.PodList{}
+	if err := r.Client.List(ctx, pods, client.InNamespace(tl.Namespace)); err != nil {
+		return 0, nil, err
+	}
+
+	restored := 0
+	var (
+		failed []timeleapv1alpha1.PodResult
+		errs   []error
+	)
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pod.Annotations[timeleapv1alpha1.TimeLeapAnnotation] != tl.Name {
+			continue
+		}
+		if filter != nil && !filter(pod) {
+			continue
+		}
+
+		if err := r.Applier.Restore(ctx, pod); err != nil {
+			if apierrors.IsNotFound(err) {
+				continue // already gone
+			}
+			failed = append(failed, timeleapv1alpha1.PodResult{
+				Name:    pod.Name,
+				State:   timeleapv1alpha1.PodFailed,
+				Message: fmt.Sprintf("restore: %v", err),
+			})
+			errs = append(errs, fmt.Errorf("pod %s: %w", pod.Name, err))
+			continue
+		}
+		restored++
+	}
+
+	return restored, failed, kerrors.NewAggregate(errs)
+}
+
+// podToTimeLeaps maps the pod to the TimeLeaps which select it or drive its clocks.
+func (r *TimeLeapReconciler) podToTimeLeaps(obj client.Object) []reconcile.Request {
+	pod, ok := obj.(*corev1.Pod)
+	if !ok {
+		return nil
+	}
+
+	tls := &timeleapv1alpha1.TimeLeapList{}
+	if err := r.Client.List(context.Background(), tls, client.InNamespace(pod.Namespace)); err != nil {
+		r.Log.Error(err, "unable to list TimeLeaps", "namespace", pod.Namespace)
+		return nil
+	}
+
+	var reqs []reconcile.Request
+	for _, tl := range tls.Items {
+		selector, err := metav1.LabelSelectorAsSelector(&tl.Spec.Selector)
+		if err != nil {
+			continue
+		}
+		if selector.Matches(labels.Set(pod.Labels)) || pod.Annotations[timeleapv1alpha1.TimeLeapAnnotation] == tl.Name {
+			reqs = append(reqs, reconcile.Request{NamespacedName: client.ObjectKey{Namespace: tl.Namespace, Name: tl.Name}})
+		}
+	}
+
+	return reqs
+}
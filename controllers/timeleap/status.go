@@ -0,0 +1,230 @@
+// Copyright 2020 The kube-timeleap Authors.
+// SPDX-License-Identifier: BSD-3-Clause
+
+package controllers
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	timeleapv1alpha1 "github.com/zchee/kube-timeleap/apis/timeleap/v1alpha1"
+	"github.com/zchee/kube-timeleap/pkg/vclock"
+)
+
+// podStateOrder is the order of the per-pod results in the status, the most interesting first.
+var podStateOrder = map[timeleapv1alpha1.PodState]int{
+	timeleapv1alpha1.PodFailed:  0,
+	timeleapv1alpha1.PodPending: 1,
+	timeleapv1alpha1.PodApplied: 2,
+}
+
+// setPodResults records the per-pod results on status and counts the pods by state.
+//
+// Failed pods are recorded first, then pending ones, and the list is bounded to timeleapv1alpha1.MaxPodResults entries.
+func setPodResults(status *timeleapv1alpha1.TimeLeapStatus, results []timeleapv1alpha1.PodResult) {
+	status.TargetedPods = int32(len(results))
+	status.AppliedPods = 0
+	status.FailedPods = 0
+	for _, res := range results {
+		switch res.State {
+		case timeleapv1alpha1.PodApplied:
+			status.AppliedPods++
+		case timeleapv1alpha1.PodFailed:
+			status.FailedPods++
+		}
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		if oi, oj := podStateOrder[results[i].State], podStateOrder[results[j].State]; oi != oj {
+			return oi < oj
+		}
+		return results[i].Name < results[j].Name
+	})
+	if len(results) > timeleapv1alpha1.MaxPodResults {
+		results = results[:timeleapv1alpha1.MaxPodResults]
+	}
+	if len(results) == 0 {
+		results = nil
+	}
+	status.Pods = results
+}
+
+// slewRefreshInterval is the interval the offsets in the status are refreshed at while the pods are slewing.
+const slewRefreshInterval = 30 * time.Second
+
+// setOffsets records on status the target and current offsets of the applied clocks furthest from the target,
+// and returns the last real instant the applied clocks converge at.
+//
+// The offsets are of the first clock of each set in the clockid_t order, CLOCK_REALTIME if affected.
+func setOffsets(status *timeleapv1alpha1.TimeLeapStatus, applied []vclock.Set, now time.Time) time.Time {
+	status.TargetOffset, status.CurrentOffset = "", ""
+
+	var (
+		slewEnd  time.Time
+		furthest time.Duration = -1
+	)
+	for _, set := range applied {
+		ids := set.IDs()
+		if len(ids) == 0 {
+			continue
+		}
+		for _, id := range ids {
+			if end := set[id].SlewEnd(); end.After(slewEnd) {
+				slewEnd = end
+			}
+		}
+
+		c := set[ids[0]]
+		target, current := c.TargetOffsetAt(now), c.OffsetAt(now)
+		gap := target - current
+		if gap < 0 {
+			gap = -gap
+		}
+		if gap > furthest {
+			furthest = gap
+			status.TargetOffset = timeleapv1alpha1.FormatOffset(target.Round(time.Second))
+			status.CurrentOffset = timeleapv1alpha1.FormatOffset(current.Round(time.Second))
+		}
+	}
+
+	return slewEnd
+}
+
+// setConditions sets the Ready, Progressing and Degraded conditions from the pod counts of status.
+func setConditions(status *timeleapv1alpha1.TimeLeapStatus, generation int64) {
+	setCountConditions(&status.Conditions, generation, status.TargetedPods, status.AppliedPods, status.FailedPods)
+}
+
+// setCountConditions sets the Ready, Progressing and Degraded conditions on conditions from the pod counts.
+func setCountConditions(conditions *[]metav1.Condition, generation int64, targeted, applied, failed int32) {
+	pending := targeted - applied - failed
+
+	ready := metav1.Condition{
+		Type:               timeleapv1alpha1.ConditionReady,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: generation,
+		Message:            fmt.Sprintf("%d/%d pods see the virtual clocks", applied, targeted),
+	}
+	switch {
+	case targeted == 0:
+		ready.Reason = timeleapv1alpha1.ReasonNoTargets
+		ready.Message = "the selector does not match any pod"
+	case failed > 0:
+		ready.Reason = timeleapv1alpha1.ReasonPodsFailed
+	case pending > 0:
+		ready.Reason = timeleapv1alpha1.ReasonApplying
+	default:
+		ready.Status = metav1.ConditionTrue
+		ready.Reason = timeleapv1alpha1.ReasonApplied
+	}
+	meta.SetStatusCondition(conditions, ready)
+
+	progressing := metav1.Condition{
+		Type:               timeleapv1alpha1.ConditionProgressing,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: generation,
+		Reason:             timeleapv1alpha1.ReasonAsExpected,
+	}
+	if pending > 0 {
+		progressing.Status = metav1.ConditionTrue
+		progressing.Reason = timeleapv1alpha1.ReasonApplying
+		progressing.Message = fmt.Sprintf("%d pods are pending", pending)
+	}
+	meta.SetStatusCondition(conditions, progressing)
+
+	degraded := metav1.Condition{
+		Type:               timeleapv1alpha1.ConditionDegraded,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: generation,
+		Reason:             timeleapv1alpha1.ReasonAsExpected,
+	}
+	if failed > 0 {
+		degraded.Status = metav1.ConditionTrue
+		degraded.Reason = timeleapv1alpha1.ReasonPodsFailed
+		degraded.Message = fmt.Sprintf("%d pods failed, see .status.pods for the errors", failed)
+	}
+	meta.SetStatusCondition(conditions, degraded)
+}
+
+// setConflictCondition sets the Conflict condition from the overlaps with the other TimeLeaps.
+func setConflictCondition(status *timeleapv1alpha1.TimeLeapStatus, generation int64, overlaps []timeleapv1alpha1.Overlap) {
+	cond := metav1.Condition{
+		Type:               timeleapv1alpha1.ConditionConflict,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: generation,
+		Reason:             timeleapv1alpha1.ReasonAsExpected,
+	}
+	if len(overlaps) > 0 {
+		msgs := make([]string, len(overlaps))
+		for i, o := range overlaps {
+			msgs[i] = o.String()
+		}
+		cond.Status = metav1.ConditionTrue
+		cond.Reason = timeleapv1alpha1.ReasonOverlapping
+		cond.Message = "overlaps with " + strings.Join(msgs, "; ")
+	}
+	meta.SetStatusCondition(&status.Conditions, cond)
+}
+
+// setExpiredConditions sets the terminal conditions of the expired TimeLeap.
+func setExpiredConditions(status *timeleapv1alpha1.TimeLeapStatus, generation int64, message string) {
+	setExpiredConditionsOn(&status.Conditions, generation, message)
+}
+
+// setExpiredConditionsOn sets the terminal conditions of an expired object on conditions.
+func setExpiredConditionsOn(conditions *[]metav1.Condition, generation int64, message string) {
+	for _, typ := range []string{timeleapv1alpha1.ConditionExpired, timeleapv1alpha1.ConditionReady, timeleapv1alpha1.ConditionProgressing} {
+		cond := metav1.Condition{
+			Type:               typ,
+			Status:             metav1.ConditionFalse,
+			ObservedGeneration: generation,
+			Reason:             timeleapv1alpha1.ReasonTTLExpired,
+			Message:            message,
+		}
+		if typ == timeleapv1alpha1.ConditionExpired {
+			cond.Status = metav1.ConditionTrue
+		}
+		meta.SetStatusCondition(conditions, cond)
+	}
+}
+
+// setSuspendedConditions sets the conditions of the suspended TimeLeap.
+func setSuspendedConditions(status *timeleapv1alpha1.TimeLeapStatus, generation int64, message string) {
+	for _, typ := range []string{timeleapv1alpha1.ConditionSuspended, timeleapv1alpha1.ConditionReady, timeleapv1alpha1.ConditionProgressing} {
+		cond := metav1.Condition{
+			Type:               typ,
+			Status:             metav1.ConditionFalse,
+			ObservedGeneration: generation,
+			Reason:             timeleapv1alpha1.ReasonSuspended,
+			Message:            message,
+		}
+		if typ == timeleapv1alpha1.ConditionSuspended {
+			cond.Status = metav1.ConditionTrue
+		}
+		meta.SetStatusCondition(&status.Conditions, cond)
+	}
+}
+
+// setTerminatingConditions sets the conditions of the deleted TimeLeap which failed to restore the real time
+// on some pods.
+func setTerminatingConditions(status *timeleapv1alpha1.TimeLeapStatus, generation int64, message string) {
+	meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+		Type:               timeleapv1alpha1.ConditionReady,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: generation,
+		Reason:             timeleapv1alpha1.ReasonTerminating,
+		Message:            "the TimeLeap is being deleted",
+	})
+	meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+		Type:               timeleapv1alpha1.ConditionDegraded,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: generation,
+		Reason:             timeleapv1alpha1.ReasonRestoreFailed,
+		Message:            message,
+	})
+}
@@ -0,0 +1,159 @@
+// Copyright 2020 The kube-timeleap Authors.
+// SPDX-License-Identifier: BSD-3-Clause
+
+package controllers
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	timeleapv1alpha1 "github.com/zchee/kube-timeleap/apis/timeleap/v1alpha1"
+	"github.com/zchee/kube-timeleap/pkg/vclock"
+)
+
+func Test_setPodResults(t *testing.T) {
+	results := []timeleapv1alpha1.PodResult{
+		{Name: "c", State: timeleapv1alpha1.PodApplied},
+		{Name: "b", State: timeleapv1alpha1.PodPending},
+		{Name: "a", State: timeleapv1alpha1.PodApplied},
+		{Name: "d", State: timeleapv1alpha1.PodFailed, Message: "boom"},
+	}
+
+	status := &timeleapv1alpha1.TimeLeapStatus{}
+	setPodResults(status, results)
+
+	if status.TargetedPods != 4 || status.AppliedPods != 2 || status.FailedPods != 1 {
+		t.Fatalf("counts = %d/%d/%d, want 4/2/1", status.TargetedPods, status.AppliedPods, status.FailedPods)
+	}
+	want := []timeleapv1alpha1.PodResult{
+		{Name: "d", State: timeleapv1alpha1.PodFailed, Message: "boom"},
+		{Name: "b", State: timeleapv1alpha1.PodPending},
+		{Name: "a", State: timeleapv1alpha1.PodApplied},
+		{Name: "c", State: timeleapv1alpha1.PodApplied},
+	}
+	if diff := cmp.Diff(want, status.Pods); diff != "" {
+		t.Fatalf("(-want +got):\n%s", diff)
+	}
+}
+
+func Test_setPodResults_Bounded(t *testing.T) {
+	results := make([]timeleapv1alpha1.PodResult, 0, 2*timeleapv1alpha1.MaxPodResults)
+	for i := 0; i < cap(results); i++ {
+		results = append(results, timeleapv1alpha1.PodResult{Name: fmt.Sprintf("pod-%03d", i), State: timeleapv1alpha1.PodApplied})
+	}
+	results[len(results)-1].State = timeleapv1alpha1.PodFailed
+
+	status := &timeleapv1alpha1.TimeLeapStatus{}
+	setPodResults(status, results)
+
+	if got := len(status.Pods); got != timeleapv1alpha1.MaxPodResults {
+		t.Fatalf("len(Pods) = %d, want %d", got, timeleapv1alpha1.MaxPodResults)
+	}
+	if got := status.Pods[0].State; got != timeleapv1alpha1.PodFailed {
+		t.Fatalf("first pod state = %s, want %s", got, timeleapv1alpha1.PodFailed)
+	}
+	if status.TargetedPods != int32(len(results)) {
+		t.Fatalf("TargetedPods = %d, want %d", status.TargetedPods, len(results))
+	}
+}
+
+func Test_setConditions(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  timeleapv1alpha1.TimeLeapStatus
+		want    map[string]metav1.ConditionStatus
+		wantWhy string
+	}{
+		{
+			name:   "NoTargets",
+			status: timeleapv1alpha1.TimeLeapStatus{},
+			want: map[string]metav1.ConditionStatus{
+				timeleapv1alpha1.ConditionReady:       metav1.ConditionFalse,
+				timeleapv1alpha1.ConditionProgressing: metav1.ConditionFalse,
+				timeleapv1alpha1.ConditionDegraded:    metav1.ConditionFalse,
+			},
+			wantWhy: timeleapv1alpha1.ReasonNoTargets,
+		},
+		{
+			name:   "Applied",
+			status: timeleapv1alpha1.TimeLeapStatus{TargetedPods: 2, AppliedPods: 2},
+			want: map[string]metav1.ConditionStatus{
+				timeleapv1alpha1.ConditionReady:       metav1.ConditionTrue,
+				timeleapv1alpha1.ConditionProgressing: metav1.ConditionFalse,
+				timeleapv1alpha1.ConditionDegraded:    metav1.ConditionFalse,
+			},
+			wantWhy: timeleapv1alpha1.ReasonApplied,
+		},
+		{
+			name:   "Applying",
+			status: timeleapv1alpha1.TimeLeapStatus{TargetedPods: 2, AppliedPods: 1},
+			want: map[string]metav1.ConditionStatus{
+				timeleapv1alpha1.ConditionReady:       metav1.ConditionFalse,
+				timeleapv1alpha1.ConditionProgressing: metav1.ConditionTrue,
+				timeleapv1alpha1.ConditionDegraded:    metav1.ConditionFalse,
+			},
+			wantWhy: timeleapv1alpha1.ReasonApplying,
+		},
+		{
+			name:   "Failed",
+			status: timeleapv1alpha1.TimeLeapStatus{TargetedPods: 2, AppliedPods: 1, FailedPods: 1},
+			want: map[string]metav1.ConditionStatus{
+				timeleapv1alpha1.ConditionReady:       metav1.ConditionFalse,
+				timeleapv1alpha1.ConditionProgressing: metav1.ConditionFalse,
+				timeleapv1alpha1.ConditionDegraded:    metav1.ConditionTrue,
+			},
+			wantWhy: timeleapv1alpha1.ReasonPodsFailed,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			setConditions(&tt.status, 1)
+
+			for typ, want := range tt.want {
+				cond := meta.FindStatusCondition(tt.status.Conditions, typ)
+				if cond == nil {
+					t.Fatalf("condition %s not found", typ)
+				}
+				if cond.Status != want {
+					t.Fatalf("condition %s = %s, want %s", typ, cond.Status, want)
+				}
+			}
+			if got := meta.FindStatusCondition(tt.status.Conditions, timeleapv1alpha1.ConditionReady).Reason; got != tt.wantWhy {
+				t.Fatalf("Ready reason = %s, want %s", got, tt.wantWhy)
+			}
+		})
+	}
+}
+
+func Test_setOffsets(t *testing.T) {
+	now := epoch.Add(time.Hour)
+	converged := vclock.Set{
+		vclock.Realtime: {Epoch: epoch, Offset: 2 * time.Hour},
+	}
+	slewing := vclock.Set{
+		vclock.Realtime:  {Epoch: epoch, Offset: 2 * time.Hour, Slew: 2 * time.Hour, SlewRate: 0.5},
+		vclock.Monotonic: {Epoch: epoch, Offset: time.Hour, Slew: time.Hour, SlewRate: 0.25},
+	}
+
+	status := &timeleapv1alpha1.TimeLeapStatus{}
+	slewEnd := setOffsets(status, []vclock.Set{converged, slewing}, now)
+
+	if status.TargetOffset != "+2h0m0s" || status.CurrentOffset != "+30m0s" {
+		t.Fatalf("offsets = %s/%s, want +2h0m0s/+30m0s of the slewing pod", status.TargetOffset, status.CurrentOffset)
+	}
+	if want := epoch.Add(4 * time.Hour); !slewEnd.Equal(want) {
+		t.Fatalf("slew end = %v, want %v", slewEnd, want)
+	}
+
+	if slewEnd := setOffsets(status, nil, now); !slewEnd.IsZero() || status.TargetOffset != "" || status.CurrentOffset != "" {
+		t.Fatalf("got %v and offsets %q/%q, want them cleared", slewEnd, status.TargetOffset, status.CurrentOffset)
+	}
+}
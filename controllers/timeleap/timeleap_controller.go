@@ -5,15 +5,26 @@ package controllers
 
 import (
 	"context"
+	"fmt"
+	"time"
 
 	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	kerrors "k8s.io/apimachinery/pkg/util/errors"
 	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	timeleapv1alpha1 "github.com/zchee/kube-timeleap/apis/timeleap/v1alpha1"
+	"github.com/zchee/kube-timeleap/pkg/vclock"
 )
 
 // TimeLeapReconciler reconciles a TimeLeap object.
@@ -22,6 +33,9 @@ type TimeLeapReconciler struct {
 	client.Reader
 	Log    logr.Logger
 	Scheme *runtime.Scheme
+
+	// Applier applies the virtual clocks to the pods. Defaults to the AnnotationApplier.
+	Applier Applier
 }
 
 // compile time check whether the TimeLeapReconciler implements ctrlreconcile.Reconciler interface.
@@ -30,17 +44,257 @@ var _ reconcile.Reconciler = (*TimeLeapReconciler)(nil)
 // +kubebuilder:rbac:groups=timeleap.x-k8s.io,resources=timeleaps,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=timeleap.x-k8s.io,resources=timeleaps/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=timeleap.x-k8s.io,resources=timeleaps/finalizers,verbs=update
+// +kubebuilder:rbac:groups="",resources=pods,verbs=get;list;watch;update;patch
 
 // Reconcile implements a reconcile.Reconciler.
 func (r *TimeLeapReconciler) Reconcile(ctx context.Context, req reconcile.Request) (reconcile.Result, error) {
-	_ = r.Log.WithValues("timeleap", req.NamespacedName)
+	log := r.Log.WithValues("timeleap", req.NamespacedName)
+
+	tl := &timeleapv1alpha1.TimeLeap{}
+	if err := r.Client.Get(ctx, req.NamespacedName, tl); err != nil {
+		return reconcile.Result{}, client.IgnoreNotFound(err)
+	}
+
+	now := time.Now()
+	status := tl.Status.DeepCopy()
+	status.ObservedGeneration = tl.Generation
+
+	if !tl.DeletionTimestamp.IsZero() {
+		return r.finalize(ctx, log, tl, status)
+	}
+	if !controllerutil.ContainsFinalizer(tl, timeleapv1alpha1.Finalizer) {
+		controllerutil.AddFinalizer(tl, timeleapv1alpha1.Finalizer)
+		if err := r.Client.Update(ctx, tl); err != nil {
+			return reconcile.Result{}, fmt.Errorf("add finalizer: %w", err)
+		}
+	}
+
+	var result reconcile.Result
+	status.ExpirationTime = tl.ExpirationTime()
+	if expiry := status.ExpirationTime; expiry != nil {
+		if !now.Before(expiry.Time) {
+			return r.expire(ctx, log, tl, status)
+		}
+		// the expiry is derived from the object itself, so it's rescheduled after the manager restarts too
+		result.RequeueAfter = expiry.Sub(now)
+	}
+
+	frozenAt, err := frozenAt(tl, now)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	refrozen := frozenAt != nil && !frozenAt.Equal(tl.Status.FrozenAt)
+	status.FrozenAt = frozenAt
+	ep, err := virtualEpoch(tl, specHash(tl, frozenAt), now)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	status.Epoch = ep
+
+	if tl.Spec.Suspend {
+		return r.suspend(ctx, log, tl, status, result)
+	}
+	if meta.FindStatusCondition(status.Conditions, timeleapv1alpha1.ConditionSuspended) != nil {
+		// RemoveStatusCondition panics on the empty conditions
+		meta.RemoveStatusCondition(&status.Conditions, timeleapv1alpha1.ConditionSuspended)
+	}
+
+	pods, err := r.targetPods(ctx, tl)
+	if err != nil {
+		return reconcile.Result{}, fmt.Errorf("list target pods: %w", err)
+	}
+
+	var errs []error
+	results := make([]timeleapv1alpha1.PodResult, 0, len(pods))
+	applied := make([]vclock.Set, 0, len(pods))
+	for i := range pods {
+		res, clocks, err := r.applyPod(ctx, tl, ep, frozenAt, &pods[i], now)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("pod %s: %w", pods[i].Name, err))
+		}
+		results = append(results, res)
+		if clocks != nil {
+			applied = append(applied, clocks)
+		}
+	}
+	setPodResults(status, results)
+	setConditions(status, tl.Generation)
+	if slewEnd := setOffsets(status, applied, now); slewEnd.After(now) {
+		// refresh the current offset until every pod has converged
+		d := slewEnd.Sub(now)
+		if d > slewRefreshInterval {
+			d = slewRefreshInterval
+		}
+		if result.RequeueAfter == 0 || d < result.RequeueAfter {
+			result.RequeueAfter = d
+		}
+	}
+
+	tls := &timeleapv1alpha1.TimeLeapList{}
+	if err := r.Client.List(ctx, tls, client.InNamespace(tl.Namespace)); err != nil {
+		errs = append(errs, fmt.Errorf("list TimeLeaps: %w", err))
+	} else {
+		overlaps := timeleapv1alpha1.FindOverlaps(tl, tls.Items, pods)
+		setConflictCondition(status, tl.Generation, overlaps)
+	}
+
+	if released, err := r.releasePods(ctx, tl, pods); err != nil {
+		errs = append(errs, fmt.Errorf("release pods: %w", err))
+	} else if released > 0 {
+		log.Info("restored the real time on unselected pods", "released", released)
+	}
+
+	if err := r.updateStatus(ctx, tl, status); err != nil {
+		return reconcile.Result{}, err
+	}
+	if refrozen {
+		log.Info("Frozen at " + frozenAt.UTC().Format(time.RFC3339))
+	}
+
+	// retry the transient failures with backoff
+	if err := kerrors.NewAggregate(errs); err != nil {
+		return reconcile.Result{}, err
+	}
+
+	return result, nil
+}
+
+// expire restores the real time on the pods driven by the expired tl and marks it as Expired.
+//
+// tl is deleted afterwards if it requests so.
+func (r *TimeLeapReconciler) expire(ctx context.Context, log logr.Logger, tl *timeleapv1alpha1.TimeLeap, status *timeleapv1alpha1.TimeLeapStatus) (reconcile.Result, error) {
+	if !meta.IsStatusConditionTrue(tl.Status.Conditions, timeleapv1alpha1.ConditionExpired) {
+		restored, failed, err := r.restorePods(ctx, tl, nil)
+		if err != nil {
+			if len(failed) > 0 {
+				setPodResults(status, failed)
+				if err := r.updateStatus(ctx, tl, status); err != nil {
+					log.Error(err, "unable to report the pods failed to restore")
+				}
+			}
+			return reconcile.Result{}, fmt.Errorf("restore pods: %w", err)
+		}
+
+		status.FrozenAt = nil
+		status.Epoch = nil
+		setPodResults(status, nil)
+		setOffsets(status, nil, time.Time{})
+		setExpiredConditions(status, tl.Generation, fmt.Sprintf("TTL %s elapsed, restored the real time on %d pods", tl.Spec.TTL.Duration, restored))
+		if err := r.updateStatus(ctx, tl, status); err != nil {
+			return reconcile.Result{}, err
+		}
+		log.Info("expired", "restored", restored)
+	}
+
+	if tl.Spec.DeleteOnExpiry {
+		if err := r.Client.Delete(ctx, tl); err != nil {
+			return reconcile.Result{}, client.IgnoreNotFound(err)
+		}
+		log.Info("deleted expired TimeLeap")
+	}
 
 	return reconcile.Result{}, nil
 }
 
+// suspend restores the real time on the pods driven by the suspended tl and marks it as Suspended.
+//
+// Unlike expire the epoch is kept, so resuming tl continues the virtual time.
+func (r *TimeLeapReconciler) suspend(ctx context.Context, log logr.Logger, tl *timeleapv1alpha1.TimeLeap, status *timeleapv1alpha1.TimeLeapStatus, result reconcile.Result) (reconcile.Result, error) {
+	restored, failed, err := r.restorePods(ctx, tl, nil)
+	setPodResults(status, failed)
+	setOffsets(status, nil, time.Time{})
+	setSuspendedConditions(status, tl.Generation, fmt.Sprintf("suspended, the real time is restored on %d pods", restored))
+	if err := r.updateStatus(ctx, tl, status); err != nil {
+		return reconcile.Result{}, err
+	}
+	if err != nil {
+		return reconcile.Result{}, fmt.Errorf("restore pods: %w", err)
+	}
+	if restored > 0 {
+		log.Info("suspended", "restored", restored)
+	}
+
+	return result, nil
+}
+
+// finalize restores the real time on every pod driven by the deleted tl, and then removes the finalizer
+// to let tl go.
+//
+// The pods which failed to be restored are reported in the status, and tl is held until they are restored
+// or gone.
+func (r *TimeLeapReconciler) finalize(ctx context.Context, log logr.Logger, tl *timeleapv1alpha1.TimeLeap, status *timeleapv1alpha1.TimeLeapStatus) (reconcile.Result, error) {
+	if !controllerutil.ContainsFinalizer(tl, timeleapv1alpha1.Finalizer) {
+		return reconcile.Result{}, nil
+	}
+
+	restored, failed, err := r.restorePods(ctx, tl, nil)
+	if err != nil {
+		setPodResults(status, failed)
+		setTerminatingConditions(status, tl.Generation, fmt.Sprintf("failed to restore the real time on %d pods, see .status.pods for the errors", len(failed)))
+		if err := r.updateStatus(ctx, tl, status); err != nil {
+			log.Error(err, "unable to report the pods failed to restore")
+		}
+		return reconcile.Result{}, fmt.Errorf("restore pods: %w", err)
+	}
+
+	controllerutil.RemoveFinalizer(tl, timeleapv1alpha1.Finalizer)
+	if err := r.Client.Update(ctx, tl); err != nil {
+		return reconcile.Result{}, client.IgnoreNotFound(err)
+	}
+	log.Info("restored the real time on deletion", "restored", restored)
+
+	return reconcile.Result{}, nil
+}
+
+// updateStatus updates the status of tl to status if it has changed.
+func (r *TimeLeapReconciler) updateStatus(ctx context.Context, tl *timeleapv1alpha1.TimeLeap, status *timeleapv1alpha1.TimeLeapStatus) error {
+	if equality.Semantic.DeepEqual(&tl.Status, status) {
+		return nil
+	}
+
+	tl.Status = *status
+	if err := r.Client.Status().Update(ctx, tl); err != nil {
+		return fmt.Errorf("update status: %w", err)
+	}
+
+	return nil
+}
+
+// frozenAt returns the virtual instant a frozen TimeLeap pins its targets at, or nil if tl is not frozen.
+//
+// The instant is evaluated once per spec, so the clock stays pinned until the spec is updated and then
+// resumes from the newly selected instant. The updates which keep the epoch, e.g. suspending tl, keep the
+// instant too.
+func frozenAt(tl *timeleapv1alpha1.TimeLeap, now time.Time) (*metav1.Time, error) {
+	if !tl.Spec.IsFrozen() {
+		return nil, nil
+	}
+	if prev := tl.Status.FrozenAt; prev != nil {
+		if tl.Status.ObservedGeneration == tl.Generation {
+			return prev, nil
+		}
+		if ep := tl.Status.Epoch; ep != nil && ep.SpecHash == specHash(tl, prev) {
+			return prev, nil
+		}
+	}
+
+	offset, err := tl.Spec.OffsetAt(now)
+	if err != nil {
+		return nil, err
+	}
+	t := metav1.NewTime(now.Add(offset)).Rfc3339Copy()
+
+	return &t, nil
+}
+
 // SetupWithManager setups the Controller with manager.Manager.
 func (r *TimeLeapReconciler) SetupWithManager(mgr manager.Manager) error {
+	if r.Applier == nil {
+		r.Applier = &AnnotationApplier{Client: r.Client}
+	}
+
 	return builder.ControllerManagedBy(mgr).
 		For(&timeleapv1alpha1.TimeLeap{}).
+		Watches(&source.Kind{Type: &corev1.Pod{}}, handler.EnqueueRequestsFromMapFunc(r.podToTimeLeaps)).
 		Complete(r)
 }
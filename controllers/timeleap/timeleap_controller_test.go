@@ -0,0 +1,556 @@
+// Copyright 2020 The kube-timeleap Authors.
+// SPDX-License-Identifier: BSD-3-Clause
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	injectorv1alpha1 "github.com/zchee/kube-timeleap/apis/injector/v1alpha1"
+	timeleapv1alpha1 "github.com/zchee/kube-timeleap/apis/timeleap/v1alpha1"
+	"github.com/zchee/kube-timeleap/pkg/vclock"
+)
+
+// failingApplier is the AnnotationApplier which fails to restore the listed pods.
+type failingApplier struct {
+	*AnnotationApplier
+	failures map[string]bool
+}
+
+func (a *failingApplier) Restore(ctx context.Context, pod *corev1.Pod) error {
+	if a.failures[pod.Name] {
+		return errors.New("agent unreachable")
+	}
+
+	return a.AnnotationApplier.Restore(ctx, pod)
+}
+
+func newTestReconciler(t *testing.T, failures map[string]bool, objs ...client.Object) *TimeLeapReconciler {
+	t.Helper()
+
+	c := newFakeClient(t, objs...)
+
+	return &TimeLeapReconciler{
+		Client:  c,
+		Log:     log.NullLogger{},
+		Scheme:  c.Scheme(),
+		Applier: &failingApplier{AnnotationApplier: &AnnotationApplier{Client: c}, failures: failures},
+	}
+}
+
+func drivenPod(name, timeleap string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      name,
+			Annotations: map[string]string{
+				timeleapv1alpha1.TimeLeapAnnotation: timeleap,
+				timeleapv1alpha1.SpecHashAnnotation: "hash",
+				timeleapv1alpha1.ClocksAnnotation:   "{}",
+			},
+		},
+	}
+}
+
+func TestTimeLeapReconciler_Finalize(t *testing.T) {
+	deleted := metav1.Now()
+	tl := &timeleapv1alpha1.TimeLeap{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:         "default",
+			Name:              "leap",
+			DeletionTimestamp: &deleted,
+			Finalizers:        []string{timeleapv1alpha1.Finalizer},
+		},
+	}
+	key := client.ObjectKey{Namespace: tl.Namespace, Name: tl.Name}
+	req := reconcile.Request{NamespacedName: key}
+	ctx := context.Background()
+
+	failures := map[string]bool{"stuck": true}
+	r := newTestReconciler(t, failures, tl, drivenPod("ok", "leap"), drivenPod("stuck", "leap"), drivenPod("other", "another"))
+
+	if _, err := r.Reconcile(ctx, req); err == nil {
+		t.Fatal("Reconcile() succeeded with an unrestored pod")
+	}
+
+	got := &timeleapv1alpha1.TimeLeap{}
+	if err := r.Client.Get(ctx, key, got); err != nil {
+		t.Fatal(err)
+	}
+	if !controllerutil.ContainsFinalizer(got, timeleapv1alpha1.Finalizer) {
+		t.Fatal("finalizer removed before every pod is restored")
+	}
+	if len(got.Status.Pods) != 1 || got.Status.Pods[0].Name != "stuck" || got.Status.Pods[0].State != timeleapv1alpha1.PodFailed {
+		t.Fatalf("Pods = %+v, want only the stuck pod failed", got.Status.Pods)
+	}
+	if cond := meta.FindStatusCondition(got.Status.Conditions, timeleapv1alpha1.ConditionDegraded); cond == nil || cond.Reason != timeleapv1alpha1.ReasonRestoreFailed {
+		t.Fatalf("Degraded condition = %+v, want reason %s", cond, timeleapv1alpha1.ReasonRestoreFailed)
+	}
+
+	pods := map[string]bool{"ok": false, "stuck": true, "other": true}
+	for name, annotated := range pods {
+		pod := &corev1.Pod{}
+		if err := r.Client.Get(ctx, client.ObjectKey{Namespace: "default", Name: name}, pod); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := pod.Annotations[timeleapv1alpha1.ClocksAnnotation]; ok != annotated {
+			t.Fatalf("pod %s annotated = %t, want %t", name, ok, annotated)
+		}
+	}
+
+	delete(failures, "stuck")
+	if _, err := r.Reconcile(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+	got = &timeleapv1alpha1.TimeLeap{}
+	if err := r.Client.Get(ctx, key, got); err != nil {
+		t.Fatal(err)
+	}
+	if controllerutil.ContainsFinalizer(got, timeleapv1alpha1.Finalizer) {
+		t.Fatal("finalizer not removed after every pod is restored")
+	}
+}
+
+func TestTimeLeapReconciler_AddFinalizer(t *testing.T) {
+	tl := &timeleapv1alpha1.TimeLeap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "leap"},
+	}
+	key := client.ObjectKey{Namespace: tl.Namespace, Name: tl.Name}
+	ctx := context.Background()
+
+	r := newTestReconciler(t, nil, tl)
+	if _, err := r.Reconcile(ctx, reconcile.Request{NamespacedName: key}); err != nil {
+		t.Fatal(err)
+	}
+
+	got := &timeleapv1alpha1.TimeLeap{}
+	if err := r.Client.Get(ctx, key, got); err != nil {
+		t.Fatal(err)
+	}
+	if !controllerutil.ContainsFinalizer(got, timeleapv1alpha1.Finalizer) {
+		t.Fatal("finalizer not added")
+	}
+}
+
+func TestTimeLeapReconciler_Conflict(t *testing.T) {
+	selecting := func(name string, matchLabels map[string]string) *timeleapv1alpha1.TimeLeap {
+		return &timeleapv1alpha1.TimeLeap{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:  "default",
+				Name:       name,
+				Finalizers: []string{timeleapv1alpha1.Finalizer},
+			},
+			Spec: timeleapv1alpha1.TimeLeapSpec{
+				Selector: metav1.LabelSelector{MatchLabels: matchLabels},
+				Offset:   "+24h",
+			},
+		}
+	}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "sample-0",
+			// relabeled after both TimeLeaps were admitted
+			Labels: map[string]string{"app": "sample", "tier": "web"},
+		},
+	}
+	ctx := context.Background()
+	key := client.ObjectKey{Namespace: "default", Name: "leap"}
+
+	r := newTestReconciler(t, nil, selecting("leap", map[string]string{"app": "sample"}), selecting("web", map[string]string{"tier": "web"}), pod)
+	if _, err := r.Reconcile(ctx, reconcile.Request{NamespacedName: key}); err != nil {
+		t.Fatal(err)
+	}
+
+	got := &timeleapv1alpha1.TimeLeap{}
+	if err := r.Client.Get(ctx, key, got); err != nil {
+		t.Fatal(err)
+	}
+	cond := meta.FindStatusCondition(got.Status.Conditions, timeleapv1alpha1.ConditionConflict)
+	if cond == nil || cond.Status != metav1.ConditionTrue || cond.Reason != timeleapv1alpha1.ReasonOverlapping {
+		t.Fatalf("Conflict condition = %+v, want overlapping", cond)
+	}
+}
+
+func TestTimeLeapReconciler_Skew(t *testing.T) {
+	skew := &timeleapv1alpha1.SkewSpec{Min: "-1s", Max: "+1s", Seed: 1}
+	tl := &timeleapv1alpha1.TimeLeap{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:  "default",
+			Name:       "leap",
+			Finalizers: []string{timeleapv1alpha1.Finalizer},
+		},
+		Spec: timeleapv1alpha1.TimeLeapSpec{
+			Selector: metav1.LabelSelector{MatchLabels: map[string]string{"app": "etcd"}},
+			Offset:   "+24h",
+			Skew:     skew,
+		},
+	}
+	member := func(name string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "default",
+				Name:      name,
+				Labels:    map[string]string{"app": "etcd", injectorv1alpha1.InjectedLabel: "true"},
+			},
+		}
+	}
+	ctx := context.Background()
+	key := client.ObjectKey{Namespace: "default", Name: "leap"}
+
+	// more pods than the status can list, the skew of the others is still recorded on the pods
+	objs := []client.Object{tl}
+	for i := 0; i < timeleapv1alpha1.MaxPodResults+2; i++ {
+		objs = append(objs, member(fmt.Sprintf("etcd-%d", i)))
+	}
+	r := newTestReconciler(t, nil, objs...)
+	if _, err := r.Reconcile(ctx, reconcile.Request{NamespacedName: key}); err != nil {
+		t.Fatal(err)
+	}
+
+	got := &timeleapv1alpha1.TimeLeap{}
+	if err := r.Client.Get(ctx, key, got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Status.Pods) != timeleapv1alpha1.MaxPodResults || int(got.Status.AppliedPods) != len(objs)-1 {
+		t.Fatalf("Pods = %d results of %d applied, want %d results of %d applied", len(got.Status.Pods), got.Status.AppliedPods, timeleapv1alpha1.MaxPodResults, len(objs)-1)
+	}
+	for _, res := range got.Status.Pods {
+		want, err := skew.For(res.Name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.State != timeleapv1alpha1.PodApplied || res.Skew != timeleapv1alpha1.FormatOffset(want) {
+			t.Fatalf("pod %s = %+v, want applied with skew %s", res.Name, res, timeleapv1alpha1.FormatOffset(want))
+		}
+	}
+	for _, obj := range objs[1:] {
+		want, err := skew.For(obj.GetName())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		pod := &corev1.Pod{}
+		if err := r.Client.Get(ctx, client.ObjectKey{Namespace: "default", Name: obj.GetName()}, pod); err != nil {
+			t.Fatal(err)
+		}
+		if got := pod.Annotations[timeleapv1alpha1.SkewAnnotation]; got != timeleapv1alpha1.FormatOffset(want) {
+			t.Fatalf("pod %s skew annotation = %q, want %q", pod.Name, got, timeleapv1alpha1.FormatOffset(want))
+		}
+		leap, err := r.Applier.Applied(pod)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c := leap.Clocks[vclock.Realtime]
+		if off := c.OffsetAt(c.Epoch); off != 24*time.Hour+want {
+			t.Fatalf("pod %s offset = %v, want %v", pod.Name, off, 24*time.Hour+want)
+		}
+	}
+}
+
+func TestTimeLeapReconciler_Suspend(t *testing.T) {
+	tl := &timeleapv1alpha1.TimeLeap{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:  "default",
+			Name:       "leap",
+			Finalizers: []string{timeleapv1alpha1.Finalizer},
+		},
+		Spec: timeleapv1alpha1.TimeLeapSpec{
+			Selector: metav1.LabelSelector{MatchLabels: map[string]string{"app": "sample"}},
+			Offset:   "+24h",
+			Rate:     "2",
+		},
+	}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "sample",
+			Labels:    map[string]string{"app": "sample", injectorv1alpha1.InjectedLabel: "true"},
+		},
+	}
+	ctx := context.Background()
+	key := client.ObjectKey{Namespace: "default", Name: "leap"}
+	podKey := client.ObjectKey{Namespace: "default", Name: "sample"}
+
+	r := newTestReconciler(t, nil, tl, pod)
+	reconcileAndGet := func(t *testing.T) (*timeleapv1alpha1.TimeLeap, *Leap) {
+		t.Helper()
+
+		if _, err := r.Reconcile(ctx, reconcile.Request{NamespacedName: key}); err != nil {
+			t.Fatal(err)
+		}
+		got := &timeleapv1alpha1.TimeLeap{}
+		if err := r.Client.Get(ctx, key, got); err != nil {
+			t.Fatal(err)
+		}
+		p := &corev1.Pod{}
+		if err := r.Client.Get(ctx, podKey, p); err != nil {
+			t.Fatal(err)
+		}
+		leap, err := r.Applier.Applied(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return got, leap
+	}
+
+	got, leap := reconcileAndGet(t)
+	if leap == nil {
+		t.Fatal("the virtual clocks are not applied")
+	}
+
+	// suspending restores the real time and keeps the epoch
+	got.Spec.Suspend = true
+	if err := r.Client.Update(ctx, got); err != nil {
+		t.Fatal(err)
+	}
+	got, leap = reconcileAndGet(t)
+	if leap != nil {
+		t.Fatalf("got %+v, want the real time restored", leap)
+	}
+	if !meta.IsStatusConditionTrue(got.Status.Conditions, timeleapv1alpha1.ConditionSuspended) {
+		t.Fatal("Suspended condition is not true")
+	}
+	if got.Status.Epoch == nil || got.Status.Epoch.SuspendedAt == nil {
+		t.Fatalf("epoch = %+v, want kept and suspended", got.Status.Epoch)
+	}
+
+	// ran for an hour at the rate 2 and then suspended for an hour
+	now := time.Now().Truncate(time.Microsecond)
+	started, suspended := metav1.NewMicroTime(now.Add(-2*time.Hour)), metav1.NewMicroTime(now.Add(-time.Hour))
+	got.Status.Epoch.Time, got.Status.Epoch.Origin, got.Status.Epoch.SuspendedAt = started, started, &suspended
+	if err := r.Client.Status().Update(ctx, got); err != nil {
+		t.Fatal(err)
+	}
+
+	// resuming continues the virtual time from the instant it was suspended at
+	got.Spec.Suspend = false
+	if err := r.Client.Update(ctx, got); err != nil {
+		t.Fatal(err)
+	}
+	got, leap = reconcileAndGet(t)
+	if leap == nil {
+		t.Fatal("the virtual clocks are not applied again")
+	}
+	if meta.FindStatusCondition(got.Status.Conditions, timeleapv1alpha1.ConditionSuspended) != nil {
+		t.Fatal("Suspended condition is left")
+	}
+	c := leap.Clocks[vclock.Realtime]
+	if want := suspended.Add(25 * time.Hour); !c.At(c.Epoch).Equal(want) {
+		t.Fatalf("resumed at %v, want %v", c.At(c.Epoch), want)
+	}
+}
+
+func TestTimeLeapReconciler_Freeze(t *testing.T) {
+	tl := &timeleapv1alpha1.TimeLeap{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:  "default",
+			Name:       "leap",
+			Generation: 1,
+			Finalizers: []string{timeleapv1alpha1.Finalizer},
+		},
+		Spec: timeleapv1alpha1.TimeLeapSpec{
+			Selector: metav1.LabelSelector{MatchLabels: map[string]string{"app": "sample"}},
+			Mode:     timeleapv1alpha1.FreezeMode,
+			Offset:   "+24h",
+		},
+	}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "sample",
+			Labels:    map[string]string{"app": "sample", injectorv1alpha1.InjectedLabel: "true"},
+		},
+	}
+	ctx := context.Background()
+	key := client.ObjectKey{Namespace: "default", Name: "leap"}
+	podKey := client.ObjectKey{Namespace: "default", Name: "sample"}
+
+	r := newTestReconciler(t, nil, tl, pod)
+	reconcileAndGet := func(t *testing.T) (*timeleapv1alpha1.TimeLeap, vclock.Clock) {
+		t.Helper()
+
+		if _, err := r.Reconcile(ctx, reconcile.Request{NamespacedName: key}); err != nil {
+			t.Fatal(err)
+		}
+		got := &timeleapv1alpha1.TimeLeap{}
+		if err := r.Client.Get(ctx, key, got); err != nil {
+			t.Fatal(err)
+		}
+		p := &corev1.Pod{}
+		if err := r.Client.Get(ctx, podKey, p); err != nil {
+			t.Fatal(err)
+		}
+		leap, err := r.Applier.Applied(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if leap == nil {
+			t.Fatal("the virtual clocks are not applied")
+		}
+
+		return got, leap.Clocks[vclock.Realtime]
+	}
+	checkFrozen := func(t *testing.T, got *timeleapv1alpha1.TimeLeap, c vclock.Clock, lower, upper time.Time) {
+		t.Helper()
+
+		if got.Status.FrozenAt == nil {
+			t.Fatal("FrozenAt is not set")
+		}
+		frozen := got.Status.FrozenAt.Time
+		if frozen.Before(lower.Truncate(time.Second)) || frozen.After(upper) {
+			t.Fatalf("FrozenAt = %v, want within [%v, %v]", frozen, lower, upper)
+		}
+		if !c.Frozen || !c.At(time.Now()).Equal(frozen) {
+			t.Fatalf("pod clock = %+v, want frozen at %v", c, frozen)
+		}
+	}
+
+	before := time.Now()
+	got, c := reconcileAndGet(t)
+	checkFrozen(t, got, c, before.Add(24*time.Hour), time.Now().Add(24*time.Hour))
+
+	// the instant is evaluated once per spec, so the instant evaluated earlier is kept
+	earlier := metav1.NewTime(got.Status.FrozenAt.Add(-time.Hour))
+	got.Status.FrozenAt = &earlier
+	if err := r.Client.Status().Update(ctx, got); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		got, c = reconcileAndGet(t)
+		checkFrozen(t, got, c, earlier.Time, earlier.Time)
+	}
+
+	// updating the spec selects the instant again; the fake client does not bump the generation
+	got.Spec.Offset = "+48h"
+	got.Generation++
+	if err := r.Client.Update(ctx, got); err != nil {
+		t.Fatal(err)
+	}
+	before = time.Now()
+	got, c = reconcileAndGet(t)
+	checkFrozen(t, got, c, before.Add(48*time.Hour), time.Now().Add(48*time.Hour))
+}
+
+func TestTimeLeapReconciler_TTL(t *testing.T) {
+	tests := []struct {
+		name           string
+		age            time.Duration
+		deleteOnExpiry bool
+		wantExpired    bool
+		wantDeleted    bool
+	}{
+		{
+			name: "Running",
+			age:  time.Minute,
+		},
+		{
+			name:        "Expired",
+			age:         2 * time.Hour,
+			wantExpired: true,
+		},
+		{
+			name:           "DeleteOnExpiry",
+			age:            2 * time.Hour,
+			deleteOnExpiry: true,
+			wantExpired:    true,
+			wantDeleted:    true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			const ttl = time.Hour
+			created := metav1.NewTime(time.Now().Add(-tt.age).Truncate(time.Second))
+			tl := &timeleapv1alpha1.TimeLeap{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace:         "default",
+					Name:              "leap",
+					CreationTimestamp: created,
+					Finalizers:        []string{timeleapv1alpha1.Finalizer},
+				},
+				Spec: timeleapv1alpha1.TimeLeapSpec{
+					Selector:       metav1.LabelSelector{MatchLabels: map[string]string{"app": "sample"}},
+					Offset:         "+24h",
+					TTL:            &metav1.Duration{Duration: ttl},
+					DeleteOnExpiry: tt.deleteOnExpiry,
+				},
+			}
+			pod := drivenPod("sample", "leap")
+			pod.Labels = map[string]string{"app": "sample", injectorv1alpha1.InjectedLabel: "true"}
+			ctx := context.Background()
+			key := client.ObjectKey{Namespace: "default", Name: "leap"}
+
+			r := newTestReconciler(t, nil, tl, pod)
+			before := time.Now()
+			result, err := r.Reconcile(ctx, reconcile.Request{NamespacedName: key})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			p := &corev1.Pod{}
+			if err := r.Client.Get(ctx, client.ObjectKey{Namespace: "default", Name: "sample"}, p); err != nil {
+				t.Fatal(err)
+			}
+			leap, err := r.Applier.Applied(p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if restored := leap == nil; restored != tt.wantExpired {
+				t.Fatalf("pod restored = %t, want %t", restored, tt.wantExpired)
+			}
+
+			got := &timeleapv1alpha1.TimeLeap{}
+			err = r.Client.Get(ctx, key, got)
+			if tt.wantDeleted {
+				if !apierrors.IsNotFound(err) {
+					t.Fatalf("Get() = %v, want the expired TimeLeap deleted", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if want := created.Add(ttl); got.Status.ExpirationTime == nil || !got.Status.ExpirationTime.Time.Equal(want) {
+				t.Fatalf("ExpirationTime = %v, want %v", got.Status.ExpirationTime, want)
+			}
+			cond := meta.FindStatusCondition(got.Status.Conditions, timeleapv1alpha1.ConditionExpired)
+			if !tt.wantExpired {
+				if cond != nil {
+					t.Fatalf("Expired condition = %+v, want none", cond)
+				}
+				// requeued when the TTL elapses
+				if remaining := created.Add(ttl).Sub(before); result.RequeueAfter <= 0 || result.RequeueAfter > remaining {
+					t.Fatalf("RequeueAfter = %v, want the remaining TTL %v", result.RequeueAfter, remaining)
+				}
+				return
+			}
+			if cond == nil || cond.Status != metav1.ConditionTrue || cond.Reason != timeleapv1alpha1.ReasonTTLExpired {
+				t.Fatalf("Expired condition = %+v, want true with reason %s", cond, timeleapv1alpha1.ReasonTTLExpired)
+			}
+			if got.Status.Epoch != nil || got.Status.Pods != nil {
+				t.Fatalf("status = %+v, want the epoch and the pods cleared", got.Status)
+			}
+			if result.RequeueAfter != 0 {
+				t.Fatalf("RequeueAfter = %v, want no requeue after expiry", result.RequeueAfter)
+			}
+		})
+	}
+}
@@ -0,0 +1,162 @@
+// Copyright 2020 The kube-timeleap Authors.
+// SPDX-License-Identifier: BSD-3-Clause
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	timeleapv1alpha1 "github.com/zchee/kube-timeleap/apis/timeleap/v1alpha1"
+)
+
+// TimeLeapScheduleReconciler reconciles a TimeLeapSchedule object.
+//
+// The TimeLeapScheduleReconciler drives the TimeLeapSchedule through a TimeLeap named after it, whose spec
+// is updated at every step.
+type TimeLeapScheduleReconciler struct {
+	client.Client
+	Log    logr.Logger
+	Scheme *runtime.Scheme
+}
+
+// compile time check whether the TimeLeapScheduleReconciler implements ctrlreconcile.Reconciler interface.
+var _ reconcile.Reconciler = (*TimeLeapScheduleReconciler)(nil)
+
+// +kubebuilder:rbac:groups=timeleap.x-k8s.io,resources=timeleapschedules,verbs=get;list;watch;update;patch
+// +kubebuilder:rbac:groups=timeleap.x-k8s.io,resources=timeleapschedules/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=timeleap.x-k8s.io,resources=timeleapschedules/finalizers,verbs=update
+
+// Reconcile implements a reconcile.Reconciler.
+func (r *TimeLeapScheduleReconciler) Reconcile(ctx context.Context, req reconcile.Request) (reconcile.Result, error) {
+	log := r.Log.WithValues("timeleapschedule", req.NamespacedName)
+
+	tls := &timeleapv1alpha1.TimeLeapSchedule{}
+	if err := r.Client.Get(ctx, req.NamespacedName, tls); err != nil {
+		return reconcile.Result{}, client.IgnoreNotFound(err)
+	}
+	if !tls.DeletionTimestamp.IsZero() {
+		// the owned TimeLeap is garbage collected, and restores the real time by its finalizer
+		return reconcile.Result{}, nil
+	}
+
+	child, err := r.ownedTimeLeap(ctx, tls)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+
+	now := time.Now()
+	status := tls.Status.DeepCopy()
+	step, start := int(status.CurrentStep), now
+	switch {
+	case status.ObservedGeneration != tls.Generation || (status.StepStartTime == nil && status.CompletionTime == nil):
+		// new or the spec has changed, start from the first step
+		step = 0
+		status.CompletionTime = nil
+	case status.StepStartTime != nil:
+		start = status.StepStartTime.Time
+	}
+	status.ObservedGeneration = tls.Generation
+
+	step, start = tls.Spec.Advance(step, start, now)
+	if step != int(tls.Status.CurrentStep) {
+		log.Info("stepped", "step", step, "steps", len(tls.Spec.Steps))
+	}
+	status.CurrentStep = int32(step)
+
+	if step >= len(tls.Spec.Steps) {
+		return reconcile.Result{}, r.complete(ctx, log, tls, status, child, start)
+	}
+
+	if err := syncOwnedTimeLeap(ctx, r.Client, r.Scheme, tls, timeleapv1alpha1.TimeLeapScheduleLabel, tls.Namespace, child, tls.Spec.StepSpec(step)); err != nil {
+		return reconcile.Result{}, err
+	}
+
+	next := start.Add(tls.Spec.Steps[step].Dwell.Duration)
+	status.StepStartTime = &metav1.Time{Time: start}
+	status.NextStepTime = &metav1.Time{Time: next}
+	meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+		Type:               timeleapv1alpha1.ConditionCompleted,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: tls.Generation,
+		Reason:             timeleapv1alpha1.ReasonStepping,
+		Message:            fmt.Sprintf("step %d/%d", step+1, len(tls.Spec.Steps)),
+	})
+	if err := r.updateStatus(ctx, tls, status); err != nil {
+		return reconcile.Result{}, err
+	}
+
+	return reconcile.Result{RequeueAfter: next.Sub(now)}, nil
+}
+
+// ownedTimeLeap returns the TimeLeap controlled by tls, or nil if it does not exist.
+func (r *TimeLeapScheduleReconciler) ownedTimeLeap(ctx context.Context, tls *timeleapv1alpha1.TimeLeapSchedule) (*timeleapv1alpha1.TimeLeap, error) {
+	tl := &timeleapv1alpha1.TimeLeap{}
+	if err := r.Client.Get(ctx, client.ObjectKey{Namespace: tls.Namespace, Name: tls.Name}, tl); err != nil {
+		return nil, client.IgnoreNotFound(err)
+	}
+	if !metav1.IsControlledBy(tl, tls) {
+		return nil, fmt.Errorf("TimeLeap %s already exists and is not owned by %s", tl.Name, tls.Name)
+	}
+
+	return tl, nil
+}
+
+// complete deletes the TimeLeap owned by tls, which restores the real time on the pods, and marks tls as
+// Completed at completedAt.
+func (r *TimeLeapScheduleReconciler) complete(ctx context.Context, log logr.Logger, tls *timeleapv1alpha1.TimeLeapSchedule, status *timeleapv1alpha1.TimeLeapScheduleStatus, child *timeleapv1alpha1.TimeLeap, completedAt time.Time) error {
+	if child != nil {
+		if err := r.Client.Delete(ctx, child); client.IgnoreNotFound(err) != nil {
+			return fmt.Errorf("delete TimeLeap: %w", err)
+		}
+	}
+
+	if status.CompletionTime == nil {
+		status.CompletionTime = &metav1.Time{Time: completedAt}
+		log.Info("completed")
+	}
+	status.StepStartTime = nil
+	status.NextStepTime = nil
+	meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+		Type:               timeleapv1alpha1.ConditionCompleted,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: tls.Generation,
+		Reason:             timeleapv1alpha1.ReasonStepsCompleted,
+		Message:            fmt.Sprintf("%d steps completed, the real time is restored", len(tls.Spec.Steps)),
+	})
+
+	return r.updateStatus(ctx, tls, status)
+}
+
+// updateStatus updates the status of tls to status if it has changed.
+func (r *TimeLeapScheduleReconciler) updateStatus(ctx context.Context, tls *timeleapv1alpha1.TimeLeapSchedule, status *timeleapv1alpha1.TimeLeapScheduleStatus) error {
+	if equality.Semantic.DeepEqual(&tls.Status, status) {
+		return nil
+	}
+
+	tls.Status = *status
+	if err := r.Client.Status().Update(ctx, tls); err != nil {
+		return fmt.Errorf("update status: %w", err)
+	}
+
+	return nil
+}
+
+// SetupWithManager setups the Controller with manager.Manager.
+func (r *TimeLeapScheduleReconciler) SetupWithManager(mgr manager.Manager) error {
+	return builder.ControllerManagedBy(mgr).
+		For(&timeleapv1alpha1.TimeLeapSchedule{}).
+		Owns(&timeleapv1alpha1.TimeLeap{}).
+		Complete(r)
+}
@@ -0,0 +1,201 @@
+// Copyright 2020 The kube-timeleap Authors.
+// SPDX-License-Identifier: BSD-3-Clause
+
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	timeleapv1alpha1 "github.com/zchee/kube-timeleap/apis/timeleap/v1alpha1"
+)
+
+func TestTimeLeapScheduleReconciler_Reconcile(t *testing.T) {
+	tls := &timeleapv1alpha1.TimeLeapSchedule{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:  "default",
+			Name:       "month-end",
+			UID:        "tls-uid",
+			Generation: 1,
+		},
+		Spec: timeleapv1alpha1.TimeLeapScheduleSpec{
+			Selector: metav1.LabelSelector{MatchLabels: map[string]string{"app": "sample"}},
+			Steps: []timeleapv1alpha1.ScheduleStep{
+				{Offset: "+30d", Dwell: metav1.Duration{Duration: time.Hour}},
+				{Offset: "+60d", Dwell: metav1.Duration{Duration: time.Hour}},
+			},
+		},
+	}
+	ctx := context.Background()
+	key := client.ObjectKey{Namespace: "default", Name: "month-end"}
+
+	r := newTestReconciler(t, nil, tls)
+	sr := &TimeLeapScheduleReconciler{Client: r.Client, Log: log.NullLogger{}, Scheme: r.Scheme}
+	reconcileAndGet := func(t *testing.T) *timeleapv1alpha1.TimeLeapSchedule {
+		t.Helper()
+
+		if _, err := sr.Reconcile(ctx, reconcile.Request{NamespacedName: key}); err != nil {
+			t.Fatal(err)
+		}
+		got := &timeleapv1alpha1.TimeLeapSchedule{}
+		if err := r.Client.Get(ctx, key, got); err != nil {
+			t.Fatal(err)
+		}
+
+		return got
+	}
+	childSpec := func(t *testing.T) timeleapv1alpha1.TimeLeapSpec {
+		t.Helper()
+
+		tl := &timeleapv1alpha1.TimeLeap{}
+		if err := r.Client.Get(ctx, key, tl); err != nil {
+			t.Fatal(err)
+		}
+		if !metav1.IsControlledBy(tl, tls) {
+			t.Fatal("TimeLeap is not controlled by the TimeLeapSchedule")
+		}
+
+		return tl.Spec
+	}
+
+	// the first step starts on the first observation
+	got := reconcileAndGet(t)
+	if got.Status.CurrentStep != 0 || got.Status.StepStartTime == nil || got.Status.NextStepTime == nil {
+		t.Fatalf("status = %+v, want the first step in progress", got.Status)
+	}
+	if diff := cmp.Diff(tls.Spec.StepSpec(0), childSpec(t)); diff != "" {
+		t.Fatalf("first step: (-want +got):\n%s", diff)
+	}
+
+	// the first step has dwelt
+	got.Status.StepStartTime = &metav1.Time{Time: time.Now().Add(-90 * time.Minute)}
+	if err := r.Client.Status().Update(ctx, got); err != nil {
+		t.Fatal(err)
+	}
+	got = reconcileAndGet(t)
+	if got.Status.CurrentStep != 1 {
+		t.Fatalf("currentStep = %d, want 1", got.Status.CurrentStep)
+	}
+	if diff := cmp.Diff(tls.Spec.StepSpec(1), childSpec(t)); diff != "" {
+		t.Fatalf("second step: (-want +got):\n%s", diff)
+	}
+
+	// every step has dwelt
+	got.Status.StepStartTime = &metav1.Time{Time: time.Now().Add(-2 * time.Hour)}
+	if err := r.Client.Status().Update(ctx, got); err != nil {
+		t.Fatal(err)
+	}
+	got = reconcileAndGet(t)
+	if got.Status.CurrentStep != 2 || got.Status.CompletionTime == nil {
+		t.Fatalf("status = %+v, want completed", got.Status)
+	}
+	if !meta.IsStatusConditionTrue(got.Status.Conditions, timeleapv1alpha1.ConditionCompleted) {
+		t.Fatal("Completed condition is not true")
+	}
+	if err := r.Client.Get(ctx, key, &timeleapv1alpha1.TimeLeap{}); !apierrors.IsNotFound(err) {
+		t.Fatalf("got %v, want the TimeLeap deleted", err)
+	}
+
+	// a completed schedule stays completed
+	got = reconcileAndGet(t)
+	if got.Status.CurrentStep != 2 {
+		t.Fatalf("currentStep = %d, want the schedule to stay completed", got.Status.CurrentStep)
+	}
+	if err := r.Client.Get(ctx, key, &timeleapv1alpha1.TimeLeap{}); !apierrors.IsNotFound(err) {
+		t.Fatalf("got %v, want no TimeLeap after completion", err)
+	}
+}
+
+// defaultingClient is the client.Client which fills in the default TTL on creation, as the mutating webhook
+// does with DEFAULT_TTL.
+type defaultingClient struct {
+	client.Client
+	defaultTTL time.Duration
+}
+
+func (c *defaultingClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	if tl, ok := obj.(*timeleapv1alpha1.TimeLeap); ok {
+		tl.SetDefaultTTL(c.defaultTTL)
+	}
+
+	return c.Client.Create(ctx, obj, opts...)
+}
+
+func TestTimeLeapScheduleReconciler_DefaultTTL(t *testing.T) {
+	tls := &timeleapv1alpha1.TimeLeapSchedule{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:  "default",
+			Name:       "month-end",
+			UID:        "tls-uid",
+			Generation: 1,
+		},
+		Spec: timeleapv1alpha1.TimeLeapScheduleSpec{
+			Selector: metav1.LabelSelector{MatchLabels: map[string]string{"app": "sample"}},
+			Steps: []timeleapv1alpha1.ScheduleStep{
+				{Offset: "+30d", Dwell: metav1.Duration{Duration: 2 * time.Hour}},
+				{Offset: "+60d", Dwell: metav1.Duration{Duration: 2 * time.Hour}},
+			},
+		},
+	}
+	ctx := context.Background()
+	key := client.ObjectKey{Namespace: "default", Name: "month-end"}
+
+	// DEFAULT_TTL=1h, shorter than the schedule
+	r := newTestReconciler(t, nil, tls)
+	c := &defaultingClient{Client: r.Client, defaultTTL: time.Hour}
+	sr := &TimeLeapScheduleReconciler{Client: c, Log: log.NullLogger{}, Scheme: r.Scheme}
+	reconcileSchedule := func(t *testing.T) {
+		t.Helper()
+
+		if _, err := sr.Reconcile(ctx, reconcile.Request{NamespacedName: key}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	reconcileSchedule(t)
+	child := &timeleapv1alpha1.TimeLeap{}
+	if err := c.Get(ctx, key, child); err != nil {
+		t.Fatal(err)
+	}
+	if child.Spec.TTL != nil {
+		t.Fatalf("TTL = %v, want nil for the TimeLeap expired by the schedule", child.Spec.TTL)
+	}
+
+	// the child created with the default TTL before has expired
+	child.Spec.TTL = &metav1.Duration{Duration: time.Hour}
+	child.Status.Conditions = []metav1.Condition{{
+		Type:               timeleapv1alpha1.ConditionExpired,
+		Status:             metav1.ConditionTrue,
+		Reason:             timeleapv1alpha1.ReasonTTLExpired,
+		LastTransitionTime: metav1.Now(),
+	}}
+	if err := c.Update(ctx, child); err != nil {
+		t.Fatal(err)
+	}
+	reconcileSchedule(t)
+	if err := c.Get(ctx, key, &timeleapv1alpha1.TimeLeap{}); !apierrors.IsNotFound(err) {
+		t.Fatalf("got %v, want the expired TimeLeap deleted", err)
+	}
+
+	// and recreated without a TTL
+	reconcileSchedule(t)
+	child = &timeleapv1alpha1.TimeLeap{}
+	if err := c.Get(ctx, key, child); err != nil {
+		t.Fatal(err)
+	}
+	if child.Spec.TTL != nil || meta.IsStatusConditionTrue(child.Status.Conditions, timeleapv1alpha1.ConditionExpired) {
+		t.Fatalf("TimeLeap = %+v, want recreated without a TTL", child)
+	}
+	if diff := cmp.Diff(tls.Spec.StepSpec(0), child.Spec); diff != "" {
+		t.Fatalf("(-want +got):\n%s", diff)
+	}
+}
@@ -3,6 +3,7 @@ module github.com/zchee/kube-timeleap
 go 1.15
 
 require (
+	github.com/evanphx/json-patch v4.9.0+incompatible
 	github.com/go-logr/logr v0.2.1
 	github.com/google/go-cmp v0.5.2
 	github.com/kelseyhightower/envconfig v1.4.0
@@ -10,6 +11,7 @@ require (
 	github.com/onsi/gomega v1.10.2
 	go.uber.org/zap v1.15.0
 	golang.org/x/sys v0.0.0-20200930185726-fdedc70b468f
+	gomodules.xyz/jsonpatch/v2 v2.1.0
 	k8s.io/api v0.19.2
 	k8s.io/apimachinery v0.19.2
 	k8s.io/client-go v0.19.2
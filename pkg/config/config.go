@@ -6,8 +6,10 @@ package config
 import (
 	"errors"
 	"fmt"
+	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/kelseyhightower/envconfig"
 	"go.uber.org/zap/zapcore"
@@ -16,6 +18,19 @@ import (
 // env represents a environment variabels for kube-timeleap.
 type env struct {
 	Debug bool `envconfig:"DEBUG"`
+
+	// PodNamespace is the namespace the manager runs in, set through the downward API.
+	PodNamespace string `envconfig:"POD_NAMESPACE"`
+
+	// InjectionLabel is the namespace label which opts the namespace in to the pod injector.
+	InjectionLabel string `envconfig:"INJECTION_LABEL" default:"timeleap.x-k8s.io/injection"`
+
+	// ExcludedNamespaces is the namespaces the pod injector never acts on in addition to
+	// kube-system and PodNamespace.
+	ExcludedNamespaces []string `envconfig:"EXCLUDED_NAMESPACES"`
+
+	// DefaultTTL is the TTL of the TimeLeaps created without one. Zero disables the default.
+	DefaultTTL time.Duration `envconfig:"DEFAULT_TTL"`
 }
 
 // compile time check whether the env implements zapcore.ObjectMarshaler interface.
@@ -26,6 +41,18 @@ func (e env) MarshalLogObject(enc zapcore.ObjectEncoder) (_ error) {
 	// Debug
 	enc.AddBool("debug", e.Debug)
 
+	// PodNamespace
+	enc.AddString("podNamespace", e.PodNamespace)
+
+	// InjectionLabel
+	enc.AddString("injectionLabel", e.InjectionLabel)
+
+	// ExcludedNamespaces
+	enc.AddString("excludedNamespaces", strings.Join(e.ExcludedNamespaces, ","))
+
+	// DefaultTTL
+	enc.AddDuration("defaultTTL", e.DefaultTTL)
+
 	return
 }
 
@@ -79,3 +106,24 @@ func loadEnv() env {
 func IsDebug() bool {
 	return loadEnv().Debug
 }
+
+// PodNamespace returns the namespace the manager runs in.
+func PodNamespace() string {
+	return loadEnv().PodNamespace
+}
+
+// InjectionLabel returns the namespace label which opts the namespace in to the pod injector.
+func InjectionLabel() string {
+	return loadEnv().InjectionLabel
+}
+
+// ExcludedNamespaces returns the namespaces the pod injector never acts on, in addition to the
+// hard-excluded ones.
+func ExcludedNamespaces() []string {
+	return loadEnv().ExcludedNamespaces
+}
+
+// DefaultTTL returns the TTL of the TimeLeaps created without one, or zero if there is no default.
+func DefaultTTL() time.Duration {
+	return loadEnv().DefaultTTL
+}
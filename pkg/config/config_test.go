@@ -8,6 +8,7 @@ import (
 	"os"
 	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"go.uber.org/zap"
@@ -17,7 +18,11 @@ import (
 
 func Test_env_MarshalLogObject(t *testing.T) {
 	type fields struct {
-		Debug bool
+		Debug              bool
+		PodNamespace       string
+		InjectionLabel     string
+		ExcludedNamespaces []string
+		DefaultTTL         time.Duration
 	}
 	tests := []struct {
 		name   string
@@ -27,14 +32,18 @@ func Test_env_MarshalLogObject(t *testing.T) {
 		{
 			name:   "Omitempty",
 			fields: fields{},
-			want:   []byte(`{"Debug":false}`),
+			want:   []byte(`{"Debug":false,"PodNamespace":"","InjectionLabel":"","ExcludedNamespaces":null,"DefaultTTL":0}`),
 		},
 		{
 			name: "AllFields",
 			fields: fields{
-				Debug: true,
+				Debug:              true,
+				PodNamespace:       "kube-timeleap-system",
+				InjectionLabel:     "timeleap.x-k8s.io/injection",
+				ExcludedNamespaces: []string{"monitoring"},
+				DefaultTTL:         time.Hour,
 			},
-			want: []byte(`{"Debug":true}`),
+			want: []byte(`{"Debug":true,"PodNamespace":"kube-timeleap-system","InjectionLabel":"timeleap.x-k8s.io/injection","ExcludedNamespaces":["monitoring"],"DefaultTTL":3600000000000}`),
 		},
 	}
 	for _, tt := range tests {
@@ -46,7 +55,11 @@ func Test_env_MarshalLogObject(t *testing.T) {
 			logger := zap.New(core)
 
 			e := &env{
-				Debug: tt.fields.Debug,
+				Debug:              tt.fields.Debug,
+				PodNamespace:       tt.fields.PodNamespace,
+				InjectionLabel:     tt.fields.InjectionLabel,
+				ExcludedNamespaces: tt.fields.ExcludedNamespaces,
+				DefaultTTL:         tt.fields.DefaultTTL,
 			}
 			logger.Debug("Test_env_MarshalLogObject", zap.Object("env", e))
 
@@ -117,3 +130,83 @@ func TestIsDebug(t *testing.T) {
 		})
 	}
 }
+
+func TestInjectionPolicy(t *testing.T) {
+	tests := []struct {
+		name           string
+		keyValue       map[string]string
+		wantNamespace  string
+		wantLabel      string
+		wantExclusions []string
+	}{
+		{
+			name: "HaveEnv",
+			keyValue: map[string]string{
+				"POD_NAMESPACE":       "kube-timeleap-system",
+				"INJECTION_LABEL":     "example.com/timeleap",
+				"EXCLUDED_NAMESPACES": "monitoring,istio-system",
+			},
+			wantNamespace:  "kube-timeleap-system",
+			wantLabel:      "example.com/timeleap",
+			wantExclusions: []string{"monitoring", "istio-system"},
+		},
+		{
+			name:      "Empty",
+			keyValue:  map[string]string{},
+			wantLabel: "timeleap.x-k8s.io/injection",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cleanup := setEnvs(t, tt.keyValue)
+			defer func() {
+				cleanup()
+				envValue = atomic.Value{}
+			}()
+
+			if got := PodNamespace(); got != tt.wantNamespace {
+				t.Fatalf("PodNamespace() = %v, want %v", got, tt.wantNamespace)
+			}
+			if got := InjectionLabel(); got != tt.wantLabel {
+				t.Fatalf("InjectionLabel() = %v, want %v", got, tt.wantLabel)
+			}
+			if diff := cmp.Diff(tt.wantExclusions, ExcludedNamespaces()); diff != "" {
+				t.Fatalf("(-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestDefaultTTL(t *testing.T) {
+	tests := []struct {
+		name     string
+		keyValue map[string]string
+		want     time.Duration
+	}{
+		{
+			name: "HaveEnv",
+			keyValue: map[string]string{
+				"DEFAULT_TTL": "24h",
+			},
+			want: 24 * time.Hour,
+		},
+		{
+			name:     "Empty",
+			keyValue: map[string]string{},
+			want:     0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cleanup := setEnvs(t, tt.keyValue)
+			defer func() {
+				cleanup()
+				envValue = atomic.Value{}
+			}()
+
+			if got := DefaultTTL(); got != tt.want {
+				t.Fatalf("DefaultTTL() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
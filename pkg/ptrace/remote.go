@@ -0,0 +1,316 @@
+// Copyright 2020 The kube-timeleap Authors.
+// SPDX-License-Identifier: BSD-3-Clause
+
+// +build linux
+
+package ptrace
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// syscallInsn is the x86_64 syscall instruction.
+var syscallInsn = [initRegsRipAdjustment]byte{0x0f, 0x05}
+
+// NewThread returns the Thread of the stopped tracee tid in the thread group tgid.
+//
+// The registers of the tracee are kept as the initial registers, whose RIP is pointed at a syscall instruction
+// for RemoteSyscall: the one the tracee has just executed if it's stopped at a syscall, or else one in the
+// vDSO of the tracee.
+func NewThread(tgid, tid int32) (*Thread, error) {
+	t := &Thread{
+		tgid: tgid,
+		tid:  tid,
+	}
+	if err := t.GetRegs(&t.initRegs); err != nil {
+		return nil, fmt.Errorf("get registers of %d: %w", tid, err)
+	}
+
+	// RIP of a syscall-stop is past the syscall instruction
+	rip := uintptr(t.initRegs.Rip) - initRegsRipAdjustment
+	var insn [initRegsRipAdjustment]byte
+	if _, err := PeekText(int(tid), rip, insn[:]); err != nil || insn != syscallInsn {
+		if rip, err = findSyscallInsn(int(tid)); err != nil {
+			return nil, err
+		}
+	}
+	t.initRegs.Rip = uint64(rip)
+
+	return t, nil
+}
+
+// findSyscallInsn returns the address of a syscall instruction in the vDSO of the tracee tid, which is there
+// for the fallback of the vDSO functions.
+func findSyscallInsn(tid int) (uintptr, error) {
+	start, end, err := vdsoRange(tid)
+	if err != nil {
+		return 0, err
+	}
+
+	text := make([]byte, end-start)
+	if _, err := PeekText(tid, start, text); err != nil {
+		return 0, fmt.Errorf("read vDSO of %d: %w", tid, err)
+	}
+	i := bytes.Index(text, syscallInsn[:])
+	if i < 0 {
+		return 0, fmt.Errorf("no syscall instruction in vDSO of %d", tid)
+	}
+
+	return start + uintptr(i), nil
+}
+
+// errNoVDSO is the error of vdsoRange for the tracee without the vDSO.
+var errNoVDSO = errors.New("no vDSO mapped")
+
+// vdsoRange returns the address range of the vDSO mapped in the tracee tid.
+func vdsoRange(tid int) (start, end uintptr, err error) {
+	f, err := os.Open(fmt.Sprintf("/proc/%d/maps", tid))
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 6 || fields[5] != "[vdso]" {
+			continue
+		}
+		addrs := strings.SplitN(fields[0], "-", 2)
+		if len(addrs) != 2 {
+			break
+		}
+		s, err := strconv.ParseUint(addrs[0], 16, 64)
+		if err != nil {
+			return 0, 0, fmt.Errorf("parse vDSO range %q: %w", fields[0], err)
+		}
+		e, err := strconv.ParseUint(addrs[1], 16, 64)
+		if err != nil {
+			return 0, 0, fmt.Errorf("parse vDSO range %q: %w", fields[0], err)
+		}
+		return uintptr(s), uintptr(e), nil
+	}
+	if err := sc.Err(); err != nil {
+		return 0, 0, err
+	}
+
+	return 0, 0, fmt.Errorf("%w in %d", errNoVDSO, tid)
+}
+
+// RemoteSyscall executes the syscall nr with args in the tracee, and returns the result.
+//
+// The registers of the tracee are saved, RIP is pointed at the syscall instruction of the initial registers,
+// and the tracee is single-stepped over it. The registers are restored afterwards, so the tracee resumes as
+// if nothing happened. The signals arrived meanwhile are sent to the tracee again, while the event stops, e.g.
+// the group-stop, are not signals and are left behind.
+//
+// The tracee must be stopped outside a syscall or at the syscall-exit-stop, since the syscall in progress at
+// the syscall-entry-stop would be skipped. The syscall interrupted by the stop, e.g. by PTRACE_INTERRUPT, is
+// still restarted once the tracee resumes, since the single-step ends at the signal-delivery-stop of its
+// SIGTRAP, where the kernel restarts the syscall of the restored registers.
+func (t *Thread) RemoteSyscall(nr uintptr, args ...uintptr) (uintptr, error) {
+	if len(args) > 6 {
+		return 0, fmt.Errorf("too many syscall arguments: %d", len(args))
+	}
+
+	var saved unix.PtraceRegs
+	if err := t.GetRegs(&saved); err != nil {
+		return 0, fmt.Errorf("get registers: %w", err)
+	}
+
+	regs := saved
+	regs.Rip = t.initRegs.Rip
+	regs.Rax = uint64(nr)
+	// not a syscall in progress, so the kernel never restarts it
+	regs.Orig_rax = ^uint64(0)
+	argRegs := []*uint64{&regs.Rdi, &regs.Rsi, &regs.Rdx, &regs.R10, &regs.R8, &regs.R9}
+	for i, arg := range args {
+		*argRegs[i] = uint64(arg)
+	}
+	if err := t.SetRegs(&regs); err != nil {
+		return 0, fmt.Errorf("set registers: %w", err)
+	}
+
+	var pending []unix.Signal
+	for stepped := false; !stepped; {
+		if err := SingleStep(int(t.tid)); err != nil {
+			return 0, fmt.Errorf("single-step: %w", err)
+		}
+		status, err := t.waitStopped()
+		if err != nil {
+			return 0, err
+		}
+
+		sig := status.StopSignal()
+		switch {
+		case event(status) != 0:
+			// the event stop such as the group-stop, which is not a signal to deliver
+		case sig != unix.SIGTRAP:
+			// the signal-delivery-stop before the syscall instruction is executed
+			pending = append(pending, sig)
+		default:
+			if stepped, err = t.singleStepped(); err != nil {
+				return 0, err
+			}
+			if !stepped {
+				pending = append(pending, sig)
+			}
+		}
+	}
+
+	if err := t.GetRegs(&regs); err != nil {
+		return 0, fmt.Errorf("get registers: %w", err)
+	}
+	if err := t.SetRegs(&saved); err != nil {
+		return 0, fmt.Errorf("restore registers: %w", err)
+	}
+	for _, sig := range pending {
+		if err := unix.Tgkill(int(t.tgid), int(t.tid), sig); err != nil {
+			return 0, fmt.Errorf("send %v again: %w", sig, err)
+		}
+	}
+
+	ret := regs.Rax
+	if errno := -int64(ret); errno > 0 && errno < 4096 {
+		return 0, unix.Errno(errno)
+	}
+
+	return uintptr(ret), nil
+}
+
+// singleStepped reports whether the SIGTRAP the tracee is stopped by is the trap of the single-step, rather
+// than a SIGTRAP sent to it, by the si_code of the signal.
+func (t *Thread) singleStepped() (bool, error) {
+	info, err := GetSiginfo(int(t.tid))
+	if err != nil {
+		return false, fmt.Errorf("get siginfo of %d: %w", t.tid, err)
+	}
+
+	// the single-step over the syscall instruction is reported by the syscall exit as a breakpoint on x86
+	return info.Code == TRAP_TRACE || info.Code == TRAP_BRKPT, nil
+}
+
+// waitStopped waits for the tracee to stop, and returns the wait status of the stop.
+//
+// Unlike Wait, the tracee which exits or is killed meanwhile is reported as an error instead of a panic, since
+// it's the traced application, which can exit at any time, rather than a stub of ours.
+func (t *Thread) waitStopped() (unix.WaitStatus, error) {
+	for {
+		var status unix.WaitStatus
+		_, err := unix.Wait4(int(t.tid), &status, unix.WALL, nil)
+		switch {
+		case errors.Is(err, unix.EINTR):
+			continue
+		case err != nil:
+			return 0, fmt.Errorf("wait %d: %w", t.tid, err)
+		}
+
+		switch {
+		case status.Exited():
+			return 0, fmt.Errorf("%d exited with status %d", t.tid, status.ExitStatus())
+		case status.Signaled():
+			return 0, fmt.Errorf("%d killed by signal %d", t.tid, status.Signal())
+		case !status.Stopped() || status.StopSignal() == 0:
+			continue
+		case event(status) == unix.PTRACE_EVENT_EXIT:
+			return 0, fmt.Errorf("%d is exiting", t.tid)
+		}
+
+		return status, nil
+	}
+}
+
+// RemoteMmap maps length bytes of the anonymous memory with prot and flags in the tracee, and returns the
+// address of the mapping. addr is the hint of the address, or 0 to let the kernel choose.
+func (t *Thread) RemoteMmap(addr, length uintptr, prot, flags int) (uintptr, error) {
+	fd := -1
+	mapped, err := t.RemoteSyscall(unix.SYS_MMAP, addr, length, uintptr(prot), uintptr(flags|unix.MAP_ANONYMOUS), uintptr(fd), 0)
+	if err != nil {
+		return 0, fmt.Errorf("mmap in %d: %w", t.tid, err)
+	}
+
+	return mapped, nil
+}
+
+// RemoteMunmap unmaps length bytes at addr in the tracee.
+func (t *Thread) RemoteMunmap(addr, length uintptr) error {
+	if _, err := t.RemoteSyscall(unix.SYS_MUNMAP, addr, length); err != nil {
+		return fmt.Errorf("munmap in %d: %w", t.tid, err)
+	}
+
+	return nil
+}
+
+// RemoteMprotect changes the protection of length bytes at addr in the tracee to prot.
+func (t *Thread) RemoteMprotect(addr, length uintptr, prot int) error {
+	if _, err := t.RemoteSyscall(unix.SYS_MPROTECT, addr, length, uintptr(prot)); err != nil {
+		return fmt.Errorf("mprotect in %d: %w", t.tid, err)
+	}
+
+	return nil
+}
+
+// WriteMemory copies data to addr in the tracee.
+//
+// It writes by process_vm_writev(2) in one go, and falls back to PTRACE_POKEDATA for the rest which it fails
+// to write, e.g. to the memory without PROT_WRITE, which only ptrace can write to.
+func (t *Thread) WriteMemory(addr uintptr, data []byte) error {
+	if len(data) == 0 {
+		return nil
+	}
+
+	n, err := ProcessVMWritev(int(t.tid), &addr, data)
+	if err == nil && n == len(data) {
+		return nil
+	}
+	if _, err := PokeData(int(t.tid), addr+uintptr(n), data[n:]); err != nil {
+		return fmt.Errorf("write %d bytes to %#x in %d: %w", len(data)-n, addr+uintptr(n), t.tid, err)
+	}
+
+	return nil
+}
+
+// InjectCode copies code to a new mapping in the tracee, and returns the address of the mapping.
+//
+// The mapping is writable while the code is written, and then made readable and executable. The caller owns
+// the mapping, and releases it by RemoteMunmap with the length of code rounded up to the page size.
+func (t *Thread) InjectCode(code []byte) (uintptr, error) {
+	length := pageRoundUp(uintptr(len(code)))
+	addr, err := t.RemoteMmap(0, length, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_PRIVATE)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := t.WriteMemory(addr, code); err != nil {
+		return 0, t.unmapOnError(addr, length, err)
+	}
+	if err := t.RemoteMprotect(addr, length, unix.PROT_READ|unix.PROT_EXEC); err != nil {
+		return 0, t.unmapOnError(addr, length, err)
+	}
+
+	return addr, nil
+}
+
+// unmapOnError unmaps length bytes at addr in the tracee after the failure err, and returns err. The failure
+// to unmap is reported along with err, since the mapping is then left behind in the tracee.
+func (t *Thread) unmapOnError(addr, length uintptr, err error) error {
+	if uerr := t.RemoteMunmap(addr, length); uerr != nil {
+		return fmt.Errorf("%w, and left %d bytes mapped at %#x: %v", err, length, addr, uerr)
+	}
+
+	return err
+}
+
+// pageRoundUp rounds n up to the page size.
+func pageRoundUp(n uintptr) uintptr {
+	pageSize := uintptr(os.Getpagesize())
+	return (n + pageSize - 1) &^ (pageSize - 1)
+}
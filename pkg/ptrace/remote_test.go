@@ -0,0 +1,502 @@
+// Copyright 2020 The kube-timeleap Authors.
+// SPDX-License-Identifier: BSD-3-Clause
+
+// +build linux
+
+package ptrace
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/sys/unix"
+)
+
+// startThread starts TestHelperProcess as for startTracee, and returns the Thread of it and its pid. The tracee
+// is killed at the end of the test.
+func startThread(t *testing.T) (*Thread, int) {
+	t.Helper()
+
+	pid, r := startTracee(t)
+	t.Cleanup(func() {
+		unix.Kill(pid, unix.SIGKILL)
+		var status unix.WaitStatus
+		unix.Wait4(pid, &status, unix.WALL, nil)
+		r.Close()
+	})
+
+	thread, err := NewThread(int32(pid), int32(pid))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return thread, pid
+}
+
+func TestThread_RemoteSyscall(t *testing.T) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	thread, pid := startThread(t)
+
+	var before unix.PtraceRegs
+	if err := thread.GetRegs(&before); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		nr      uintptr
+		args    []uintptr
+		want    uintptr
+		wantErr error
+	}{
+		{
+			name: "getpid",
+			nr:   unix.SYS_GETPID,
+			want: uintptr(pid),
+		},
+		{
+			name: "getppid",
+			nr:   unix.SYS_GETPPID,
+			want: uintptr(os.Getpid()),
+		},
+		{
+			name:    "close",
+			nr:      unix.SYS_CLOSE,
+			args:    []uintptr{^uintptr(0)},
+			wantErr: unix.EBADF,
+		},
+		{
+			name:    "TooManyArgs",
+			nr:      unix.SYS_GETPID,
+			args:    make([]uintptr, 7),
+			wantErr: errors.New("too many syscall arguments: 7"),
+		},
+	}
+	// every ptrace request must be issued from this thread, so the cases are not run as subtests
+	for _, tt := range tests {
+		got, err := thread.RemoteSyscall(tt.nr, tt.args...)
+		if tt.wantErr != nil {
+			if err == nil || err.Error() != tt.wantErr.Error() {
+				t.Fatalf("%s: err = %v, want %v", tt.name, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got != tt.want {
+			t.Fatalf("%s: got %d, want %d", tt.name, got, tt.want)
+		}
+	}
+
+	var after unix.PtraceRegs
+	if err := thread.GetRegs(&after); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(before, after); diff != "" {
+		t.Fatalf("registers are not restored: (-want +got):\n%s", diff)
+	}
+}
+
+func TestThread_RemoteSyscallDying(t *testing.T) {
+	tests := []struct {
+		name    string
+		nr      uintptr
+		args    func(pid int) []uintptr
+		wantErr string
+	}{
+		{
+			name:    "Exit",
+			nr:      unix.SYS_EXIT_GROUP,
+			args:    func(int) []uintptr { return []uintptr{3} },
+			wantErr: "exited with status 3",
+		},
+		{
+			name:    "Killed",
+			nr:      unix.SYS_KILL,
+			args:    func(pid int) []uintptr { return []uintptr{uintptr(pid), uintptr(unix.SIGKILL)} },
+			wantErr: "killed by signal 9",
+		},
+	}
+	// every ptrace request must be issued from this thread, so the cases are not run as subtests
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	for _, tt := range tests {
+		thread, pid := startThread(t)
+
+		_, err := thread.RemoteSyscall(tt.nr, tt.args(pid)...)
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Fatalf("%s: err = %v, want to contain %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+// startBlocked starts TestHelperProcess as for TestTracer_Attach, and returns it and its stdin once it's
+// ready. The process exits without reading the time once it reads a byte, and is killed at the end of the test.
+func startBlocked(t *testing.T) (*exec.Cmd, io.WriteCloser) {
+	t.Helper()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command(os.Args[0], "-test.run=TestHelperProcess")
+	cmd.Env = append(os.Environ(), "GO_WANT_HELPER_PROCESS=1", "GO_HELPER_TREE=1", "GO_HELPER_LOOP=0")
+	cmd.Stdout = w
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		r.Close()
+		w.Close()
+		t.Skipf("unable to start the process: %v", err)
+	}
+	w.Close()
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+		r.Close()
+	})
+
+	if line, err := bufio.NewReader(r).ReadString('\n'); err != nil || line != "ready\n" {
+		t.Fatalf("got %q, %v, want ready", line, err)
+	}
+
+	return cmd, stdin
+}
+
+// seizeBlocked starts TestHelperProcess by startBlocked, seizes the thread of it blocked in read(2) of stdin,
+// and returns the Thread of it stopped by PTRACE_INTERRUPT along with the process and its stdin.
+func seizeBlocked(t *testing.T) (*Thread, *exec.Cmd, io.WriteCloser) {
+	t.Helper()
+
+	cmd, stdin := startBlocked(t)
+	pid := cmd.Process.Pid
+	tid := 0
+	for deadline := time.Now().Add(10 * time.Second); tid == 0; time.Sleep(time.Millisecond) {
+		tids, err := threadIDs(pid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, id := range tids {
+			// the syscall number and the arguments, i.e. read(0, ...)
+			if sc, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/task/%d/syscall", pid, id)); err == nil && strings.HasPrefix(string(sc), "0 0x0 ") {
+				tid = id
+			}
+		}
+		if tid == 0 && time.Now().After(deadline) {
+			t.Fatal("no thread is blocked in read(2)")
+		}
+	}
+
+	if err := Seize(tid, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := Interrupt(tid); err != nil {
+		t.Fatal(err)
+	}
+	thread := &Thread{tgid: int32(pid), tid: int32(tid)}
+	status, err := thread.waitStopped()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event(status) != unix.PTRACE_EVENT_STOP {
+		t.Fatalf("status = %#x, want PTRACE_EVENT_STOP", status)
+	}
+	if thread, err = NewThread(int32(pid), int32(tid)); err != nil {
+		t.Fatal(err)
+	}
+
+	return thread, cmd, stdin
+}
+
+// pendingSignals returns the set of the signals pending for the thread tid, by SigPnd of its status.
+func pendingSignals(t *testing.T, tid int) uint64 {
+	t.Helper()
+
+	status, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/status", tid))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range strings.Split(string(status), "\n") {
+		if v := strings.TrimPrefix(line, "SigPnd:"); v != line {
+			set, err := strconv.ParseUint(strings.TrimSpace(v), 16, 64)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return set
+		}
+	}
+	t.Fatalf("no SigPnd in the status of %d", tid)
+
+	return 0
+}
+
+func TestThread_RemoteSyscallSignals(t *testing.T) {
+	t.Run("SIGTRAP", func(t *testing.T) {
+		runtime.LockOSThread()
+		defer runtime.UnlockOSThread()
+
+		thread, pid := startThread(t)
+
+		// a SIGTRAP sent to the tracee is not the trap of the single-step
+		if err := unix.Tgkill(pid, pid, unix.SIGTRAP); err != nil {
+			t.Fatal(err)
+		}
+		got, err := thread.RemoteSyscall(unix.SYS_GETPID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != uintptr(pid) {
+			t.Fatalf("got %d, want %d", got, pid)
+		}
+		if pendingSignals(t, pid)&(1<<(unix.SIGTRAP-1)) == 0 {
+			t.Fatal("SIGTRAP is not sent again")
+		}
+	})
+
+	t.Run("GroupStop", func(t *testing.T) {
+		runtime.LockOSThread()
+		defer runtime.UnlockOSThread()
+
+		thread, cmd, _ := seizeBlocked(t)
+		pid, tid := cmd.Process.Pid, int(thread.tid)
+
+		// the other threads stop, and leave the group-stop to the seized one
+		if err := unix.Kill(pid, unix.SIGSTOP); err != nil {
+			t.Fatal(err)
+		}
+		for deadline := time.Now().Add(10 * time.Second); !othersStopped(t, pid, tid); time.Sleep(time.Millisecond) {
+			if time.Now().After(deadline) {
+				t.Fatal("the other threads are not stopped")
+			}
+		}
+
+		if _, err := thread.RemoteSyscall(unix.SYS_GETPID); err != nil {
+			t.Fatal(err)
+		}
+		if pendingSignals(t, tid)&(1<<(unix.SIGSTOP-1)) != 0 {
+			t.Fatal("the group-stop is sent again as SIGSTOP")
+		}
+	})
+}
+
+// othersStopped reports whether every thread of the process pid but tid is stopped.
+func othersStopped(t *testing.T, pid, tid int) bool {
+	t.Helper()
+
+	tids, err := threadIDs(pid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range tids {
+		if id == tid {
+			continue
+		}
+		stat, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/task/%d/stat", pid, id))
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the state follows the parenthesized command name
+		if fields := strings.Fields(string(stat[bytes.LastIndexByte(stat, ')')+1:])); len(fields) == 0 || fields[0] != "T" {
+			return false
+		}
+	}
+
+	return true
+}
+
+func TestThread_RemoteSyscallRestart(t *testing.T) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	thread, cmd, stdin := seizeBlocked(t)
+
+	// the read(2) interrupted by PTRACE_INTERRUPT
+	if _, err := thread.RemoteSyscall(unix.SYS_GETPID); err != nil {
+		t.Fatal(err)
+	}
+	if err := Detach(int(thread.tid), 0); err != nil {
+		t.Fatal(err)
+	}
+
+	// the restarted read(2) returns the byte, instead of failing with ERESTARTSYS
+	if _, err := stdin.Write([]byte{'\n'}); err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Wait(); err != nil {
+		t.Fatalf("process exited with %v", err)
+	}
+}
+
+// runCode runs the code at addr in the tracee until it hits int3, and returns the registers at that point. The
+// registers of the tracee are restored afterwards.
+func runCode(t *testing.T, thread *Thread, addr uintptr) unix.PtraceRegs {
+	t.Helper()
+
+	var saved unix.PtraceRegs
+	if err := thread.GetRegs(&saved); err != nil {
+		t.Fatal(err)
+	}
+	regs := saved
+	regs.Rip = uint64(addr)
+	regs.Orig_rax = ^uint64(0)
+	if err := thread.SetRegs(&regs); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Cont(int(thread.tid), 0); err != nil {
+		t.Fatal(err)
+	}
+	status, err := thread.waitStopped()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sig := status.StopSignal(); sig != unix.SIGTRAP {
+		t.Fatalf("stopped by %v, want SIGTRAP", sig)
+	}
+	if err := thread.GetRegs(&regs); err != nil {
+		t.Fatal(err)
+	}
+	if err := thread.SetRegs(&saved); err != nil {
+		t.Fatal(err)
+	}
+
+	return regs
+}
+
+func TestThread_InjectCode(t *testing.T) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	thread, pid := startThread(t)
+
+	tests := []struct {
+		name string
+		code []byte
+		want uint64
+	}{
+		{
+			name: "Return",
+			code: []byte{
+				0x48, 0xc7, 0xc0, 0x2a, 0x00, 0x00, 0x00, // mov rax, 42
+				0xcc, // int3
+			},
+			want: 42,
+		},
+		{
+			name: "Syscall",
+			code: []byte{
+				0xb8, unix.SYS_GETPID, 0x00, 0x00, 0x00, // mov eax, SYS_GETPID
+				0x0f, 0x05, // syscall
+				0xcc, // int3
+			},
+			want: uint64(pid),
+		},
+	}
+	// every ptrace request must be issued from this thread, so the cases are not run as subtests
+	for _, tt := range tests {
+		addr, err := thread.InjectCode(tt.code)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+
+		regs := runCode(t, thread, addr)
+		if regs.Rax != tt.want {
+			t.Fatalf("%s: rax = %d, want %d", tt.name, regs.Rax, tt.want)
+		}
+		if want := uint64(addr) + uint64(len(tt.code)); regs.Rip != want {
+			t.Fatalf("%s: rip = %#x, want %#x past int3", tt.name, regs.Rip, want)
+		}
+
+		if err := thread.RemoteMunmap(addr, pageRoundUp(uintptr(len(tt.code)))); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+	}
+}
+
+func TestThread_unmapOnError(t *testing.T) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	thread, _ := startThread(t)
+	failure := errors.New("write failed")
+	length := pageRoundUp(1)
+
+	addr, err := thread.RemoteMmap(0, length, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_PRIVATE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := thread.unmapOnError(addr, length, failure); err != failure {
+		t.Fatalf("unmapped: got %v, want %v as is", err, failure)
+	}
+
+	// munmap(2) takes only a page aligned address
+	err = thread.unmapOnError(addr+1, length, failure)
+	if !errors.Is(err, failure) || err.Error() == failure.Error() {
+		t.Fatalf("failed to unmap: got %v, want %v along with the munmap error", err, failure)
+	}
+}
+
+func TestThread_WriteMemory(t *testing.T) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	thread, pid := startThread(t)
+
+	tests := []struct {
+		name string
+		prot int
+	}{
+		{
+			name: "Writable",
+			prot: unix.PROT_READ | unix.PROT_WRITE,
+		},
+		{
+			// process_vm_writev(2) fails, and PTRACE_POKEDATA writes
+			name: "ReadOnly",
+			prot: unix.PROT_READ,
+		},
+	}
+	for _, tt := range tests {
+		length := pageRoundUp(1)
+		addr, err := thread.RemoteMmap(0, length, tt.prot, unix.MAP_PRIVATE)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+
+		// unaligned, to write the partial words at the both edges
+		want := []byte("kube-timeleap")
+		if err := thread.WriteMemory(addr+3, want); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		got := make([]byte, len(want))
+		if _, err := PeekData(pid, addr+3, got); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Fatalf("%s: (-want +got):\n%s", tt.name, diff)
+		}
+
+		if err := thread.RemoteMunmap(addr, length); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+// Copyright 2020 The kube-timeleap Authors.
+// SPDX-License-Identifier: BSD-3-Clause
+
+// +build linux
+
+package ptrace
+
+import (
+	"fmt"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// seccomp constants in linux/seccomp.h and linux/audit.h.
+const (
+	SECCOMP_SET_MODE_FILTER   = 1
+	SECCOMP_FILTER_FLAG_TSYNC = 1
+
+	SECCOMP_RET_ALLOW = 0x7fff0000
+	SECCOMP_RET_TRACE = 0x7ff00000
+
+	AUDIT_ARCH_X86_64 = 0xc000003e
+
+	// offsets of the fields in struct seccomp_data.
+	seccompDataNr   = 0
+	seccompDataArch = 4
+)
+
+// TimeSyscalls is the syscalls the Tracer rewrites.
+var TimeSyscalls = []uint32{
+	unix.SYS_CLOCK_GETTIME,
+	unix.SYS_GETTIMEOFDAY,
+	unix.SYS_TIME,
+	unix.SYS_CLOCK_NANOSLEEP,
+}
+
+// timeFilter returns the seccomp filter which stops the tracee at TimeSyscalls and allows the others.
+func timeFilter() []unix.SockFilter {
+	n := len(TimeSyscalls)
+	prog := []unix.SockFilter{
+		{Code: unix.BPF_LD | unix.BPF_W | unix.BPF_ABS, K: seccompDataArch},
+		// the syscall numbers below are of x86_64 only
+		{Code: unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K, K: AUDIT_ARCH_X86_64, Jf: uint8(n + 1)},
+		{Code: unix.BPF_LD | unix.BPF_W | unix.BPF_ABS, K: seccompDataNr},
+	}
+	for i, nr := range TimeSyscalls {
+		prog = append(prog, unix.SockFilter{Code: unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K, K: nr, Jt: uint8(n - i)})
+	}
+
+	return append(prog,
+		unix.SockFilter{Code: unix.BPF_RET | unix.BPF_K, K: SECCOMP_RET_ALLOW},
+		unix.SockFilter{Code: unix.BPF_RET | unix.BPF_K, K: SECCOMP_RET_TRACE},
+	)
+}
+
+// sockFprog is struct sock_fprog, whose filter is at an address in the tracee.
+type sockFprog struct {
+	Len    uint16
+	_      [6]byte
+	Filter uint64
+}
+
+// InstallSeccompFilter installs on every thread of the tracee the seccomp filter which stops the tracee at
+// TimeSyscalls for the Tracer in the Seccomp mode, and lets the other syscalls run at native speed.
+//
+// The filter is written to a temporary mapping in the tracee, and installed by prctl(2) and seccomp(2)
+// executed in the tracee by RemoteSyscall. It sets no_new_privs of the tracee, which seccomp(2) requires
+// without CAP_SYS_ADMIN, so the set-user-ID programs the tracee executes afterwards gain no privileges.
+//
+// The filter is inherited by the children and kept across execve(2). The tracee must be traced with
+// PTRACE_O_TRACESECCOMP, since TimeSyscalls fail with ENOSYS while no tracer is attached.
+func (t *Thread) InstallSeccompFilter() error {
+	filter := timeFilter()
+	filterSize := len(filter) * int(unsafe.Sizeof(filter[0]))
+	progSize := int(unsafe.Sizeof(sockFprog{}))
+	length := pageRoundUp(uintptr(progSize + filterSize))
+	addr, err := t.RemoteMmap(0, length, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_PRIVATE)
+	if err != nil {
+		return err
+	}
+
+	// the filter follows the sock_fprog pointing at it
+	prog := sockFprog{
+		Len:    uint16(len(filter)),
+		Filter: uint64(addr) + uint64(progSize),
+	}
+	data := make([]byte, 0, progSize+filterSize)
+	data = append(data, (*[unsafe.Sizeof(prog)]byte)(unsafe.Pointer(&prog))[:]...)
+	data = append(data, (*[1 << 16]byte)(unsafe.Pointer(&filter[0]))[:filterSize]...)
+	if err := t.WriteMemory(addr, data); err != nil {
+		return t.unmapOnError(addr, length, err)
+	}
+
+	// no_new_privs is per thread, and propagated to the other threads by SECCOMP_FILTER_FLAG_TSYNC
+	if _, err := t.RemoteSyscall(unix.SYS_PRCTL, unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+		return t.unmapOnError(addr, length, fmt.Errorf("set no_new_privs of %d: %w", t.tid, err))
+	}
+	r, err := t.RemoteSyscall(unix.SYS_SECCOMP, SECCOMP_SET_MODE_FILTER, SECCOMP_FILTER_FLAG_TSYNC, addr)
+	switch {
+	case err != nil:
+		return t.unmapOnError(addr, length, fmt.Errorf("install seccomp filter in %d: %w", t.tid, err))
+	case r != 0:
+		// TSYNC returns the tid of the thread which failed to synchronize
+		return t.unmapOnError(addr, length, fmt.Errorf("install seccomp filter in %d: unable to synchronize thread %d", t.tid, r))
+	}
+
+	return t.RemoteMunmap(addr, length)
+}
@@ -19,7 +19,11 @@ func ptrace(request, pid int, addr, data uintptr) error {
 		addr,
 		data,
 		0, 0)
-	return unix.Errno(errno)
+	if errno != 0 {
+		return errno
+	}
+
+	return nil
 }
 
 // peek requests are machine-size oriented, so we wrap it to retrieve arbitrary-length data.
@@ -174,6 +178,29 @@ func GetEventMsg(pid int) (msg uintptr, err error) {
 	return
 }
 
+// Siginfo is the head of siginfo_t, which tells the signal and where it comes from.
+type Siginfo struct {
+	Signo int32
+	Errno int32
+	Code  int32
+	_     [128 - 12]byte
+}
+
+// List of si_code of SIGTRAP, see <asm-generic/siginfo.h>.
+const (
+	// TRAP_BRKPT is the breakpoint trap, also reported on x86 for the single-step over a syscall instruction.
+	TRAP_BRKPT = 1
+
+	// TRAP_TRACE is the trap of the single-step.
+	TRAP_TRACE = 2
+)
+
+// GetSiginfo retrieves the information about the signal that caused the stop.
+func GetSiginfo(pid int) (info Siginfo, err error) {
+	err = ptrace(unix.PTRACE_GETSIGINFO, pid, 0, uintptr(unsafe.Pointer(&info)))
+	return
+}
+
 // Cont restarts the stopped tracee process.
 func Cont(pid, signal int) (err error) {
 	return ptrace(unix.PTRACE_CONT, pid, 0, uintptr(signal))
@@ -201,9 +228,18 @@ func Attach(pid int) (err error) {
 	return ptrace(unix.PTRACE_ATTACH, pid, 0, 0)
 }
 
-// Seize attachs to the process specified in pid, making it a tracee of the calling process.
-func Seize(pid int) (err error) {
-	return ptrace(unix.PTRACE_SEIZE, pid, 0, 0)
+// Seize attachs to the process specified in pid, making it a tracee of the calling process with the ptrace options.
+//
+// Unlike Attach, Seize does not stop the process.
+func Seize(pid, options int) (err error) {
+	return ptrace(unix.PTRACE_SEIZE, pid, 0, uintptr(options))
+}
+
+// Listen restarts the stopped tracee, but prevents it from executing until it's resumed by SIGCONT.
+//
+// Listen works only on the tracee attached by Seize and stopped by the group-stop.
+func Listen(pid int) (err error) {
+	return ptrace(unix.PTRACE_LISTEN, pid, 0, 0)
 }
 
 // Detach restarts the stopped tracee as for PTRACE_CONT, but first detach from it.
@@ -262,14 +298,14 @@ func ProcessVMReadv(pid int, addr *uintptr, data []byte) (int, error) {
 		{Base: &data[0], Len: uint64(sz)},
 	}
 	remoteIov := []unix.RemoteIovec{
-		{Base: uintptr(unsafe.Pointer(addr)), Len: sz},
+		{Base: *addr, Len: sz},
 	}
 
 	// The flags argument is currently unused and must be set to 0.
 	// See also: https://man7.org/linux/man-pages/man2/process_vm_readv.2.html
 	flags := uint(0)
 	n, err := unix.ProcessVMReadv(pid, localIov, remoteIov, flags)
-	if err != unix.Errno(0) {
+	if err != nil {
 		return 0, err
 	}
 
@@ -284,14 +320,14 @@ func ProcessVMWritev(pid int, addr *uintptr, data []byte) (int, error) {
 		{Base: &data[0], Len: uint64(sz)},
 	}
 	remoteIov := []unix.RemoteIovec{
-		{Base: uintptr(unsafe.Pointer(addr)), Len: sz},
+		{Base: *addr, Len: sz},
 	}
 
 	// The flags argument is currently unused and must be set to 0.
 	// See also: https://man7.org/linux/man-pages/man2/process_vm_writev.2.html
 	flags := uint(0)
 	n, err := unix.ProcessVMWritev(pid, localIov, remoteIov, flags)
-	if err != unix.Errno(0) {
+	if err != nil {
 		return 0, err
 	}
 
@@ -51,6 +51,27 @@ func (t *Thread) GetRegs(regs *unix.PtraceRegs) error {
 	return nil
 }
 
+// SetRegs sets the general purpose register set.
+func (t *Thread) SetRegs(regs *unix.PtraceRegs) error {
+	iovec := unix.Iovec{
+		Base: (*byte)(unsafe.Pointer(regs)),
+		Len:  uint64(unsafe.Sizeof(*regs)),
+	}
+
+	_, _, errno := unix.RawSyscall6(
+		unix.SYS_PTRACE,
+		unix.PTRACE_SETREGSET,
+		uintptr(t.tid),
+		uintptr(elf.NT_PRSTATUS),
+		uintptr(unsafe.Pointer(&iovec)),
+		0, 0)
+	if errno != unix.Errno(0) {
+		return unix.Errno(errno)
+	}
+
+	return nil
+}
+
 // DumpRegs dumps regs.
 func DumpRegs(regs *unix.PtraceRegs) string {
 	var m strings.Builder
@@ -0,0 +1,209 @@
+// Copyright 2020 The kube-timeleap Authors.
+// SPDX-License-Identifier: BSD-3-Clause
+
+// +build linux
+
+package ptrace
+
+import (
+	"fmt"
+	"math"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/zchee/kube-timeleap/pkg/vclock"
+)
+
+// ReadTimespec reads the struct timespec at addr in the tracee's memory.
+func ReadTimespec(pid int, addr uintptr) (ts unix.Timespec, err error) {
+	buf := (*[unsafe.Sizeof(ts)]byte)(unsafe.Pointer(&ts))
+	if _, err := PeekData(pid, addr, buf[:]); err != nil {
+		return ts, fmt.Errorf("read timespec at %#x: %w", addr, err)
+	}
+
+	return ts, nil
+}
+
+// WriteTimespec writes ts to the struct timespec at addr in the tracee's memory.
+func WriteTimespec(pid int, addr uintptr, ts unix.Timespec) error {
+	buf := (*[unsafe.Sizeof(ts)]byte)(unsafe.Pointer(&ts))
+	if _, err := PokeData(pid, addr, buf[:]); err != nil {
+		return fmt.Errorf("write timespec at %#x: %w", addr, err)
+	}
+
+	return nil
+}
+
+// ReadTimeval reads the struct timeval at addr in the tracee's memory.
+func ReadTimeval(pid int, addr uintptr) (tv unix.Timeval, err error) {
+	buf := (*[unsafe.Sizeof(tv)]byte)(unsafe.Pointer(&tv))
+	if _, err := PeekData(pid, addr, buf[:]); err != nil {
+		return tv, fmt.Errorf("read timeval at %#x: %w", addr, err)
+	}
+
+	return tv, nil
+}
+
+// WriteTimeval writes tv to the struct timeval at addr in the tracee's memory.
+func WriteTimeval(pid int, addr uintptr, tv unix.Timeval) error {
+	buf := (*[unsafe.Sizeof(tv)]byte)(unsafe.Pointer(&tv))
+	if _, err := PokeData(pid, addr, buf[:]); err != nil {
+		return fmt.Errorf("write timeval at %#x: %w", addr, err)
+	}
+
+	return nil
+}
+
+// Clocks translates the kernel clock readings of tracees to the virtual ones.
+//
+// Tracees share the kernel clocks of the tracer, so the readings of the tracer anchor every
+// virtual clock to the kernel clock it replaces.
+type Clocks struct {
+	set vclock.Set
+
+	// epochReadings is the reading of each kernel clock at the Epoch of its virtual clock.
+	epochReadings map[vclock.ID]int64
+}
+
+// NewClocks returns the Clocks which replaces the kernel clocks in set.
+func NewClocks(set vclock.Set) (*Clocks, error) {
+	c := &Clocks{
+		set:           set,
+		epochReadings: make(map[vclock.ID]int64, len(set)),
+	}
+
+	for id, vc := range set {
+		if id == vclock.Realtime {
+			c.epochReadings[id] = vc.Epoch.UnixNano()
+		} else {
+			reading, err := epochReading(id, vc.Epoch)
+			if err != nil {
+				return nil, err
+			}
+			c.epochReadings[id] = reading
+		}
+
+		// The derived clocks read apart from their base clock, e.g. CLOCK_TAI by the TAI offset, so each of
+		// them is anchored by its own reading. The alarm clocks are unreadable without an RTC, which leaves
+		// them anchored by the base clock.
+		for _, did := range id.Derived() {
+			if reading, err := epochReading(did, vc.Epoch); err == nil {
+				c.epochReadings[did] = reading
+			}
+		}
+	}
+
+	return c, nil
+}
+
+// Translate translates the reading of the kernel clock id, in nanoseconds, to the virtual one.
+//
+// Translate reports false if the kernel clock is not replaced, in which case the reading must be left as is.
+func (c *Clocks) Translate(id vclock.ID, reading int64) (int64, bool) {
+	vc, ok := c.set.Lookup(id)
+	if !ok {
+		return reading, false
+	}
+
+	epochReading, ok := c.epochReadings[id]
+	if !ok {
+		epochReading = c.epochReadings[id.Base()]
+	}
+
+	return vc.Translate(reading, epochReading), true
+}
+
+// epochReading returns the reading of the kernel clock id, in nanoseconds, at the real time epoch.
+func epochReading(id vclock.ID, epoch time.Time) (int64, error) {
+	var ts, rt unix.Timespec
+	if err := unix.ClockGettime(int32(id), &ts); err != nil {
+		return 0, fmt.Errorf("read %v: %w", id, err)
+	}
+	if err := unix.ClockGettime(unix.CLOCK_REALTIME, &rt); err != nil {
+		return 0, fmt.Errorf("read %v: %w", vclock.Realtime, err)
+	}
+
+	return ts.Nano() - (rt.Nano() - epoch.UnixNano()), nil
+}
+
+// Deadline translates the virtual deadline of the kernel clock id, in nanoseconds, to the reading of the kernel
+// clock it's reached at, given the current reading of the kernel clock.
+//
+// The slew in progress is ignored, so a slewing clock reaches the deadline slightly early or late. A future
+// deadline of a frozen clock is never reached. Deadline reports false if the kernel clock is not replaced.
+func (c *Clocks) Deadline(id vclock.ID, deadline, reading int64) (int64, bool) {
+	vc, ok := c.set.Lookup(id)
+	if !ok {
+		return deadline, false
+	}
+
+	now, _ := c.Translate(id, reading)
+	switch {
+	case deadline <= now:
+		return reading, true
+	case vc.Frozen:
+		return math.MaxInt64, true
+	}
+
+	return reading + int64(vc.RealDuration(time.Duration(deadline-now))), true
+}
+
+// RealDuration returns the real duration, in nanoseconds, it takes for the virtual clock which replaces the
+// kernel clock id to advance by d. RealDuration reports false if the kernel clock is not replaced.
+func (c *Clocks) RealDuration(id vclock.ID, d int64) (int64, bool) {
+	vc, ok := c.set.Lookup(id)
+	if !ok {
+		return d, false
+	}
+
+	return int64(vc.RealDuration(time.Duration(d))), true
+}
+
+// VirtualDuration returns the virtual duration, in nanoseconds, the virtual clock which replaces the kernel
+// clock id advances by in the real duration d. VirtualDuration reports false if the kernel clock is not replaced.
+func (c *Clocks) VirtualDuration(id vclock.ID, d int64) (int64, bool) {
+	vc, ok := c.set.Lookup(id)
+	if !ok {
+		return d, false
+	}
+
+	return int64(vc.VirtualDuration(time.Duration(d))), true
+}
+
+// ShiftTimespec rewrites the struct timespec at addr in the tracee's memory, which was filled from the
+// kernel clock id, to the virtual time.
+//
+// ShiftTimespec reports false without touching the tracee if the kernel clock is not replaced.
+func ShiftTimespec(pid int, addr uintptr, clocks *Clocks, id vclock.ID) (bool, error) {
+	if _, ok := clocks.set.Lookup(id); !ok {
+		return false, nil
+	}
+
+	ts, err := ReadTimespec(pid, addr)
+	if err != nil {
+		return false, err
+	}
+	v, _ := clocks.Translate(id, ts.Nano())
+
+	return true, WriteTimespec(pid, addr, unix.NsecToTimespec(v))
+}
+
+// ShiftTimeval rewrites the struct timeval at addr in the tracee's memory to the virtual time.
+//
+// Timevals are always filled from CLOCK_REALTIME, ShiftTimeval reports false without touching the tracee
+// if it is not replaced.
+func ShiftTimeval(pid int, addr uintptr, clocks *Clocks) (bool, error) {
+	if _, ok := clocks.set.Lookup(vclock.Realtime); !ok {
+		return false, nil
+	}
+
+	tv, err := ReadTimeval(pid, addr)
+	if err != nil {
+		return false, err
+	}
+	v, _ := clocks.Translate(vclock.Realtime, tv.Nano())
+
+	return true, WriteTimeval(pid, addr, unix.NsecToTimeval(v))
+}
@@ -0,0 +1,56 @@
+// Copyright 2020 The kube-timeleap Authors.
+// SPDX-License-Identifier: BSD-3-Clause
+
+// +build linux
+
+package ptrace
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/zchee/kube-timeleap/pkg/vclock"
+)
+
+func TestClocks_Translate(t *testing.T) {
+	clocks, err := NewClocks(vclock.Set{vclock.Realtime: {Epoch: time.Now(), Offset: time.Hour, Rate: 2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		id   int32
+	}{
+		{name: "Realtime", id: unix.CLOCK_REALTIME},
+		{name: "RealtimeCoarse", id: unix.CLOCK_REALTIME_COARSE},
+		{name: "TAI", id: unix.CLOCK_TAI},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var ts unix.Timespec
+			if err := unix.ClockGettime(tt.id, &ts); err != nil {
+				t.Fatal(err)
+			}
+
+			got, ok := clocks.Translate(vclock.ID(tt.id), ts.Nano())
+			if !ok {
+				t.Fatalf("Translate(%v) is not replaced", vclock.ID(tt.id))
+			}
+			// the clock has run for a moment at twice the speed since the epoch
+			if d := time.Duration(got - ts.Nano()); d < time.Hour-time.Second || d > time.Hour+time.Second {
+				t.Fatalf("Translate(%v) leaps by %v, want %v", vclock.ID(tt.id), d, time.Hour)
+			}
+		})
+	}
+
+	t.Run("NotReplaced", func(t *testing.T) {
+		const reading = int64(1000 * time.Second)
+		if got, ok := clocks.Translate(vclock.Boottime, reading); ok || got != reading {
+			t.Fatalf("Translate(%v) = %d, %v, want %d, false", vclock.Boottime, got, ok, reading)
+		}
+	})
+}
@@ -0,0 +1,511 @@
+// Copyright 2020 The kube-timeleap Authors.
+// SPDX-License-Identifier: BSD-3-Clause
+
+// +build linux
+
+package ptrace
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/zchee/kube-timeleap/pkg/vclock"
+)
+
+// traceOptions is the ptrace options set on the tracees.
+//
+// PTRACE_O_TRACESYSGOOD tells the syscall-stops apart from the SIGTRAPs sent to the tracees,
+// PTRACE_O_TRACECLONE, PTRACE_O_TRACEFORK and PTRACE_O_TRACEVFORK trace the threads and the children spawned
+// by the tracees, and PTRACE_O_TRACEEXEC replaces the SIGTRAP sent after execve(2) with an event stop.
+const traceOptions = unix.PTRACE_O_TRACESYSGOOD | unix.PTRACE_O_TRACECLONE | unix.PTRACE_O_TRACEFORK | unix.PTRACE_O_TRACEVFORK |
+	unix.PTRACE_O_TRACEEXEC
+
+// syscallStop is the stop signal of the syscall-stops with PTRACE_O_TRACESYSGOOD.
+const syscallStop = unix.SIGTRAP | 0x80
+
+// Tracer rewrites the results of the time syscalls of the tracees to the virtual time.
+//
+// The tracees stop at the entry and the exit of every syscall, or only of the time syscalls in the Seccomp
+// mode. At the exit of clock_gettime(2), gettimeofday(2) and time(2) the Tracer rewrites the returned time in
+// the tracee's memory and RAX. The timeout of clock_nanosleep(2) is translated to the kernel clock at the
+// entry and restored at the exit, so the tracees sleep until the virtual deadline.
+//
+// The reads of the clocks through the vDSO, as glibc and the Go runtime do, never enter the kernel. The Tracer
+// diverts the vDSO functions which read the clocks to the syscalls by DivertVDSO, as it starts or attaches to
+// a process and after every execve(2), so those reads are rewritten too, at the cost of a syscall per read of
+// any clock. The reads by other means, e.g. of the TSC by RDTSC, are not seen by the Tracer.
+//
+// The threads and the children spawned by the tracees are traced too, so the Tracer covers the whole process
+// tree of the tracee.
+//
+// Every ptrace request must be issued from the thread the tracees are attached to, so Run must be called from
+// the same OS thread, locked by runtime.LockOSThread. Run waits only for the tracees and the children of that
+// thread, so the children of the other threads are left to their own waiters.
+type Tracer struct {
+	// Seccomp stops the tracees only at the syscalls traced by the seccomp filter, instead of every syscall,
+	// so the other syscalls run at native speed. The Tracer installs the filter in the tracee by
+	// Thread.InstallSeccompFilter, before the process started with the Tracer resumes, or at the first stop
+	// of the process attached by Attach, until which its threads run untraced.
+	Seccomp bool
+
+	clocks *Clocks
+
+	// threads is the state of each traced thread, keyed by tid.
+	threads map[int]*tracedThread
+
+	// unprepared is the processes attached by Attach, which are yet to be prepared by prepare.
+	unprepared map[int]bool
+}
+
+// tracedThread is the state of a traced thread.
+type tracedThread struct {
+	// started reports whether the initial stop of the thread spawned by a tracee is consumed.
+	started bool
+
+	// interrupted reports whether the thread is interrupted by Attach, and the stop is yet to be consumed.
+	interrupted bool
+
+	// tgid is the process of the thread interrupted by Attach.
+	tgid int
+
+	// unannounced reports whether the thread has stopped before the clone event of its parent is consumed.
+	unannounced bool
+
+	// inSyscall reports whether the thread is stopped between the syscall-entry and the syscall-exit, as of
+	// the last syscall-stop.
+	inSyscall bool
+
+	// restore undoes the rewrite of the syscall arguments at the syscall-entry, if any.
+	restore func() error
+
+	// sleepID is the kernel clock of the relative clock_nanosleep(2) in progress, whose remaining time is
+	// translated back to the virtual clock.
+	sleepID *vclock.ID
+}
+
+// NewTracer returns the Tracer which rewrites the time syscalls to clocks.
+func NewTracer(clocks *Clocks) *Tracer {
+	return &Tracer{
+		clocks:     clocks,
+		threads:    make(map[int]*tracedThread),
+		unprepared: make(map[int]bool),
+	}
+}
+
+// options returns the ptrace options set on the tracees.
+func (t *Tracer) options() int {
+	if t.Seccomp {
+		return traceOptions | unix.PTRACE_O_TRACESECCOMP
+	}
+
+	return traceOptions
+}
+
+// Attach seizes every thread of the running process pid, which Run traces afterwards.
+//
+// The threads are enumerated from /proc/<pid>/task until no new thread is found, and the threads spawned
+// meanwhile by the seized ones are traced by the ptrace options anyway. The vDSO of the process is diverted,
+// and the seccomp filter is installed in the Seccomp mode, at the first stop of its threads consumed by Run.
+func (t *Tracer) Attach(pid int) error {
+	t.unprepared[pid] = true
+
+	self := os.Getpid()
+	for {
+		tids, err := threadIDs(pid)
+		if err != nil {
+			return err
+		}
+
+		seized := 0
+		for _, tid := range tids {
+			if _, ok := t.threads[tid]; ok {
+				continue
+			}
+
+			th := &tracedThread{started: true}
+			if err := Seize(tid, t.options()); err != nil {
+				switch {
+				case errors.Is(err, unix.ESRCH):
+					continue // exited meanwhile
+				case errors.Is(err, unix.EPERM) && tracerPID(tid) == self:
+					// spawned by a seized thread, whose initial stop is to come
+					th.started = false
+				default:
+					return fmt.Errorf("seize %d: %w", tid, err)
+				}
+			} else {
+				// PTRACE_SYSCALL and prepare take a stopped tracee
+				if err := Interrupt(tid); err != nil && !errors.Is(err, unix.ESRCH) {
+					return fmt.Errorf("interrupt %d: %w", tid, err)
+				}
+				th.interrupted = true
+				th.tgid = pid
+			}
+			t.threads[tid] = th
+			seized++
+		}
+		if seized == 0 {
+			return nil
+		}
+	}
+}
+
+// threadIDs returns the tids of the threads of the process pid.
+func threadIDs(pid int) ([]int, error) {
+	entries, err := ioutil.ReadDir(fmt.Sprintf("/proc/%d/task", pid))
+	if err != nil {
+		return nil, fmt.Errorf("list threads of %d: %w", pid, err)
+	}
+
+	tids := make([]int, 0, len(entries))
+	for _, e := range entries {
+		tid, err := strconv.Atoi(e.Name())
+		if err != nil {
+			continue
+		}
+		tids = append(tids, tid)
+	}
+
+	return tids, nil
+}
+
+// tracerPID returns the pid of the tracer of the thread tid, or zero if it's not traced or unknown.
+func tracerPID(tid int) int {
+	status, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/status", tid))
+	if err != nil {
+		return 0
+	}
+
+	for _, line := range strings.Split(string(status), "\n") {
+		if v := strings.TrimPrefix(line, "TracerPid:"); v != line {
+			pid, _ := strconv.Atoi(strings.TrimSpace(v))
+			return pid
+		}
+	}
+
+	return 0
+}
+
+// event returns the ptrace event the tracee is stopped by, or zero if it's not stopped by an event.
+//
+// Unlike unix.WaitStatus.TrapCause, event reports PTRACE_EVENT_STOP of the group-stop too.
+func event(status unix.WaitStatus) int {
+	return int(status) >> 16
+}
+
+// Run traces the process pid until every traced thread exits, and returns the wait status pid exited with.
+//
+// pid must be a stopped tracee of the calling thread, e.g. the process started by os/exec with
+// syscall.SysProcAttr.Ptrace after it has stopped at execve(2), or the process attached by Attach.
+//
+// The process started for the Tracer, i.e. not attached by Attach, is traced with PTRACE_O_EXITKILL too, so
+// it's killed along with its traced children if the Tracer exits, since it never runs without the time leap.
+// The process attached by Attach was running before, and is left running if the Tracer exits.
+func (t *Tracer) Run(pid int) (unix.WaitStatus, error) {
+	var exited unix.WaitStatus
+
+	if _, attached := t.threads[pid]; !attached {
+		if err := SetOptions(pid, t.options()|unix.PTRACE_O_EXITKILL); err != nil {
+			return exited, fmt.Errorf("set options of %d: %w", pid, err)
+		}
+		t.threads[pid] = &tracedThread{started: true}
+		if err := t.prepare(pid, pid); err != nil {
+			return exited, err
+		}
+		if err := t.resume(pid, t.threads[pid], 0); err != nil {
+			return exited, fmt.Errorf("resume %d: %w", pid, err)
+		}
+	}
+
+	// reaped is the threads which have exited before the clone events of their parents, to which the events
+	// come too late
+	reaped := make(map[int]bool)
+	for len(t.threads) > 0 {
+		// __WNOTHREAD leaves the children of the other threads of the caller, e.g. the ones os/exec waits for
+		var status unix.WaitStatus
+		tid, err := unix.Wait4(-1, &status, unix.WALL|unix.WNOTHREAD, nil)
+		switch {
+		case errors.Is(err, unix.EINTR):
+			continue
+		case err != nil:
+			return exited, fmt.Errorf("wait: %w", err)
+		}
+
+		th, ok := t.threads[tid]
+		if !ok {
+			if !status.Stopped() {
+				// not a tracee, e.g. another child of the calling thread
+				continue
+			}
+			// the stop of the new thread may be reported before the clone event of its parent
+			th = &tracedThread{unannounced: true}
+			t.threads[tid] = th
+		}
+
+		if status.Exited() || status.Signaled() {
+			delete(t.threads, tid)
+			if th.unannounced {
+				reaped[tid] = true
+			}
+			if tid == pid {
+				exited = status
+			}
+			continue
+		}
+		if !status.Stopped() {
+			continue
+		}
+
+		sig := 0
+		switch stop := status.StopSignal(); {
+		case stop == syscallStop:
+			if err := t.syscallStop(tid, th); err != nil {
+				log.Error(err, "unable to rewrite the syscall", "tid", tid)
+			}
+
+		case stop == unix.SIGTRAP && event(status) == unix.PTRACE_EVENT_SECCOMP:
+			// the seccomp stop is at the syscall-entry, and the syscall-exit stops by PTRACE_SYSCALL
+			if err := t.syscallStop(tid, th); err != nil {
+				log.Error(err, "unable to rewrite the syscall", "tid", tid)
+			}
+
+		case stop == unix.SIGTRAP && (event(status) == unix.PTRACE_EVENT_CLONE || event(status) == unix.PTRACE_EVENT_FORK || event(status) == unix.PTRACE_EVENT_VFORK):
+			msg, err := GetEventMsg(tid)
+			if err != nil {
+				return exited, fmt.Errorf("clone event of %d: %w", tid, err)
+			}
+			child, ok := t.threads[int(msg)]
+			switch {
+			case reaped[int(msg)]:
+				delete(reaped, int(msg))
+			case ok:
+				child.unannounced = false
+			default:
+				t.threads[int(msg)] = &tracedThread{}
+			}
+
+		case stop == unix.SIGTRAP && event(status) == unix.PTRACE_EVENT_EXEC:
+			// execve(2) has replaced every other thread, and restarts the syscall-stops from the exit
+			th.inSyscall = true
+			if former, err := GetEventMsg(tid); err == nil && int(former) != tid {
+				// the thread has taken over the tid of the thread group leader
+				delete(t.threads, int(former))
+			}
+			// the new program has the new vDSO
+			if err := DivertVDSO(tid, t.clocks.set.IDs()...); err != nil {
+				log.Error(err, "unable to divert the vDSO", "tid", tid)
+			}
+
+		case event(status) == unix.PTRACE_EVENT_STOP && stop != unix.SIGTRAP:
+			// the group-stop of the seized tracee stays until SIGCONT
+			if err := Listen(tid); err != nil && !errors.Is(err, unix.ESRCH) {
+				return exited, fmt.Errorf("listen %d: %w", tid, err)
+			}
+			continue
+
+		case event(status) == unix.PTRACE_EVENT_STOP && (!th.started || th.interrupted):
+			// the initial stop of the thread spawned by a seized tracee, or the stop by Attach
+			if th.interrupted && t.unprepared[th.tgid] {
+				if err := t.prepare(th.tgid, tid); err != nil {
+					return exited, err
+				}
+				delete(t.unprepared, th.tgid)
+			}
+			th.started, th.interrupted = true, false
+
+		case stop == unix.SIGSTOP && !th.started:
+			th.started = true
+
+		case stop == unix.SIGTRAP && event(status) != 0:
+			// other ptrace events are not requested
+
+		default:
+			// deliver the signal to the tracee
+			sig = int(stop)
+		}
+
+		if err := t.resume(tid, th, sig); err != nil && !errors.Is(err, unix.ESRCH) {
+			return exited, fmt.Errorf("resume %d: %w", tid, err)
+		}
+	}
+
+	return exited, nil
+}
+
+// prepare diverts the vDSO of the process tgid by DivertVDSO, and installs the seccomp filter in it in the
+// Seccomp mode, by its stopped thread tid.
+func (t *Tracer) prepare(tgid, tid int) error {
+	if err := DivertVDSO(tid, t.clocks.set.IDs()...); err != nil {
+		return err
+	}
+	if !t.Seccomp {
+		return nil
+	}
+
+	thread, err := NewThread(int32(tgid), int32(tid))
+	if err != nil {
+		return err
+	}
+
+	return thread.InstallSeccompFilter()
+}
+
+// resume restarts the stopped thread tid, delivering sig unless it's zero.
+//
+// In the Seccomp mode the thread runs until the next seccomp stop, unless it's in a syscall whose exit must
+// be rewritten.
+func (t *Tracer) resume(tid int, th *tracedThread, sig int) error {
+	if t.Seccomp && !th.inSyscall {
+		return Cont(tid, sig)
+	}
+
+	return Syscall(tid, sig)
+}
+
+// syscallStop handles the syscall-stop of the thread tid.
+func (t *Tracer) syscallStop(tid int, th *tracedThread) error {
+	var regs unix.PtraceRegs
+	if err := GetRegs(tid, &regs); err != nil {
+		return fmt.Errorf("get registers: %w", err)
+	}
+
+	// the kernel sets RAX to -ENOSYS before the syscall-entry-stop, which tells the stops apart without
+	// counting them, so a stop missed e.g. by attaching in the middle of a syscall does not swap entries and
+	// exits for good. The exit of a syscall failed with ENOSYS is taken as an entry, which is harmless since
+	// such a syscall is never rewritten.
+	th.inSyscall = int64(regs.Rax) == -int64(unix.ENOSYS)
+	if th.inSyscall {
+		return t.syscallEnter(tid, th, &regs)
+	}
+
+	return t.syscallExit(tid, th, &regs)
+}
+
+// syscallEnter rewrites the arguments of the syscall the thread tid is entering.
+func (t *Tracer) syscallEnter(tid int, th *tracedThread, regs *unix.PtraceRegs) error {
+	if regs.Orig_rax != unix.SYS_CLOCK_NANOSLEEP || regs.Rdx == 0 {
+		return nil
+	}
+
+	// clock_nanosleep(clockid_t clockid, int flags, const struct timespec *request, struct timespec *remain)
+	id := vclock.ID(int32(regs.Rdi))
+	if _, ok := t.clocks.set.Lookup(id); !ok {
+		return nil
+	}
+	addr := uintptr(regs.Rdx)
+	req, err := ReadTimespec(tid, addr)
+	if err != nil {
+		return err
+	}
+
+	var (
+		timeout int64
+		ok      bool
+	)
+	if regs.Rsi&unix.TIMER_ABSTIME != 0 {
+		// the tracees share the kernel clocks of the tracer
+		var now unix.Timespec
+		if err := unix.ClockGettime(int32(id), &now); err != nil {
+			return fmt.Errorf("read %v: %w", id, err)
+		}
+		timeout, ok = t.clocks.Deadline(id, req.Nano(), now.Nano())
+	} else {
+		timeout, ok = t.clocks.RealDuration(id, req.Nano())
+		if ok && regs.R10 != 0 {
+			th.sleepID = &id
+		}
+	}
+	if !ok {
+		return nil
+	}
+
+	th.restore = func() error {
+		return WriteTimespec(tid, addr, req)
+	}
+
+	return WriteTimespec(tid, addr, unix.NsecToTimespec(timeout))
+}
+
+// syscallExit rewrites the results of the syscall the thread tid is exiting.
+func (t *Tracer) syscallExit(tid int, th *tracedThread, regs *unix.PtraceRegs) error {
+	if th.restore != nil {
+		restore := th.restore
+		th.restore = nil
+		if err := restore(); err != nil {
+			return err
+		}
+	}
+	sleepID := th.sleepID
+	th.sleepID = nil
+
+	ret := int64(regs.Rax)
+	switch regs.Orig_rax {
+	case unix.SYS_CLOCK_GETTIME:
+		// clock_gettime(clockid_t clockid, struct timespec *tp)
+		if ret != 0 || regs.Rsi == 0 {
+			return nil
+		}
+		_, err := ShiftTimespec(tid, uintptr(regs.Rsi), t.clocks, vclock.ID(int32(regs.Rdi)))
+		return err
+
+	case unix.SYS_GETTIMEOFDAY:
+		// gettimeofday(struct timeval *tv, struct timezone *tz)
+		if ret != 0 || regs.Rdi == 0 {
+			return nil
+		}
+		_, err := ShiftTimeval(tid, uintptr(regs.Rdi), t.clocks)
+		return err
+
+	case unix.SYS_TIME:
+		// time_t time(time_t *tloc)
+		if ret < 0 {
+			return nil
+		}
+		// translate the reading in nanoseconds instead of the truncated result, which the rate would magnify
+		var now unix.Timespec
+		if err := unix.ClockGettime(unix.CLOCK_REALTIME, &now); err != nil {
+			return fmt.Errorf("read %v: %w", vclock.Realtime, err)
+		}
+		v, ok := t.clocks.Translate(vclock.Realtime, now.Nano())
+		if !ok {
+			return nil
+		}
+		sec := v / int64(time.Second)
+		if v < 0 && v%int64(time.Second) != 0 {
+			sec-- // round towards the past as the kernel does
+		}
+		regs.Rax = uint64(sec)
+		if err := SetRegs(tid, regs); err != nil {
+			return fmt.Errorf("set registers: %w", err)
+		}
+		if regs.Rdi != 0 {
+			buf := (*[unsafe.Sizeof(sec)]byte)(unsafe.Pointer(&sec))
+			if _, err := PokeData(tid, uintptr(regs.Rdi), buf[:]); err != nil {
+				return fmt.Errorf("write time at %#x: %w", regs.Rdi, err)
+			}
+		}
+
+	case unix.SYS_CLOCK_NANOSLEEP:
+		// the remaining time is written only if the relative sleep is interrupted
+		if sleepID == nil || ret != -int64(unix.EINTR) {
+			return nil
+		}
+		addr := uintptr(regs.R10)
+		rem, err := ReadTimespec(tid, addr)
+		if err != nil {
+			return err
+		}
+		v, _ := t.clocks.VirtualDuration(*sleepID, rem.Nano())
+		return WriteTimespec(tid, addr, unix.NsecToTimespec(v))
+	}
+
+	return nil
+}
@@ -0,0 +1,465 @@
+// Copyright 2020 The kube-timeleap Authors.
+// SPDX-License-Identifier: BSD-3-Clause
+
+// +build linux
+
+package ptrace
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/zchee/kube-timeleap/pkg/vclock"
+)
+
+// TestHelperProcess is not a real test, it's the tracee of the tests run as a subprocess.
+//
+// It reads the time by the raw syscalls, which bypass the vDSO, and by time.Now, which reads the time through
+// the vDSO, and prints the readings in nanoseconds.
+// GO_HELPER_LOOP makes as many getppid(2) calls instead. GO_HELPER_TREE waits for a byte on stdin, and then
+// runs itself as a child before reading the time, prefixing the readings of the child with "child" and its own
+// with "parent".
+func TestHelperProcess(t *testing.T) {
+	if os.Getenv("GO_WANT_HELPER_PROCESS") != "1" {
+		return
+	}
+
+	prefix := os.Getenv("GO_HELPER_PREFIX")
+	if os.Getenv("GO_HELPER_TREE") == "1" {
+		// wait for the tracer to attach
+		fmt.Println("ready")
+		var b [1]byte
+		if _, err := os.Stdin.Read(b[:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+
+		cmd := exec.Command(os.Args[0], "-test.run=TestHelperProcess")
+		cmd.Env = append(os.Environ(), "GO_HELPER_TREE=0", "GO_HELPER_PREFIX=child ")
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(3)
+		}
+		prefix = "parent "
+	}
+
+	if loop := os.Getenv("GO_HELPER_LOOP"); loop != "" {
+		n, err := strconv.Atoi(loop)
+		if err != nil {
+			os.Exit(2)
+		}
+		for i := 0; i < n; i++ {
+			unix.RawSyscall(unix.SYS_GETPPID, 0, 0, 0)
+		}
+		os.Exit(0)
+	}
+
+	var ts unix.Timespec
+	if _, _, errno := unix.RawSyscall(unix.SYS_CLOCK_GETTIME, unix.CLOCK_REALTIME, uintptr(unsafe.Pointer(&ts)), 0); errno != 0 {
+		fmt.Fprintln(os.Stderr, "clock_gettime:", errno)
+		os.Exit(2)
+	}
+	var tv unix.Timeval
+	if _, _, errno := unix.RawSyscall(unix.SYS_GETTIMEOFDAY, uintptr(unsafe.Pointer(&tv)), 0, 0); errno != 0 {
+		fmt.Fprintln(os.Stderr, "gettimeofday:", errno)
+		os.Exit(2)
+	}
+	sec, _, _ := unix.RawSyscall(unix.SYS_TIME, 0, 0, 0)
+	now := time.Now()
+
+	// sleep 10s of the virtual time, continuing with the remaining time if interrupted by the signals of the
+	// Go runtime
+	req := unix.NsecToTimespec(int64(10 * time.Second))
+	start := time.Now()
+	for {
+		var rem unix.Timespec
+		_, _, errno := unix.Syscall6(unix.SYS_CLOCK_NANOSLEEP, unix.CLOCK_REALTIME, 0, uintptr(unsafe.Pointer(&req)), uintptr(unsafe.Pointer(&rem)), 0, 0)
+		if errno == unix.EINTR {
+			req = rem
+			continue
+		}
+		if errno != 0 {
+			fmt.Fprintln(os.Stderr, "clock_nanosleep:", errno)
+			os.Exit(2)
+		}
+		break
+	}
+
+	fmt.Printf("%sclock_gettime %d\n", prefix, ts.Nano())
+	fmt.Printf("%sgettimeofday %d\n", prefix, tv.Nano())
+	fmt.Printf("%stime %d\n", prefix, int64(sec)*int64(time.Second))
+	fmt.Printf("%svdso %d\n", prefix, now.UnixNano())
+	fmt.Printf("%sclock_nanosleep %d\n", prefix, int64(time.Since(start)))
+	os.Exit(0)
+}
+
+// startTracee starts TestHelperProcess stopped at execve(2) as the tracee of the calling thread, which must be
+// locked by runtime.LockOSThread, and returns its pid and the read end of its stdout.
+func startTracee(tb testing.TB, env ...string) (int, *os.File) {
+	tb.Helper()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer w.Close()
+
+	cmd := exec.Command(os.Args[0], "-test.run=TestHelperProcess")
+	cmd.Env = append(append(os.Environ(), "GO_WANT_HELPER_PROCESS=1"), env...)
+	cmd.Stdout = w
+	cmd.Stderr = os.Stderr
+	cmd.SysProcAttr = &syscall.SysProcAttr{Ptrace: true}
+	if err := cmd.Start(); err != nil {
+		r.Close()
+		tb.Skipf("unable to start the tracee: %v", err)
+	}
+	pid := cmd.Process.Pid
+
+	var status unix.WaitStatus
+	if _, err := unix.Wait4(pid, &status, unix.WALL, nil); err != nil {
+		tb.Fatal(err)
+	}
+	if !status.Stopped() || status.StopSignal() != unix.SIGTRAP {
+		tb.Fatalf("status = %v, want stopped by SIGTRAP", status)
+	}
+
+	return pid, r
+}
+
+// readReadings returns the readings printed by TestHelperProcess to r, keyed by the prefixed syscall name.
+func readReadings(t *testing.T, r io.Reader) map[string]int64 {
+	t.Helper()
+
+	readings := make(map[string]int64)
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		v, err := strconv.ParseInt(fields[len(fields)-1], 10, 64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		readings[strings.Join(fields[:len(fields)-1], " ")] = v
+	}
+
+	return readings
+}
+
+// checkReadings checks the readings prefixed with prefix are of the virtual clock which has read the real time
+// plus offset at before, and runs rate times as fast as the real time since then until after.
+func checkReadings(t *testing.T, readings map[string]int64, prefix string, before, after time.Time, offset time.Duration, rate int64) {
+	t.Helper()
+
+	lower := before.Add(offset).UnixNano()
+	upper := before.Add(offset + time.Duration(rate)*after.Sub(before)).UnixNano()
+	for _, name := range []string{"clock_gettime", "gettimeofday", "vdso", "time"} {
+		v, ok := readings[prefix+name]
+		if !ok {
+			t.Fatalf("%s%s is not printed: %v", prefix, name, readings)
+		}
+		if name == "time" {
+			lower -= lower % int64(time.Second)
+		}
+		if v < lower || v > upper {
+			t.Fatalf("%s%s = %v, want within [%v, %v]", prefix, name, time.Unix(0, v), time.Unix(0, lower), time.Unix(0, upper))
+		}
+	}
+
+	// 10s of the virtual time is 10ms of the real time at the rate 1000
+	if d := time.Duration(readings[prefix+"clock_nanosleep"]); d <= 0 || d > 10*time.Second/time.Duration(rate)+5*time.Second {
+		t.Fatalf("%sclock_nanosleep slept %v, want about %v", prefix, d, 10*time.Second/time.Duration(rate))
+	}
+}
+
+func TestTracer_Run(t *testing.T) {
+	tests := []struct {
+		name    string
+		seccomp bool
+	}{
+		{
+			name: "Syscall",
+		},
+		{
+			name:    "Seccomp",
+			seccomp: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			// the tracer must issue every ptrace request from the thread which started the tracee
+			runtime.LockOSThread()
+			defer runtime.UnlockOSThread()
+
+			const offset = 72 * time.Hour
+			before := time.Now()
+			clocks, err := NewClocks(vclock.Set{
+				vclock.Realtime: {Epoch: before, Offset: offset, Rate: 1000},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			pid, r := startTracee(t)
+			defer r.Close()
+
+			tracer := NewTracer(clocks)
+			tracer.Seccomp = tt.seccomp
+			exited, err := tracer.Run(pid)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !exited.Exited() || exited.ExitStatus() != 0 {
+				t.Fatalf("tracee exited with %v", exited)
+			}
+			after := time.Now()
+
+			checkReadings(t, readReadings(t, r), "", before, after, offset, 1000)
+		})
+	}
+}
+
+func TestTracer_RunOtherChildren(t *testing.T) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	clocks, err := NewClocks(vclock.Set{
+		vclock.Realtime: {Epoch: time.Now(), Offset: time.Hour, Rate: 1000},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a child of another thread which has exited, and is yet to be waited for by os/exec
+	started := make(chan *exec.Cmd)
+	go func() {
+		cmd := exec.Command(os.Args[0], "-test.run=^$")
+		if err := cmd.Start(); err != nil {
+			t.Error(err)
+			cmd = nil
+		}
+		started <- cmd
+	}()
+	other := <-started
+	if other == nil {
+		return
+	}
+	for deadline := time.Now().Add(10 * time.Second); ; time.Sleep(time.Millisecond) {
+		stat, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/stat", other.Process.Pid))
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the state follows the parenthesized command name
+		if fields := strings.Fields(string(stat[bytes.LastIndexByte(stat, ')')+1:])); len(fields) > 0 && fields[0] == "Z" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the other child has not exited")
+		}
+	}
+
+	pid, r := startTracee(t)
+	defer r.Close()
+
+	exited, err := NewTracer(clocks).Run(pid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !exited.Exited() || exited.ExitStatus() != 0 {
+		t.Fatalf("tracee exited with %v", exited)
+	}
+	if err := other.Wait(); err != nil {
+		t.Fatalf("wait for the other child: %v", err)
+	}
+}
+
+func TestTracer_Attach(t *testing.T) {
+	tests := []struct {
+		name    string
+		seccomp bool
+	}{
+		{
+			name: "Syscall",
+		},
+		{
+			// the filter is installed in the running process
+			name:    "Seccomp",
+			seccomp: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			runtime.LockOSThread()
+			defer runtime.UnlockOSThread()
+
+			const offset = 72 * time.Hour
+			before := time.Now()
+			clocks, err := NewClocks(vclock.Set{
+				vclock.Realtime: {Epoch: before, Offset: offset, Rate: 1000},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			r, w, err := os.Pipe()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Close()
+			cmd := exec.Command(os.Args[0], "-test.run=TestHelperProcess")
+			cmd.Env = append(os.Environ(), "GO_WANT_HELPER_PROCESS=1", "GO_HELPER_TREE=1")
+			cmd.Stdout = w
+			cmd.Stderr = os.Stderr
+			stdin, err := cmd.StdinPipe()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer stdin.Close()
+			if err := cmd.Start(); err != nil {
+				w.Close()
+				t.Skipf("unable to start the process: %v", err)
+			}
+			w.Close()
+			pid := cmd.Process.Pid
+
+			// the running process with the threads of the Go runtime
+			out := bufio.NewReader(r)
+			if line, err := out.ReadString('\n'); err != nil || line != "ready\n" {
+				cmd.Process.Kill()
+				t.Fatalf("got %q, %v, want ready", line, err)
+			}
+			tracer := NewTracer(clocks)
+			tracer.Seccomp = tt.seccomp
+			if err := tracer.Attach(pid); err != nil {
+				cmd.Process.Kill()
+				t.Fatal(err)
+			}
+			if len(tracer.threads) < 2 {
+				t.Fatalf("attached %d threads, want every thread of the Go runtime", len(tracer.threads))
+			}
+			if _, err := stdin.Write([]byte{'\n'}); err != nil {
+				t.Fatal(err)
+			}
+
+			exited, err := tracer.Run(pid)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !exited.Exited() || exited.ExitStatus() != 0 {
+				t.Fatalf("process exited with %v", exited)
+			}
+			after := time.Now()
+
+			// the time leap covers the child forked after attaching too
+			readings := readReadings(t, out)
+			checkReadings(t, readings, "parent ", before, after, offset, 1000)
+			checkReadings(t, readings, "child ", before, after, offset, 1000)
+		})
+	}
+}
+
+func TestTracer_AttachTracerExit(t *testing.T) {
+	cmd, stdin := startBlocked(t)
+
+	clocks, err := NewClocks(vclock.Set{vclock.Realtime: {Epoch: time.Now(), Offset: time.Hour}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the thread of the tracer exits along with the goroutine locked to it, unless it's the main thread which
+	// the Go runtime never lets exit, so this goroutine keeps its own thread not to hand it over
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	attached := make(chan error)
+	for err = errMainThread; err == errMainThread; err = <-attached {
+		go func() {
+			runtime.LockOSThread()
+			if unix.Gettid() == os.Getpid() {
+				runtime.UnlockOSThread()
+				attached <- errMainThread
+				return
+			}
+			attached <- NewTracer(clocks).Attach(cmd.Process.Pid)
+		}()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(10 * time.Second); tracerPID(cmd.Process.Pid) != 0; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("the process is not detached")
+		}
+	}
+
+	// the attached process is detached instead of killed, and runs on
+	if _, err := stdin.Write([]byte{'\n'}); err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Wait(); err != nil {
+		t.Fatalf("process exited with %v", err)
+	}
+}
+
+// errMainThread reports the goroutine of TestTracer_AttachTracerExit is run on the main thread.
+var errMainThread = errors.New("main thread")
+
+func BenchmarkTracer(b *testing.B) {
+	benchmarks := []struct {
+		name    string
+		seccomp bool
+	}{
+		{
+			name: "Syscall",
+		},
+		{
+			name:    "Seccomp",
+			seccomp: true,
+		},
+	}
+	for _, bb := range benchmarks {
+		bb := bb
+		b.Run(bb.name, func(b *testing.B) {
+			runtime.LockOSThread()
+			defer runtime.UnlockOSThread()
+
+			clocks, err := NewClocks(vclock.Set{vclock.Realtime: {Epoch: time.Now(), Offset: time.Hour}})
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			// a getppid(2) call per iteration
+			pid, r := startTracee(b, "GO_HELPER_LOOP="+strconv.Itoa(b.N))
+			defer r.Close()
+
+			tracer := NewTracer(clocks)
+			tracer.Seccomp = bb.seccomp
+			b.ResetTimer()
+			exited, err := tracer.Run(pid)
+			if err != nil {
+				b.Fatal(err)
+			}
+			if !exited.Exited() || exited.ExitStatus() != 0 {
+				b.Fatalf("tracee exited with %v", exited)
+			}
+		})
+	}
+}
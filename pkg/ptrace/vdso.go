@@ -0,0 +1,94 @@
+// Copyright 2020 The kube-timeleap Authors.
+// SPDX-License-Identifier: BSD-3-Clause
+
+// +build linux
+
+package ptrace
+
+import (
+	"bytes"
+	"debug/elf"
+	"errors"
+	"fmt"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/zchee/kube-timeleap/pkg/vclock"
+	"github.com/zchee/kube-timeleap/pkg/vdso"
+)
+
+// vdsoSyscalls is the syscall each of vdso.SymbolKeys falls back to, which takes the same arguments.
+var vdsoSyscalls = map[string]uintptr{
+	"__vdso_gettimeofday":  unix.SYS_GETTIMEOFDAY,
+	"__vdso_clock_gettime": unix.SYS_CLOCK_GETTIME,
+	"__vdso_time":          unix.SYS_TIME,
+}
+
+// vdsoStub returns the code which replaces a vDSO function by the syscall nr. The arguments of the function
+// are already in the registers of the syscall but the fourth, which none of the functions takes.
+func vdsoStub(nr uintptr) []byte {
+	return []byte{
+		0xb8, byte(nr), byte(nr >> 8), 0x00, 0x00, // mov eax, nr
+		0x0f, 0x05, // syscall
+		0xc3, // ret
+	}
+}
+
+// DivertVDSO replaces the vDSO functions of the stopped tracee tid which read any of the clocks with the
+// syscalls they fall back to, so that the reads of the clocks through the vDSO enter the kernel, where the
+// Tracer sees them.
+//
+// The functions are looked up by vdso.SymbolKeysFor in the dynamic symbols of the vDSO read from the tracee,
+// and overwritten by PTRACE_POKETEXT, which writes to the private copy of the vDSO of the process. The forked
+// children inherit the copy, while execve(2) maps a new vDSO, which must be diverted again. A process without
+// the vDSO has nothing to divert.
+func DivertVDSO(tid int, clocks ...vclock.ID) error {
+	keys := vdso.SymbolKeysFor(clocks...)
+	if len(keys) == 0 {
+		return nil
+	}
+
+	start, end, err := vdsoRange(tid)
+	if err != nil {
+		if errors.Is(err, errNoVDSO) {
+			return nil
+		}
+		return err
+	}
+	image := make([]byte, end-start)
+	if _, err := PeekText(tid, start, image); err != nil {
+		return fmt.Errorf("read vDSO of %d: %w", tid, err)
+	}
+	f, err := elf.NewFile(bytes.NewReader(image))
+	if err != nil {
+		return fmt.Errorf("parse vDSO of %d: %w", tid, err)
+	}
+	syms, err := f.DynamicSymbols()
+	if err != nil {
+		return fmt.Errorf("read vDSO symbols of %d: %w", tid, err)
+	}
+
+	// the symbol values are the addresses the vDSO is linked at, which are relative to the first segment
+	var linked uint64
+	for _, prog := range f.Progs {
+		if prog.Type == elf.PT_LOAD {
+			linked = prog.Vaddr - prog.Off
+			break
+		}
+	}
+
+	for _, k := range keys {
+		for _, sym := range syms {
+			if sym.Name != k.Name || elf.ST_TYPE(sym.Info) != elf.STT_FUNC || sym.Value == 0 {
+				continue
+			}
+			addr := start + uintptr(sym.Value-linked)
+			if _, err := PokeText(tid, addr, vdsoStub(vdsoSyscalls[k.Name])); err != nil {
+				return fmt.Errorf("divert %s of %d: %w", k.Name, tid, err)
+			}
+			break
+		}
+	}
+
+	return nil
+}
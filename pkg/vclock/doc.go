@@ -0,0 +1,5 @@
+// Copyright 2020 The kube-timeleap Authors.
+// SPDX-License-Identifier: BSD-3-Clause
+
+// Package vclock provides the virtual clock arithmetic shared by the controller and the tracer.
+package vclock
@@ -0,0 +1,141 @@
+// Copyright 2020 The kube-timeleap Authors.
+// SPDX-License-Identifier: BSD-3-Clause
+
+package vclock
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// ID identifies a kernel clock, same as the clockid_t of clock_gettime(2).
+type ID int32
+
+// List of kernel clocks which can be replaced by a virtual clock.
+//
+// The coarse, raw, alarm and TAI variants are not listed, they follow the clock they derive from.
+const (
+	Realtime  ID = 0
+	Monotonic ID = 1
+	Boottime  ID = 7
+)
+
+// List of kernel clocks which derive from the clocks above.
+const (
+	monotonicRaw    ID = 4
+	realtimeCoarse  ID = 5
+	monotonicCoarse ID = 6
+	realtimeAlarm   ID = 8
+	boottimeAlarm   ID = 9
+	tai             ID = 11
+)
+
+// derivedIDs maps the clocks above to the clocks which derive from them.
+var derivedIDs = map[ID][]ID{
+	Realtime:  {realtimeCoarse, realtimeAlarm, tai},
+	Monotonic: {monotonicRaw, monotonicCoarse},
+	Boottime:  {boottimeAlarm},
+}
+
+var idNames = map[ID]string{
+	Realtime:  "CLOCK_REALTIME",
+	Monotonic: "CLOCK_MONOTONIC",
+	Boottime:  "CLOCK_BOOTTIME",
+}
+
+// String implements fmt.Stringer.
+func (id ID) String() string {
+	if name, ok := idNames[id]; ok {
+		return name
+	}
+
+	return "CLOCK_" + strconv.Itoa(int(id))
+}
+
+// ParseID parses the clock name such as "CLOCK_REALTIME".
+func ParseID(name string) (ID, error) {
+	for id, n := range idNames {
+		if n == name {
+			return id, nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown clock %q", name)
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (id ID) MarshalText() ([]byte, error) {
+	if _, ok := idNames[id]; !ok {
+		return nil, fmt.Errorf("unknown clock %d", id)
+	}
+
+	return []byte(id.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (id *ID) UnmarshalText(text []byte) error {
+	v, err := ParseID(string(text))
+	if err != nil {
+		return err
+	}
+	*id = v
+
+	return nil
+}
+
+// Base returns the clock which id derives from, e.g. Realtime for CLOCK_REALTIME_COARSE.
+func (id ID) Base() ID {
+	switch id {
+	case realtimeCoarse, realtimeAlarm, tai:
+		return Realtime
+	case monotonicRaw, monotonicCoarse:
+		return Monotonic
+	case boottimeAlarm:
+		return Boottime
+	default:
+		return id
+	}
+}
+
+// Derived returns the kernel clocks which derive from id, e.g. CLOCK_REALTIME_COARSE for Realtime.
+func (id ID) Derived() []ID {
+	return derivedIDs[id]
+}
+
+// Set is a set of virtual clocks keyed by the kernel clock they replace.
+type Set map[ID]Clock
+
+// Lookup returns the virtual clock which replaces the kernel clock id, if any.
+//
+// The coarse, raw, alarm and TAI variants of a clock are replaced by the same virtual clock.
+func (s Set) Lookup(id ID) (Clock, bool) {
+	c, ok := s[id.Base()]
+	return c, ok
+}
+
+// Equal reports whether s and o replace the same kernel clocks by the same virtual clocks.
+func (s Set) Equal(o Set) bool {
+	if len(s) != len(o) {
+		return false
+	}
+	for id, c := range s {
+		oc, ok := o[id]
+		if !ok || !c.Equal(oc) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// IDs returns the kernel clocks replaced by s in ascending order.
+func (s Set) IDs() []ID {
+	ids := make([]ID, 0, len(s))
+	for id := range s {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	return ids
+}
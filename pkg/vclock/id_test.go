@@ -0,0 +1,104 @@
+// Copyright 2020 The kube-timeleap Authors.
+// SPDX-License-Identifier: BSD-3-Clause
+
+package vclock
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSet_Lookup(t *testing.T) {
+	s := Set{
+		Realtime:  Clock{Epoch: epoch, Offset: time.Hour},
+		Monotonic: Clock{Epoch: epoch, Offset: time.Minute},
+	}
+
+	tests := []struct {
+		name   string
+		id     ID
+		want   Clock
+		wantOK bool
+	}{
+		{
+			name:   "Realtime",
+			id:     Realtime,
+			want:   s[Realtime],
+			wantOK: true,
+		},
+		{
+			name:   "RealtimeCoarse",
+			id:     realtimeCoarse,
+			want:   s[Realtime],
+			wantOK: true,
+		},
+		{
+			name:   "MonotonicRaw",
+			id:     monotonicRaw,
+			want:   s[Monotonic],
+			wantOK: true,
+		},
+		{
+			name:   "RealtimeAlarm",
+			id:     realtimeAlarm,
+			want:   s[Realtime],
+			wantOK: true,
+		},
+		{
+			name:   "TAI",
+			id:     tai,
+			want:   s[Realtime],
+			wantOK: true,
+		},
+		{
+			name:   "NotReplaced",
+			id:     Boottime,
+			wantOK: false,
+		},
+		{
+			name:   "BoottimeAlarmNotReplaced",
+			id:     boottimeAlarm,
+			wantOK: false,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, ok := s.Lookup(tt.id)
+			if ok != tt.wantOK {
+				t.Fatalf("Lookup(%v) ok = %v, want %v", tt.id, ok, tt.wantOK)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Fatalf("(-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestSet_JSON(t *testing.T) {
+	s := Set{
+		Realtime: Clock{Epoch: epoch, Offset: time.Hour, Rate: 2},
+		Boottime: Clock{Epoch: epoch, Frozen: true},
+	}
+
+	data, err := json.Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got Set
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(s, got); diff != "" {
+		t.Fatalf("(-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]ID{Realtime, Boottime}, got.IDs()); diff != "" {
+		t.Fatalf("(-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,187 @@
+// Copyright 2020 The kube-timeleap Authors.
+// SPDX-License-Identifier: BSD-3-Clause
+
+package vclock
+
+import (
+	"time"
+)
+
+// Clock represents a virtual clock derived from a real clock.
+//
+// At the real instant Epoch the virtual clock reads Epoch+Offset, and from there it advances Rate times
+// as fast as the real clock, that is the virtual time at real time now is
+//
+//	Epoch + Offset + (now-Epoch)*Rate
+//
+// A Frozen clock does not advance and always reads Epoch+Offset.
+//
+// A slewing clock reads Slew less than the above at Epoch, and converges to it by correcting SlewRate real
+// seconds every real second, like adjtime(3). The slewing clock runs at Rate minus SlewRate while slowing
+// down, so as long as SlewRate is below Rate it never goes backwards nor jumps.
+type Clock struct {
+	// Epoch is the real instant the clock is anchored at.
+	Epoch time.Time `json:"epoch"`
+
+	// Offset is the difference between the virtual and the real time at Epoch.
+	Offset time.Duration `json:"offset"`
+
+	// Rate is the speed of the virtual clock relative to the real clock.
+	// The zero value means 1, the real-time rate.
+	Rate float64 `json:"rate,omitempty"`
+
+	// Frozen reports whether the clock is pinned at Epoch+Offset.
+	Frozen bool `json:"frozen,omitempty"`
+
+	// Slew is the correction yet to be applied at Epoch, which is the difference between the target and the
+	// current offset. Slew is ignored while SlewRate is zero.
+	Slew time.Duration `json:"slew,omitempty"`
+
+	// SlewRate is the correction applied every real second in real seconds.
+	SlewRate float64 `json:"slewRate,omitempty"`
+}
+
+// rate returns the effective rate of c.
+func (c Clock) rate() float64 {
+	if c.Rate == 0 {
+		return 1
+	}
+
+	return c.Rate
+}
+
+// Shift returns the virtual duration since Epoch for the real duration d since Epoch.
+func (c Clock) Shift(d time.Duration) time.Duration {
+	return c.target(d) - c.remaining(d)
+}
+
+// target returns the virtual duration since Epoch for the real duration d since Epoch once slewed.
+func (c Clock) target(d time.Duration) time.Duration {
+	if c.Frozen {
+		return c.Offset
+	}
+
+	r := c.rate()
+	if r == 1 {
+		return c.Offset + d // fast path, also avoids the float64 precision loss
+	}
+
+	return c.Offset + time.Duration(float64(d)*r)
+}
+
+// slewing reports whether c has a correction to apply.
+func (c Clock) slewing() bool {
+	return c.Slew != 0 && c.SlewRate > 0
+}
+
+// remaining returns the correction yet to be applied at the real duration d since Epoch.
+func (c Clock) remaining(d time.Duration) time.Duration {
+	if !c.slewing() {
+		return 0
+	}
+	if d <= 0 {
+		return c.Slew
+	}
+
+	corrected := time.Duration(float64(d) * c.SlewRate)
+	switch {
+	case c.Slew > 0 && corrected < c.Slew:
+		return c.Slew - corrected
+	case c.Slew < 0 && corrected < -c.Slew:
+		return c.Slew + corrected
+	default:
+		return 0
+	}
+}
+
+// OffsetAt returns the difference between the virtual and the real time at the real time now.
+func (c Clock) OffsetAt(now time.Time) time.Duration {
+	return c.At(now).Sub(now)
+}
+
+// TargetOffsetAt returns the difference between the virtual and the real time at the real time now once
+// the clock has slewed, which is OffsetAt for the clock not slewing.
+func (c Clock) TargetOffsetAt(now time.Time) time.Duration {
+	d := now.Sub(c.Epoch)
+	return c.target(d) - d
+}
+
+// SlewEnd returns the real instant the clock has slewed by, which is Epoch for the clock not slewing.
+func (c Clock) SlewEnd() time.Time {
+	if !c.slewing() {
+		return c.Epoch
+	}
+	slew := c.Slew
+	if slew < 0 {
+		slew = -slew
+	}
+
+	return c.Epoch.Add(time.Duration(float64(slew) / c.SlewRate))
+}
+
+// At returns the virtual time at the real time now.
+func (c Clock) At(now time.Time) time.Time {
+	return c.Epoch.Add(c.Shift(now.Sub(c.Epoch)))
+}
+
+// Translate translates the raw reading of an arbitrary clock, in nanoseconds, to the virtual one.
+//
+// epochReading is the reading of the same clock at Epoch. This allows clocks with an unrelated
+// origin such as CLOCK_MONOTONIC to share the Offset and Rate of c.
+func (c Clock) Translate(reading, epochReading int64) int64 {
+	return epochReading + int64(c.Shift(time.Duration(reading-epochReading)))
+}
+
+// RealDuration returns the real duration it takes for c to advance by the virtual duration d, ignoring the
+// slew in progress. A frozen clock never advances, so d is returned as is instead of waiting forever.
+func (c Clock) RealDuration(d time.Duration) time.Duration {
+	if c.Frozen || c.rate() == 1 {
+		return d
+	}
+
+	return time.Duration(float64(d) / c.rate())
+}
+
+// VirtualDuration returns the virtual duration c advances by in the real duration d, ignoring the slew in
+// progress. It's the inverse of RealDuration.
+func (c Clock) VirtualDuration(d time.Duration) time.Duration {
+	if c.Frozen || c.rate() == 1 {
+		return d
+	}
+
+	return time.Duration(float64(d) * c.rate())
+}
+
+// Equal reports whether c and o describe the same virtual clock.
+func (c Clock) Equal(o Clock) bool {
+	return c.Epoch.Equal(o.Epoch) && c.Offset == o.Offset && c.rate() == o.rate() && c.Frozen == o.Frozen &&
+		c.slewing() == o.slewing() && (!c.slewing() || (c.Slew == o.Slew && c.SlewRate == o.SlewRate))
+}
+
+// Rebase returns the running Clock which reads the same as c at now and advances at rate afterwards.
+//
+// The returned clock is continuous with c at now, so changing the rate mid-flight through Rebase never
+// makes the virtual time jump, nor go backwards. Rebasing a frozen clock resumes it from the frozen instant.
+// The slew in progress carries over.
+func (c Clock) Rebase(now time.Time, rate float64) Clock {
+	rebased := Clock{
+		Epoch:  now,
+		Offset: c.TargetOffsetAt(now),
+		Rate:   rate,
+		Slew:   c.remaining(now.Sub(c.Epoch)),
+	}
+	if rebased.Slew != 0 {
+		rebased.SlewRate = c.SlewRate
+	}
+
+	return rebased
+}
+
+// Freeze returns the Clock frozen at the virtual instant which c reads at now.
+func (c Clock) Freeze(now time.Time) Clock {
+	return Clock{
+		Epoch:  now,
+		Offset: c.At(now).Sub(now),
+		Frozen: true,
+	}
+}
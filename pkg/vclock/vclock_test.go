@@ -0,0 +1,208 @@
+// Copyright 2020 The kube-timeleap Authors.
+// SPDX-License-Identifier: BSD-3-Clause
+
+package vclock
+
+import (
+	"testing"
+	"time"
+)
+
+var epoch = time.Date(2020, time.October, 1, 0, 0, 0, 0, time.UTC)
+
+func TestClock_At(t *testing.T) {
+	tests := []struct {
+		name  string
+		clock Clock
+		now   time.Time
+		want  time.Time
+	}{
+		{
+			name:  "Offset",
+			clock: Clock{Epoch: epoch, Offset: 72 * time.Hour},
+			now:   epoch.Add(time.Minute),
+			want:  epoch.Add(72*time.Hour + time.Minute),
+		},
+		{
+			name:  "NegativeOffset",
+			clock: Clock{Epoch: epoch, Offset: -time.Hour},
+			now:   epoch.Add(time.Minute),
+			want:  epoch.Add(-time.Hour + time.Minute),
+		},
+		{
+			name:  "Rate",
+			clock: Clock{Epoch: epoch, Rate: 60},
+			now:   epoch.Add(time.Minute),
+			want:  epoch.Add(time.Hour),
+		},
+		{
+			name:  "SlowRate",
+			clock: Clock{Epoch: epoch, Offset: time.Hour, Rate: 0.5},
+			now:   epoch.Add(time.Hour),
+			want:  epoch.Add(time.Hour + 30*time.Minute),
+		},
+		{
+			name:  "Frozen",
+			clock: Clock{Epoch: epoch, Offset: time.Hour, Rate: 60, Frozen: true},
+			now:   epoch.Add(24 * time.Hour),
+			want:  epoch.Add(time.Hour),
+		},
+		{
+			name:  "BeforeEpoch",
+			clock: Clock{Epoch: epoch, Rate: 2},
+			now:   epoch.Add(-time.Second),
+			want:  epoch.Add(-2 * time.Second),
+		},
+		{
+			name:  "Slewing",
+			clock: Clock{Epoch: epoch, Offset: time.Hour, Slew: time.Hour, SlewRate: 0.5},
+			now:   epoch.Add(30 * time.Minute),
+			want:  epoch.Add(45 * time.Minute),
+		},
+		{
+			name:  "SlewingBackwards",
+			clock: Clock{Epoch: epoch, Offset: -time.Hour, Slew: -time.Hour, SlewRate: 0.5},
+			now:   epoch.Add(30 * time.Minute),
+			want:  epoch.Add(15 * time.Minute),
+		},
+		{
+			name:  "Slewed",
+			clock: Clock{Epoch: epoch, Offset: time.Hour, Slew: time.Hour, SlewRate: 0.5},
+			now:   epoch.Add(3 * time.Hour),
+			want:  epoch.Add(4 * time.Hour),
+		},
+		{
+			name:  "SlewWithoutRate",
+			clock: Clock{Epoch: epoch, Offset: time.Hour, Slew: time.Hour},
+			now:   epoch,
+			want:  epoch.Add(time.Hour),
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := tt.clock.At(tt.now); !got.Equal(tt.want) {
+				t.Fatalf("At(%v) = %v, want %v", tt.now, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClock_Translate(t *testing.T) {
+	c := Clock{Epoch: epoch, Offset: time.Hour, Rate: 2}
+
+	// a monotonic clock which read 1000s at Epoch
+	const epochReading = int64(1000 * time.Second)
+	got := c.Translate(epochReading+int64(time.Second), epochReading)
+	if want := epochReading + int64(time.Hour+2*time.Second); got != want {
+		t.Fatalf("Translate() = %d, want %d", got, want)
+	}
+}
+
+func TestClock_Duration(t *testing.T) {
+	tests := []struct {
+		name  string
+		clock Clock
+		real  time.Duration
+	}{
+		{name: "RealTime", clock: Clock{}, real: time.Minute},
+		{name: "Fast", clock: Clock{Rate: 60}, real: time.Second},
+		{name: "Slow", clock: Clock{Rate: 0.5}, real: 2 * time.Minute},
+		{name: "Frozen", clock: Clock{Rate: 60, Frozen: true}, real: time.Minute},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := tt.clock.RealDuration(time.Minute); got != tt.real {
+				t.Fatalf("RealDuration() = %v, want %v", got, tt.real)
+			}
+			if got := tt.clock.VirtualDuration(tt.real); got != time.Minute {
+				t.Fatalf("VirtualDuration() = %v, want %v", got, time.Minute)
+			}
+		})
+	}
+}
+
+func TestClock_Rebase(t *testing.T) {
+	c := Clock{Epoch: epoch, Offset: 24 * time.Hour, Rate: 60}
+
+	for _, rate := range []float64{0.5, 1, 60, 3600} {
+		changed := epoch.Add(90 * time.Second)
+		rebased := c.Rebase(changed, rate)
+
+		if before, after := c.At(changed), rebased.At(changed); !before.Equal(after) {
+			t.Fatalf("rate %v: virtual time jumped at rebase: %v -> %v", rate, before, after)
+		}
+
+		prev := c.At(changed.Add(-time.Nanosecond))
+		for d := time.Duration(0); d < time.Second; d += 7 * time.Millisecond {
+			now := rebased.At(changed.Add(d))
+			if now.Before(prev) {
+				t.Fatalf("rate %v: virtual time went backwards: %v -> %v", rate, prev, now)
+			}
+			prev = now
+		}
+	}
+}
+
+func TestClock_Freeze(t *testing.T) {
+	c := Clock{Epoch: epoch, Offset: time.Hour, Rate: 2}
+
+	frozenAt := epoch.Add(time.Minute)
+	frozen := c.Freeze(frozenAt)
+	want := c.At(frozenAt)
+	for _, d := range []time.Duration{0, time.Second, 48 * time.Hour} {
+		if got := frozen.At(frozenAt.Add(d)); !got.Equal(want) {
+			t.Fatalf("frozen clock advanced after %v: got %v, want %v", d, got, want)
+		}
+	}
+
+	resumedAt := frozenAt.Add(time.Hour)
+	resumed := frozen.Rebase(resumedAt, 1)
+	if got := resumed.At(resumedAt.Add(time.Second)); !got.Equal(want.Add(time.Second)) {
+		t.Fatalf("resumed clock = %v, want %v", got, want.Add(time.Second))
+	}
+}
+
+func TestClock_Slew(t *testing.T) {
+	// the clock slowing down runs at Rate-SlewRate, which must stay positive below the real-time rate too
+	for _, rates := range []struct{ rate, slewRate float64 }{{2, 0.9}, {0.5, 0.4}} {
+		for _, slew := range []time.Duration{time.Hour, -time.Hour} {
+			c := Clock{Epoch: epoch, Offset: slew, Rate: rates.rate, Slew: slew, SlewRate: rates.slewRate}
+
+			if got := c.OffsetAt(epoch); got != 0 {
+				t.Fatalf("rate %v slew %v: clock jumped at epoch by %v", c.Rate, slew, got)
+			}
+			if want := epoch.Add(time.Duration(float64(time.Hour) / c.SlewRate)); !c.SlewEnd().Equal(want) {
+				t.Fatalf("rate %v slew %v: SlewEnd() = %v, want %v", c.Rate, slew, c.SlewEnd(), want)
+			}
+
+			prev := c.At(epoch)
+			for now := epoch; now.Before(c.SlewEnd().Add(time.Hour)); now = now.Add(17 * time.Second) {
+				v := c.At(now)
+				if v.Before(prev) {
+					t.Fatalf("rate %v slew %v: virtual time went backwards: %v -> %v", c.Rate, slew, prev, v)
+				}
+				prev = v
+			}
+
+			after := c.SlewEnd().Add(time.Minute)
+			if got, want := c.OffsetAt(after), c.TargetOffsetAt(after); got != want {
+				t.Fatalf("rate %v slew %v: offset %v has not converged to %v", c.Rate, slew, got, want)
+			}
+
+			changed := epoch.Add(10 * time.Minute)
+			rebased := c.Rebase(changed, 1)
+			if before, after := c.At(changed), rebased.At(changed); !before.Equal(after) {
+				t.Fatalf("rate %v slew %v: virtual time jumped at rebase: %v -> %v", c.Rate, slew, before, after)
+			}
+			if !rebased.SlewEnd().Equal(c.SlewEnd()) {
+				t.Fatalf("rate %v slew %v: rebase moved the slew end from %v to %v", c.Rate, slew, c.SlewEnd(), rebased.SlewEnd())
+			}
+		}
+	}
+}
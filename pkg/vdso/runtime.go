@@ -3,27 +3,39 @@
 package vdso
 
 import (
+	"os"
+	"reflect"
 	_ "runtime" // for go:linkname
 	"unsafe"
 )
 
-//go:linkname gostringnocopy runtime.gostringnocopy
+// gostringnocopy returns the NUL-terminated string at str without copying it, as runtime.gostringnocopy does,
+// which is not linkable since Go 1.23.
 //go:nosplit
-func gostringnocopy(str *byte) string
+func gostringnocopy(str *byte) string {
+	n := 0
+	for *(*byte)(add(unsafe.Pointer(str), uintptr(n))) != 0 {
+		n++
+	}
+
+	var s string
+	hdr := (*reflect.StringHeader)(unsafe.Pointer(&s))
+	hdr.Data = uintptr(unsafe.Pointer(str))
+	hdr.Len = n
+
+	return s
+}
 
 //go:linkname add runtime.add
 //go:nosplit
 func add(p unsafe.Pointer, x uintptr) unsafe.Pointer
 
-//go:linkname physPageSize runtime.physPageSize
-
 // physPageSize is the size in bytes of the OS's physical pages.
 // Mapping and unmapping operations must be done at multiples of
 // physPageSize.
 //
-// This must be set by the OS init code (typically in osinit) before
-// mallocinit.
-var physPageSize uintptr
+// The runtime.physPageSize is not linkable since Go 1.23, so it's taken from os.Getpagesize, which reports it.
+var physPageSize = uintptr(os.Getpagesize())
 
 //go:linkname noescape runtime.noescape
 //go:nosplit
@@ -8,6 +8,7 @@ package vdso
 import (
 	"unsafe"
 
+	"github.com/zchee/kube-timeleap/pkg/vclock"
 	"github.com/zchee/kube-timeleap/pkg/vdso/elfdef"
 )
 
@@ -34,6 +35,10 @@ type SymbolKey struct {
 	SymHash uint32
 	GnuHash uint32
 	Ptr     *uintptr
+
+	// Clocks is the kernel clocks which the symbol reads.
+	// A nil Clocks means the symbol reads the clock given by the caller, as clock_gettime does.
+	Clocks []vclock.ID
 }
 
 // VersionKey represents a vDSO Version key entries.
@@ -49,12 +54,49 @@ var LinuxVersion = VersionKey{"LINUX_2.6", 0x3ae75f6}
 var (
 	GettimeofdaySym uintptr = 0xffffffffff600000
 	ClockgettimeSym uintptr = 0
+	TimeSym         uintptr = 0xffffffffff600400
 )
 
 // SymbolKeys is the Linux amd64 vDSO symbol keys.
 var SymbolKeys = []SymbolKey{
-	{"__vdso_gettimeofday", 0x315ca59, 0xb01bca00, &GettimeofdaySym},
-	{"__vdso_clock_gettime", 0xd35ec75, 0x6e43a318, &ClockgettimeSym},
+	{"__vdso_gettimeofday", 0x315ca59, 0xb01bca00, &GettimeofdaySym, []vclock.ID{vclock.Realtime}},
+	{"__vdso_clock_gettime", 0xd35ec75, 0x6e43a318, &ClockgettimeSym, nil},
+	{"__vdso_time", 0xa33c485, 0x821e8e0d, &TimeSym, []vclock.ID{vclock.Realtime}},
+}
+
+// SymbolKeysFor returns the vDSO symbol keys which can read any of the clocks.
+//
+// Only these symbols need to be diverted from the vDSO to the system call in order to
+// replace the clocks, the others keep running at the vDSO speed.
+func SymbolKeysFor(clocks ...vclock.ID) []SymbolKey {
+	keys := make([]SymbolKey, 0, len(SymbolKeys))
+	for _, k := range SymbolKeys {
+		if k.reads(clocks) {
+			keys = append(keys, k)
+		}
+	}
+
+	return keys
+}
+
+// reads reports whether the k reads any of the clocks.
+func (k SymbolKey) reads(clocks []vclock.ID) bool {
+	if len(clocks) == 0 {
+		return false
+	}
+	if k.Clocks == nil {
+		return true
+	}
+
+	for _, id := range clocks {
+		for _, kid := range k.Clocks {
+			if id.Base() == kid {
+				return true
+			}
+		}
+	}
+
+	return false
 }
 
 // VDSO represents a vDSO object.
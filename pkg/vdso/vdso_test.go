@@ -0,0 +1,110 @@
+// Copyright 2020 The kube-timeleap Authors.
+// SPDX-License-Identifier: BSD-3-Clause
+
+// +build linux
+
+package vdso
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/zchee/kube-timeleap/pkg/vclock"
+)
+
+// elfHash returns the SysV ELF hash of name, as the DT_HASH table keys it.
+func elfHash(name string) uint32 {
+	var h uint32
+	for i := 0; i < len(name); i++ {
+		h = h<<4 + uint32(name[i])
+		g := h & 0xf0000000
+		if g != 0 {
+			h ^= g >> 24
+		}
+		h &^= g
+	}
+
+	return h
+}
+
+// gnuHash returns the GNU hash of name, as the DT_GNU_HASH table keys it.
+func gnuHash(name string) uint32 {
+	h := uint32(5381)
+	for i := 0; i < len(name); i++ {
+		h = h*33 + uint32(name[i])
+	}
+
+	return h
+}
+
+func TestSymbolKeys_Hash(t *testing.T) {
+	for _, k := range SymbolKeys {
+		k := k
+		t.Run(k.Name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := elfHash(k.Name); got != k.SymHash {
+				t.Fatalf("SymHash = %#x, want %#x", k.SymHash, got)
+			}
+			if got := gnuHash(k.Name); got != k.GnuHash {
+				t.Fatalf("GnuHash = %#x, want %#x", k.GnuHash, got)
+			}
+		})
+	}
+}
+
+func TestSymbolKeysFor(t *testing.T) {
+	// CLOCK_REALTIME_COARSE, which follows the CLOCK_REALTIME
+	const realtimeCoarse = vclock.ID(5)
+
+	tests := []struct {
+		name   string
+		clocks []vclock.ID
+		want   []string
+	}{
+		{
+			name: "NoClocks",
+			want: []string{},
+		},
+		{
+			name:   "Realtime",
+			clocks: []vclock.ID{vclock.Realtime},
+			want:   []string{"__vdso_gettimeofday", "__vdso_clock_gettime", "__vdso_time"},
+		},
+		{
+			name:   "RealtimeCoarse",
+			clocks: []vclock.ID{realtimeCoarse},
+			want:   []string{"__vdso_gettimeofday", "__vdso_clock_gettime", "__vdso_time"},
+		},
+		{
+			name:   "Monotonic",
+			clocks: []vclock.ID{vclock.Monotonic},
+			want:   []string{"__vdso_clock_gettime"},
+		},
+		{
+			name:   "MonotonicAndBoottime",
+			clocks: []vclock.ID{vclock.Monotonic, vclock.Boottime},
+			want:   []string{"__vdso_clock_gettime"},
+		},
+		{
+			name:   "MonotonicAndRealtime",
+			clocks: []vclock.ID{vclock.Monotonic, vclock.Realtime},
+			want:   []string{"__vdso_gettimeofday", "__vdso_clock_gettime", "__vdso_time"},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got := []string{}
+			for _, k := range SymbolKeysFor(tt.clocks...) {
+				got = append(got, k.Name)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Fatalf("(-want +got):\n%s", diff)
+			}
+		})
+	}
+}